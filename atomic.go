@@ -0,0 +1,233 @@
+package cachekv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// updateRetrying runs fn in a read-write transaction on db, running it again
+// from a fresh read when badger reports a conflict with another transaction
+// that committed in the meantime. fn must be safe to run more than once.
+func updateRetrying(db *badger.DB, fn func(txn *badger.Txn) error) error {
+	for {
+		err := db.Update(fn)
+		if !errors.Is(err, badger.ErrConflict) {
+			return err
+		}
+	}
+}
+
+// CompareAndSwap stores newValue under key only if the value there is
+// oldValue, and reports whether it did. A nil oldValue matches a missing key,
+// so CompareAndSwap with nil creates a key only if there is none. The read,
+// the comparison and the write happen in one transaction, and a transaction
+// that raced another writer is retried against the new value, so the swap is
+// atomic. newValue gets the database's DefaultTTL, as with InsertEntry.
+func (s *Store) CompareAndSwap(dbName, key string, oldValue, newValue []byte) (bool, error) {
+	defer s.observeOp(dbName, "CompareAndSwap", time.Now())
+	db, dbObject, err := s.openWritableDbByName(dbName)
+	if err != nil {
+		return false, err
+	}
+	if err = checkValueSize(dbName, dbObject.MaxValueSize, newValue); err != nil {
+		_ = s.releaseDb(dbName, db)
+		return false, err
+	}
+	entry, err := valueEntry([]byte(key), newValue, s.writeEncoding(dbObject))
+	if err != nil {
+		_ = s.releaseDb(dbName, db)
+		return false, err
+	}
+	if dbObject.DefaultTTL > 0 {
+		entry = entry.WithTTL(dbObject.DefaultTTL)
+	}
+	swapped := false
+	err = updateRetrying(db, func(txn *badger.Txn) error {
+		swapped = false
+		current, err := txnValue(txn, []byte(key))
+		if err != nil {
+			return err
+		}
+		if !valuesMatch(current, oldValue) {
+			return nil
+		}
+		swapped = true
+		return txn.SetEntry(entry)
+	})
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return false, err
+	}
+	if closeErr != nil {
+		return false, closeErr
+	}
+	if swapped && entry.ExpiresAt > 0 {
+		return true, s.indexExpiry(dbName, key, entry.ExpiresAt)
+	}
+	return swapped, nil
+}
+
+// CompareAndSwap calls Store.CompareAndSwap on the default store.
+func CompareAndSwap(dbName, key string, oldValue, newValue []byte) (bool, error) {
+	return defaultStore.CompareAndSwap(dbName, key, oldValue, newValue)
+}
+
+// txnValue reads key's value in txn, nil if the key is missing.
+func txnValue(txn *badger.Txn, key []byte) ([]byte, error) {
+	item, err := txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if itemExpired(item) {
+		return nil, nil
+	}
+	value, err := itemValue(item)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		// tell an empty value from a missing key
+		value = []byte{}
+	}
+	return value, nil
+}
+
+// valuesMatch compares a value read with txnValue to an expected one, where
+// nil stands for a missing key.
+func valuesMatch(current, expected []byte) bool {
+	if current == nil || expected == nil {
+		return current == nil && expected == nil
+	}
+	return bytes.Equal(current, expected)
+}
+
+// Increment adds delta to the counter stored under key and returns the new
+// value. Counters are 8-byte little-endian int64 values, a missing key
+// counting as 0; any other value under key is an error. The read and the
+// write happen in one transaction, retried if another writer got in between,
+// so concurrent increments are never lost. These counters are plain entries,
+// separate from the merge-based ones kept by OpenCounters.
+func (s *Store) Increment(dbName, key string, delta int64) (int64, error) {
+	defer s.observeOp(dbName, "Increment", time.Now())
+	db, dbObject, err := s.openWritableDbByName(dbName)
+	if err != nil {
+		return 0, err
+	}
+	n, expiresAt, err := incrementValue(db, key, delta, s.writeEncoding(dbObject), dbObject.DefaultTTL)
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return 0, err
+	}
+	if closeErr != nil {
+		return 0, closeErr
+	}
+	if expiresAt > 0 {
+		return n, s.indexExpiry(dbName, key, expiresAt)
+	}
+	return n, nil
+}
+
+// Increment calls Store.Increment on the default store.
+func Increment(dbName, key string, delta int64) (int64, error) {
+	return defaultStore.Increment(dbName, key, delta)
+}
+
+// Decrement subtracts delta from the counter under key, see Increment.
+func (s *Store) Decrement(dbName, key string, delta int64) (int64, error) {
+	return s.Increment(dbName, key, -delta)
+}
+
+// Decrement calls Store.Decrement on the default store.
+func Decrement(dbName, key string, delta int64) (int64, error) {
+	return defaultStore.Decrement(dbName, key, delta)
+}
+
+// Increment adds delta to the counter under key, see Store.Increment.
+func (t *Storage) Increment(key string, delta int64) (int64, error) {
+	if err := t.checkWritable(); err != nil {
+		return 0, err
+	}
+	n, _, err := incrementValue(t.db, key, delta, t.encoding, 0)
+	return n, err
+}
+
+// incrementValue adds delta to the counter under key in db, returning the new
+// value and when the entry expires if ttl is set.
+func incrementValue(db *badger.DB, key string, delta int64, encoding valueEncoding, ttl time.Duration) (int64, uint64, error) {
+	var n int64
+	var expiresAt uint64
+	err := updateRetrying(db, func(txn *badger.Txn) error {
+		current, err := txnValue(txn, []byte(key))
+		if err != nil {
+			return err
+		}
+		if current != nil && len(current) != 8 {
+			return fmt.Errorf("value under %s is not an 8-byte counter", key)
+		}
+		n = delta
+		if current != nil {
+			n += int64(binary.LittleEndian.Uint64(current))
+		}
+		value := make([]byte, 8)
+		binary.LittleEndian.PutUint64(value, uint64(n))
+		entry, err := valueEntry([]byte(key), value, encoding)
+		if err != nil {
+			return err
+		}
+		if ttl > 0 {
+			entry = entry.WithTTL(ttl)
+		}
+		expiresAt = entry.ExpiresAt
+		return txn.SetEntry(entry)
+	})
+	return n, expiresAt, err
+}
+
+// DeleteIfEquals deletes key only if its value is expected, and reports
+// whether it did; a missing key is never deleted. Like CompareAndSwap, the
+// check and the delete happen in one transaction, so an entry rewritten by
+// someone else in between is left alone.
+func (s *Store) DeleteIfEquals(dbName, key string, expected []byte) (bool, error) {
+	defer s.observeOp(dbName, "DeleteIfEquals", time.Now())
+	db, _, err := s.openWritableDbByName(dbName)
+	if err != nil {
+		return false, err
+	}
+	deleted := false
+	err = updateRetrying(db, func(txn *badger.Txn) error {
+		deleted = false
+		current, err := txnValue(txn, []byte(key))
+		if err != nil {
+			return err
+		}
+		if current == nil || !valuesMatch(current, expected) {
+			return nil
+		}
+		deleted = true
+		if err := txn.Delete([]byte(key)); err != nil {
+			return err
+		}
+		return deleteEntryMeta(txn, key)
+	})
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return false, err
+	}
+	if deleted {
+		_ = s.writeDbEvent(EventTypeDelete, dbName, "Deleted entry: "+dbName+":"+key)
+	}
+	return deleted, closeErr
+}
+
+// DeleteIfEquals calls Store.DeleteIfEquals on the default store.
+func DeleteIfEquals(dbName, key string, expected []byte) (bool, error) {
+	return defaultStore.DeleteIfEquals(dbName, key, expected)
+}
@@ -0,0 +1,130 @@
+package cachekv
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+
+	// create if absent
+	swapped, err := CompareAndSwap(testDb, "key", nil, []byte("v1"))
+	assert.Nil(t, err)
+	assert.True(t, swapped)
+	swapped, err = CompareAndSwap(testDb, "key", nil, []byte("other"))
+	assert.Nil(t, err)
+	assert.False(t, swapped)
+
+	// match
+	swapped, err = CompareAndSwap(testDb, "key", []byte("v1"), []byte("v2"))
+	assert.Nil(t, err)
+	assert.True(t, swapped)
+	value, err := GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), value)
+
+	// mismatch
+	swapped, err = CompareAndSwap(testDb, "key", []byte("v1"), []byte("v3"))
+	assert.Nil(t, err)
+	assert.False(t, swapped)
+	value, err = GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), value)
+
+	// an empty value is there, not missing
+	swapped, err = CompareAndSwap(testDb, "key", []byte("v2"), []byte{})
+	assert.Nil(t, err)
+	assert.True(t, swapped)
+	swapped, err = CompareAndSwap(testDb, "key", nil, []byte("v4"))
+	assert.Nil(t, err)
+	assert.False(t, swapped)
+	swapped, err = CompareAndSwap(testDb, "key", []byte{}, []byte("v4"))
+	assert.Nil(t, err)
+	assert.True(t, swapped)
+
+	assert.Nil(t, SetReadOnly(testDb, true))
+	_, err = CompareAndSwap(testDb, "key", []byte("v4"), []byte("v5"))
+	assert.ErrorIs(t, err, ErrDbReadOnly)
+}
+
+func TestIncrement(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	n, err := Increment(testDb, "hits", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+	n, err = Decrement(testDb, "hits", 7)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-2), n)
+	value, err := GetEntry(testDb, "hits")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, value)
+	assert.Nil(t, InsertEntry(testDb, "name", []byte("not a counter")))
+	_, err = Increment(testDb, "name", 1)
+	assert.NotNil(t, err)
+
+	// concurrent increments are all counted
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				_, e := Increment(testDb, "concurrent", 1)
+				assert.Nil(t, e)
+			}
+		}()
+	}
+	wg.Wait()
+	n, err = Increment(testDb, "concurrent", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1000), n)
+
+	// and so are those made through a Storage
+	storage, err := OpenStorage(testDb)
+	assert.Nil(t, err)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				_, e := storage.Increment("concurrent", 1)
+				assert.Nil(t, e)
+			}
+		}()
+	}
+	wg.Wait()
+	n, err = storage.Increment("concurrent", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2000), n)
+	assert.Nil(t, storage.Close())
+}
+
+func TestDeleteIfEquals(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	deleted, err := DeleteIfEquals(testDb, "lock", []byte("owner-a"))
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+
+	assert.Nil(t, InsertEntry(testDb, "lock", []byte("owner-a")))
+	deleted, err = DeleteIfEquals(testDb, "lock", []byte("owner-b"))
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+	value, err := GetEntry(testDb, "lock")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("owner-a"), value)
+
+	deleted, err = DeleteIfEquals(testDb, "lock", []byte("owner-a"))
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+	_, err = GetEntry(testDb, "lock")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,85 @@
+package cachekv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// backupPendingWrites is how many batches RestoreDatabaseFromBackup lets
+// badger have in flight while loading.
+const backupPendingWrites = 256
+
+// BackupDatabase writes a full backup of dbName to w in badger's backup
+// format and returns the version of the last entry written. Entries are
+// written as the database decrypts them, so a backup of a secure database is
+// not encrypted: keep it somewhere as safe as the keyring. Expiry times are
+// kept; entries already expired are left out.
+func (s *Store) BackupDatabase(dbName string, w io.Writer) (uint64, error) {
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		return 0, err
+	}
+	version, err := db.Backup(w, 0)
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return 0, err
+	}
+	return version, closeErr
+}
+
+// BackupDatabase calls Store.BackupDatabase on the default store.
+func BackupDatabase(dbName string, w io.Writer) (uint64, error) {
+	return defaultStore.BackupDatabase(dbName, w)
+}
+
+// RestoreDatabaseFromBackup loads a backup written by BackupDatabase into
+// dbName. A database that isn't registered is created first, secure if
+// Config.SecureNewDb says so, with a key of its own; restoring into an
+// existing database adds the backed-up entries to what it holds. Other
+// operations on dbName wait until the load is done.
+func (s *Store) RestoreDatabaseFromBackup(dbName string, r io.Reader) error {
+	exist, err := s.databaseExist(dbName)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		if err = s.CreateDatabaseDefault(dbName); err != nil {
+			return err
+		}
+	}
+	if s.isDbRotating(dbName) {
+		return errors.New(dbName + " - " + errDbRotating)
+	}
+	// badger wants nothing else writing while it loads
+	gate, err := s.lockDb(dbName)
+	if err != nil {
+		return err
+	}
+	defer gate.Unlock()
+	dbObject, err := s.getMetaDbObject(dbName)
+	if err != nil {
+		return err
+	}
+	if !dbObject.Active {
+		return errors.New(dbName + " - " + errDbInactive)
+	}
+	if dbObject.ReadOnly {
+		return fmt.Errorf("%s - %w", dbName, ErrDbReadOnly)
+	}
+	db, err := s.openDbObject(dbName, dbObject)
+	if err != nil {
+		return err
+	}
+	err = db.Load(r, backupPendingWrites)
+	closeErr := CloseDatabase(db)
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// RestoreDatabaseFromBackup calls Store.RestoreDatabaseFromBackup on the default store.
+func RestoreDatabaseFromBackup(dbName string, r io.Reader) error {
+	return defaultStore.RestoreDatabaseFromBackup(dbName, r)
+}
@@ -0,0 +1,42 @@
+package cachekv
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupRestoreDatabase(t *testing.T) {
+	defer setup()()
+	entries := make(map[string][]byte)
+	keys := make([]string, 0)
+	for i := range 50 {
+		key := "key" + strconv.Itoa(i)
+		entries[key] = []byte("value\x00" + strconv.Itoa(i))
+		keys = append(keys, key)
+	}
+	for _, secure := range []bool{true, false} {
+		testDb := "testdb-" + strconv.FormatBool(secure)
+		assert.Nil(t, CreateDatabase(testDb, secure))
+		assert.Nil(t, BatchInsert(testDb, entries))
+		var backup bytes.Buffer
+		version, err := BackupDatabase(testDb, &backup)
+		assert.Nil(t, err)
+		assert.Greater(t, version, uint64(0))
+
+		assert.Nil(t, DeleteDatabase(testDb))
+		assert.Nil(t, RestoreDatabaseFromBackup(testDb, &backup))
+		values, err := BatchGet(testDb, keys)
+		assert.Nil(t, err)
+		assert.Equal(t, entries, values)
+	}
+	// recreated under the store's policy
+	dbObject, err := defaultStore.getMetaDbObject("testdb-false")
+	assert.Nil(t, err)
+	assert.True(t, dbObject.Secure)
+
+	_, err = BackupDatabase("missing", &bytes.Buffer{})
+	assert.NotNil(t, err)
+}
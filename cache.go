@@ -0,0 +1,113 @@
+package cachekv
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const cacheDbName = "_cache"
+
+// Cache stores value under key in the package's cache database for
+// duration. badger drops it once the duration (rounded to whole seconds) is
+// up, after which CacheGet reports badger.ErrKeyNotFound.
+func (s *Store) Cache(key string, value []byte, duration time.Duration) error {
+	if duration <= 0 {
+		return errors.New("cache duration must be positive")
+	}
+	err := s.ensureDatabase(cacheDbName, true)
+	if err != nil {
+		return err
+	}
+	db, dbObject, err := s.openDbByName(cacheDbName)
+	if err != nil {
+		return err
+	}
+	entry, err := valueEntry([]byte(key), value, s.writeEncoding(dbObject))
+	if err == nil {
+		err = setDbValueEntry(entry.WithTTL(duration), db)
+	}
+	closeErr := s.releaseDb(cacheDbName, db)
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Cache calls Store.Cache on the default store.
+func Cache(key string, value []byte, duration time.Duration) error {
+	return defaultStore.Cache(key, value, duration)
+}
+
+// CacheGet returns the value cached under key, or badger.ErrKeyNotFound if
+// it was never cached or has expired.
+func (s *Store) CacheGet(key string) ([]byte, error) {
+	exist, err := s.databaseExist(cacheDbName)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, badger.ErrKeyNotFound
+	}
+	return s.getEntry(context.Background(), cacheDbName, key)
+}
+
+// CacheGet calls Store.CacheGet on the default store.
+func CacheGet(key string) ([]byte, error) {
+	return defaultStore.CacheGet(key)
+}
+
+// CacheExpiringSoon is the window CacheStats counts entries as expiring soon
+// in.
+var CacheExpiringSoon = time.Minute
+
+// CacheStats returns how many entries the cache holds and how many of them
+// expire within CacheExpiringSoon. Entries already expired aren't counted,
+// even if badger hasn't reclaimed them yet, e.g. after a restart.
+func (s *Store) CacheStats() (entries int, expiringSoon int, err error) {
+	exist, err := s.databaseExist(cacheDbName)
+	if err != nil || !exist {
+		return 0, 0, err
+	}
+	db, _, err := s.openDbByName(cacheDbName)
+	if err != nil {
+		return 0, 0, err
+	}
+	soon := uint64(time.Now().Add(CacheExpiringSoon).Unix())
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if itemExpired(item) {
+				continue
+			}
+			entries++
+			if item.ExpiresAt() > 0 && item.ExpiresAt() <= soon {
+				expiringSoon++
+			}
+		}
+		return nil
+	})
+	closeErr := s.releaseDb(cacheDbName, db)
+	if err == nil {
+		err = closeErr
+	}
+	return entries, expiringSoon, err
+}
+
+// CacheStats calls Store.CacheStats on the default store.
+func CacheStats() (entries int, expiringSoon int, err error) {
+	return defaultStore.CacheStats()
+}
+
+// itemExpired reports whether item's TTL has passed. badger hides expired
+// items itself; this keeps values from ever being read past their expiry,
+// whatever the read path.
+func itemExpired(item *badger.Item) bool {
+	return item.ExpiresAt() > 0 && item.ExpiresAt() <= uint64(time.Now().Unix())
+}
@@ -0,0 +1,73 @@
+package cachekv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	defer setup()()
+	_, err := CacheGet("key")
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+	assert.NotNil(t, Cache("key", []byte("value"), 0))
+
+	assert.Nil(t, Cache("key", []byte("value"), 2*time.Second))
+	assert.Nil(t, Cache("long", []byte("kept"), time.Minute))
+	value, err := CacheGet("key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	_, err = CacheGet("missing")
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+
+	time.Sleep(3 * time.Second)
+	_, err = CacheGet("key")
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+	value, err = CacheGet("long")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("kept"), value)
+	// the other read paths don't see the expired key either
+	err = ViewEntry(cacheDbName, "key", func(val []byte) error { return nil })
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+	exist, err := Exists(cacheDbName, "key")
+	assert.Nil(t, err)
+	assert.False(t, exist)
+	exist, err = Exists(cacheDbName, "long")
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	present, missing, err := GetMissing(cacheDbName, []string{"key", "long"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"long": []byte("kept")}, present)
+	assert.Equal(t, []string{"key"}, missing)
+}
+
+func TestCacheStats(t *testing.T) {
+	defer setup()()
+	entries, expiringSoon, err := CacheStats()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, entries)
+	assert.Equal(t, 0, expiringSoon)
+
+	assert.Nil(t, Cache("short", []byte("value"), 2*time.Second))
+	assert.Nil(t, Cache("long", []byte("kept"), time.Hour))
+	entries, expiringSoon, err = CacheStats()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, entries)
+	assert.Equal(t, 1, expiringSoon)
+
+	// expired entries stay gone across a restart
+	assert.Nil(t, Shutdown())
+	time.Sleep(3 * time.Second)
+	Startup()
+	_, err = CacheGet("short")
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+	value, err := CacheGet("long")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("kept"), value)
+	entries, expiringSoon, err = CacheStats()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, entries)
+	assert.Equal(t, 0, expiringSoon)
+}
@@ -0,0 +1,82 @@
+package cachekv
+
+import (
+	"bytes"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// ChangesSince streams the latest state of every key of dbName written after
+// sinceVersion, for incremental replication: a replica applies the changes,
+// deleting the keys sent with Deleted set, and asks from highWater next time.
+// Each KV carries the version it was written at. As with Stream, the error
+// channel receives at most one error, including a failure to open dbName, and
+// highWater is only meaningful if none arrives. Keys whose old versions were
+// already compacted away still show up, as badger keeps their latest version;
+// deletions only show up while badger still has the tombstone.
+func (s *Store) ChangesSince(dbName string, sinceVersion uint64) (changes <-chan KV, highWater uint64, errs <-chan error) {
+	out := make(chan KV, streamBuffer)
+	errc := make(chan error, 1)
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		errc <- err
+		close(out)
+		close(errc)
+		return out, 0, errc
+	}
+	// other callers keep writing through the shared handle, so the changes
+	// are read in one transaction, whose read timestamp is the high water
+	txn := db.NewTransaction(false)
+	highWater = txn.ReadTs()
+	go func() {
+		defer close(out)
+		defer close(errc)
+		err := streamChanges(txn, sinceVersion, out)
+		txn.Discard()
+		closeErr := s.releaseDb(dbName, db)
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return out, highWater, errc
+}
+
+// ChangesSince calls Store.ChangesSince on the default store.
+func ChangesSince(dbName string, sinceVersion uint64) (changes <-chan KV, highWater uint64, errs <-chan error) {
+	return defaultStore.ChangesSince(dbName, sinceVersion)
+}
+
+// streamChanges sends the newest version of every key txn sees that was
+// written after sinceVersion, in key order.
+func streamChanges(txn *badger.Txn, sinceVersion uint64, out chan<- KV) error {
+	opts := badger.DefaultIteratorOptions
+	opts.AllVersions = true
+	opts.SinceTs = sinceVersion
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	var last []byte
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		if isReservedKey(item.Key()) {
+			continue
+		}
+		// only the newest version of each key matters to a replica
+		if last != nil && bytes.Equal(item.Key(), last) {
+			continue
+		}
+		last = item.KeyCopy(nil)
+		if item.IsDeletedOrExpired() {
+			out <- KV{Key: last, Version: item.Version(), Deleted: true}
+			continue
+		}
+		value, err := itemValue(item)
+		if err != nil {
+			return err
+		}
+		out <- KV{Key: last, Value: value, Version: item.Version()}
+	}
+	return nil
+}
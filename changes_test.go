@@ -0,0 +1,63 @@
+package cachekv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func drainChanges(t *testing.T, changes <-chan KV, errs <-chan error) map[string]KV {
+	seen := make(map[string]KV)
+	for kv := range changes {
+		seen[string(kv.Key)] = kv
+	}
+	assert.Nil(t, <-errs)
+	return seen
+}
+
+func TestChangesSince(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "a", []byte("1")))
+	assert.Nil(t, InsertEntry(testDb, "b", []byte("1")))
+
+	changes, highWater, errs := ChangesSince(testDb, 0)
+	seen := drainChanges(t, changes, errs)
+	assert.Equal(t, 2, len(seen))
+	assert.Equal(t, []byte("1"), seen["a"].Value)
+	assert.LessOrEqual(t, seen["b"].Version, highWater)
+
+	assert.Nil(t, InsertEntry(testDb, "b", []byte("2")))
+	assert.Nil(t, RemoveEntry(testDb, "a"))
+	assert.Nil(t, InsertEntry(testDb, "c", []byte("1")))
+	changes, next, errs := ChangesSince(testDb, highWater)
+	seen = drainChanges(t, changes, errs)
+	assert.Greater(t, next, highWater)
+	assert.Equal(t, 3, len(seen))
+	assert.True(t, seen["a"].Deleted)
+	assert.Equal(t, []byte("2"), seen["b"].Value)
+	assert.False(t, seen["b"].Deleted)
+	assert.Equal(t, []byte("1"), seen["c"].Value)
+	for _, kv := range seen {
+		assert.Greater(t, kv.Version, highWater)
+	}
+
+	changes, last, errs := ChangesSince(testDb, next)
+	assert.Empty(t, drainChanges(t, changes, errs))
+	assert.Equal(t, next, last)
+
+	// a write made while the changes are read comes with the next call
+	changes, highWater, errs = ChangesSince(testDb, last)
+	assert.Nil(t, InsertEntry(testDb, "late", []byte("1")))
+	assert.Empty(t, drainChanges(t, changes, errs))
+	changes, _, errs = ChangesSince(testDb, highWater)
+	seen = drainChanges(t, changes, errs)
+	assert.Equal(t, 1, len(seen))
+	assert.Equal(t, []byte("1"), seen["late"].Value)
+
+	changes, _, errs = ChangesSince("missing", 0)
+	for range changes {
+	}
+	assert.NotNil(t, <-errs)
+}
@@ -9,33 +9,42 @@ import (
 	"encoding/hex"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io"
-	"log"
+	"io/fs"
 	mrand "math/rand"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/foundriesio/go-ecies"
+	"github.com/zalando/go-keyring"
 )
 
 var (
 	privateFile = "cvc-key.pem"
 	publicFile  = "cvc-public.pem"
+	// KeypairInKeyring keeps the keypair in the OS keyring (the keychain,
+	// Secret Service or Credential Manager) instead of writing it to KeyPath,
+	// each store's under a service of its own, see Store.keyringService. Set
+	// it before Startup, and keep it the same for the life of the store.
+	KeypairInKeyring = false
 )
 
-func genKeypair() error {
+func (s *Store) genKeypair() error {
 	// WARNING: this will overwrite existing keypair
 	curve := elliptic.P384()
 	private, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
-		log.Printf("Error generating keypair: %v", err)
+		logger().Errorf("Error generating keypair: %v", err)
 		return err
 	}
 	public := &private.PublicKey
 	strPrivate, strPublic := encode(private, public)
-	err = writeToStorage(strPrivate, strPublic, KeyPath, true)
+	err = s.writeToStorage(strPrivate, strPublic, s.keyDir(), true)
 	return err
 }
 
@@ -59,7 +68,12 @@ func decode(pemEncoded []byte, pemEncodePub []byte) (*ecdsa.PrivateKey, *ecdsa.P
 	return privateKey, publicKey
 }
 
-func writeToStorage(privateKey []byte, publicKey []byte, targetDir string, overwrite ...bool) error {
+func (s *Store) writeToStorage(privateKey []byte, publicKey []byte, targetDir string, overwrite ...bool) error {
+	s.keypairMu.Lock()
+	defer s.keypairMu.Unlock()
+	if KeypairInKeyring {
+		return s.writeToOsKeyring(privateKey, publicKey, len(overwrite) > 0 && overwrite[0])
+	}
 	privatePath := path.Join(targetDir, privateFile)
 	publicPath := path.Join(targetDir, publicFile)
 	shouldOverwrite := false
@@ -78,30 +92,133 @@ func writeToStorage(privateKey []byte, publicKey []byte, targetDir string, overw
 		if !shouldOverwrite {
 			return errors.New("target file(s) already exists")
 		} else {
-			// not really overwriting file, rename
-			oldPath := privatePath
-			newPath := privatePath + "." + strconv.FormatInt(time.Now().Unix(), 10)
-			err := os.Rename(oldPath, newPath)
-			if err != nil {
-				return err
+			// not really overwriting file, keep the old one under a
+			// timestamped name; the live name never goes missing
+			suffix := freeArchiveSuffix(clock().Unix(), func(suffix string) bool {
+				_, errPrivate := os.Stat(privatePath + suffix)
+				_, errPublic := os.Stat(publicPath + suffix)
+				return errPrivate == nil || errPublic == nil
+			})
+			if errPrivate == nil {
+				if err := archiveFile(privatePath, privatePath+suffix); err != nil {
+					return err
+				}
 			}
-			oldPath = publicPath
-			newPath = publicPath + "." + strconv.FormatInt(time.Now().Unix(), 10)
-			err = os.Rename(oldPath, newPath)
-			if err != nil {
-				return err
+			if errPublic == nil {
+				if err := archiveFile(publicPath, publicPath+suffix); err != nil {
+					return err
+				}
 			}
 		}
 	}
-	err := os.WriteFile(privatePath, privateKey, 0600)
+	err := writeFileAtomic(privatePath, privateKey, 0600)
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(publicPath, publicKey, 0644)
+	return writeFileAtomic(publicPath, publicKey, 0644)
+}
+
+// archiveSuffix is what the names of a keypair archived at timestamp end in.
+// seq tells apart the keypairs archived in the same second, 0 being the first.
+func archiveSuffix(timestamp int64, seq int) string {
+	suffix := "." + strconv.FormatInt(timestamp, 10)
+	if seq > 0 {
+		suffix += "-" + strconv.Itoa(seq)
+	}
+	return suffix
+}
+
+// parseArchiveSuffix reverses archiveSuffix, without the leading dot.
+func parseArchiveSuffix(suffix string) (timestamp int64, seq int, err error) {
+	stamp, seqPart, found := strings.Cut(suffix, "-")
+	timestamp, err = strconv.ParseInt(stamp, 10, 64)
+	if err != nil || !found {
+		return timestamp, 0, err
+	}
+	seq, err = strconv.Atoi(seqPart)
+	if err == nil && seq <= 0 {
+		err = errors.New("invalid archive sequence: " + seqPart)
+	}
+	return timestamp, seq, err
+}
+
+// freeArchiveSuffix is the first archiveSuffix for timestamp that taken
+// reports as free, so an archived keypair is never overwritten.
+func freeArchiveSuffix(timestamp int64, taken func(suffix string) bool) string {
+	for seq := 0; ; seq++ {
+		if suffix := archiveSuffix(timestamp, seq); !taken(suffix) {
+			return suffix
+		}
+	}
+}
+
+// archiveFile makes a copy of p at archived, hard-linking it where the
+// filesystem allows. It fails rather than replace an existing archived.
+func archiveFile(p string, archived string) error {
+	err := os.Link(p, archived)
+	if err == nil || errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(archived, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(archived)
+	}
 	return err
 }
 
-func readFromStorage(targetDir string) (*ecdsa.PrivateKey, *ecdsa.PublicKey, error) {
+// writeFileAtomic replaces p with data through a synced temporary file and a
+// rename, so a reader, in this process or another, sees either the old or the
+// new contents in full.
+func writeFileAtomic(p string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(path.Dir(p), "."+path.Base(p)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, p)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+	}
+	return err
+}
+
+func (s *Store) readFromStorage(targetDir string) (*ecdsa.PrivateKey, *ecdsa.PublicKey, error) {
+	s.keypairMu.RLock()
+	defer s.keypairMu.RUnlock()
+	if KeypairInKeyring {
+		return s.readFromOsKeyring()
+	}
 	privatePath := path.Join(targetDir, privateFile)
 	if _, err := os.Stat(privatePath); os.IsNotExist(err) {
 		return nil, nil, errors.New("private key does not exist")
@@ -122,8 +239,8 @@ func readFromStorage(targetDir string) (*ecdsa.PrivateKey, *ecdsa.PublicKey, err
 	return privKey, pubKey, nil
 }
 
-func encryptMessage(message []byte, shared []byte) ([]byte, error) {
-	_, ecdsaPub, err := readFromStorage(KeyPath)
+func (s *Store) encryptMessage(message []byte, shared []byte) ([]byte, error) {
+	_, ecdsaPub, err := s.readFromStorage(s.keyDir())
 	if err != nil {
 		return nil, err
 	}
@@ -133,8 +250,8 @@ func encryptMessage(message []byte, shared []byte) ([]byte, error) {
 	return encrypted, err
 }
 
-func decryptMessage(encrypted []byte, shared []byte) ([]byte, error) {
-	ecdsaPriv, _, err := readFromStorage(KeyPath)
+func (s *Store) decryptMessage(encrypted []byte, shared []byte) ([]byte, error) {
+	ecdsaPriv, _, err := s.readFromStorage(s.keyDir())
 	if err != nil {
 		return nil, err
 	}
@@ -143,6 +260,96 @@ func decryptMessage(encrypted []byte, shared []byte) ([]byte, error) {
 	return decrypted, err
 }
 
+// keyringService is the OS keyring service s keeps its keypair under, for
+// KeypairInKeyring. It is named after the store path, so that stores don't
+// overwrite each other's keypair.
+func (s *Store) keyringService() string {
+	dir, err := filepath.Abs(s.storeDir())
+	if err != nil {
+		dir = s.storeDir()
+	}
+	return service + ":" + dir
+}
+
+// keyringGet reads item from s's keyring service. Keypairs kept before each
+// store had a service of its own are under the shared one, and are read from
+// there when s's has none.
+func (s *Store) keyringGet(item string) (string, error) {
+	value, err := keyring.Get(s.keyringService(), item)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return keyring.Get(service, item)
+	}
+	return value, err
+}
+
+// writeToOsKeyring is writeToStorage for KeypairInKeyring. An overwritten
+// keypair is kept under a timestamped name, like the files are.
+func (s *Store) writeToOsKeyring(privateKey []byte, publicKey []byte, overwrite bool) error {
+	storeService := s.keyringService()
+	oldPrivate, errPrivate := keyring.Get(storeService, privateFile)
+	oldPublic, errPublic := keyring.Get(storeService, publicFile)
+	if errPrivate == nil || errPublic == nil {
+		if !overwrite {
+			return errors.New("target keyring item(s) already exists")
+		}
+		suffix := freeArchiveSuffix(clock().Unix(), func(suffix string) bool {
+			_, errPrivate := keyring.Get(storeService, privateFile+suffix)
+			_, errPublic := keyring.Get(storeService, publicFile+suffix)
+			return errPrivate == nil || errPublic == nil
+		})
+		if errPrivate == nil {
+			if err := keyring.Set(storeService, privateFile+suffix, oldPrivate); err != nil {
+				return err
+			}
+		}
+		if errPublic == nil {
+			if err := keyring.Set(storeService, publicFile+suffix, oldPublic); err != nil {
+				return err
+			}
+		}
+	}
+	err := keyring.Set(storeService, privateFile, string(privateKey))
+	if err != nil {
+		return err
+	}
+	return keyring.Set(storeService, publicFile, string(publicKey))
+}
+
+func (s *Store) readFromOsKeyring() (*ecdsa.PrivateKey, *ecdsa.PublicKey, error) {
+	privateBytes, err := s.keyringGet(privateFile)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, nil, errors.New("private key does not exist")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	publicBytes, err := s.keyringGet(publicFile)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, nil, errors.New("public key does not exist")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	privKey, pubKey := decode([]byte(privateBytes), []byte(publicBytes))
+	return privKey, pubKey, nil
+}
+
+// privateKeyHash hashes the stored private key, wherever it is kept. The key
+// db's encryption key is derived from it.
+func (s *Store) privateKeyHash() (string, error) {
+	s.keypairMu.RLock()
+	defer s.keypairMu.RUnlock()
+	if !KeypairInKeyring {
+		return hashFile(path.Join(s.keyDir(), privateFile))
+	}
+	privateBytes, err := s.keyringGet(privateFile)
+	if err != nil {
+		return "", err
+	}
+	byteHash := sha256.Sum256([]byte(privateBytes))
+	return hex.EncodeToString(byteHash[:]), nil
+}
+
 func hashFile(path string) (string, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -151,7 +358,7 @@ func hashFile(path string) (string, error) {
 	defer func(file *os.File) {
 		err := file.Close()
 		if err != nil {
-			log.Printf("Error closing file: %v", err)
+			logger().Errorf("Error closing file: %v", err)
 		}
 	}(file)
 	hash := sha256.New()
@@ -177,3 +384,153 @@ func extractString(source string, intendedLength int) (string, error) {
 	}
 	return source[:intendedLength], nil
 }
+
+// ListArchivedKeypairs lists the keypairs kept in KeyPath from earlier
+// rotations, oldest first. The OS keyring can't be enumerated, so it fails
+// when KeypairInKeyring is set; RestoreKeypair still works there given the
+// timestamp.
+func (s *Store) ListArchivedKeypairs() ([]ArchivedKey, error) {
+	if KeypairInKeyring {
+		return nil, errors.New("archived keypairs can't be listed from the OS keyring")
+	}
+	s.keypairMu.RLock()
+	defer s.keypairMu.RUnlock()
+	entries, err := os.ReadDir(s.keyDir())
+	if err != nil {
+		return nil, err
+	}
+	archived := make([]ArchivedKey, 0)
+	for _, entry := range entries {
+		suffix, found := strings.CutPrefix(entry.Name(), privateFile+".")
+		if !found || entry.IsDir() {
+			continue
+		}
+		timestamp, seq, err := parseArchiveSuffix(suffix)
+		if err != nil {
+			continue
+		}
+		key := ArchivedKey{
+			Timestamp:   timestamp,
+			Seq:         seq,
+			PrivatePath: path.Join(s.keyDir(), entry.Name()),
+		}
+		publicPath := path.Join(s.keyDir(), publicFile+"."+suffix)
+		if _, err := os.Stat(publicPath); err == nil {
+			key.PublicPath = publicPath
+		}
+		archived = append(archived, key)
+	}
+	sort.Slice(archived, func(i, j int) bool {
+		if archived[i].Timestamp != archived[j].Timestamp {
+			return archived[i].Timestamp < archived[j].Timestamp
+		}
+		return archived[i].Seq < archived[j].Seq
+	})
+	return archived, nil
+}
+
+// ListArchivedKeypairs calls Store.ListArchivedKeypairs on the default store.
+func ListArchivedKeypairs() ([]ArchivedKey, error) {
+	return defaultStore.ListArchivedKeypairs()
+}
+
+// RestoreKeypair makes the keypair archived at timestamp the current one and
+// re-derives the key db's key from it. seq picks one of several keypairs
+// archived in the same second, see ArchivedKey.Seq; the first is the default.
+// The keypair it replaces is archived in turn, so a restore can be undone the
+// same way. When the key db exists the restored keypair must unlock it,
+// otherwise nothing is changed.
+func (s *Store) RestoreKeypair(timestamp int64, seq ...int) error {
+	n := 0
+	if len(seq) > 0 {
+		n = seq[0]
+	}
+	suffix := archiveSuffix(timestamp, n)
+	privateKey, publicKey, err := s.readArchivedKeypair(suffix)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return errors.New("archived private key is not PEM encoded")
+	}
+	private, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	if publicKey == nil {
+		// only the private key was archived, the public key follows from it
+		_, publicKey = encode(private, &private.PublicKey)
+	}
+	byteHash := sha256.Sum256(privateKey)
+	extractedKey, err := extractString(hex.EncodeToString(byteHash[:]), keyLength)
+	if err != nil {
+		return err
+	}
+	// the key db's shared handle has to make way for the check, and reopen
+	// with the restored key afterwards
+	gate := &s.keyHandle.gate
+	if err = gate.Lock(); err != nil {
+		return fmt.Errorf("%s - %w", s.keyHandle.name, err)
+	}
+	defer gate.Unlock()
+	if err = s.keyHandle.close(); err != nil {
+		return err
+	}
+	keyPath := path.Join(s.storeDir(), lockDb)
+	if _, err := os.Stat(keyPath); err == nil {
+		db, err := s.OpenDatabase(keyPath, []byte(extractedKey))
+		if err != nil {
+			return fmt.Errorf("archived keypair doesn't unlock the key db: %w", err)
+		}
+		if err = CloseDatabase(db); err != nil {
+			return err
+		}
+	}
+	if err = s.writeToStorage(privateKey, publicKey, s.keyDir(), true); err != nil {
+		return err
+	}
+	s.key.key = []byte(extractedKey)
+	_ = s.writeMetaEvent(EventTypeConfigChange, "restored keypair archived at "+strings.TrimPrefix(suffix, "."))
+	return nil
+}
+
+// RestoreKeypair calls Store.RestoreKeypair on the default store.
+func RestoreKeypair(timestamp int64, seq ...int) error {
+	return defaultStore.RestoreKeypair(timestamp, seq...)
+}
+
+// readArchivedKeypair reads the keypair archived under suffix. publicKey is
+// nil if only the private key was archived.
+func (s *Store) readArchivedKeypair(suffix string) (privateKey []byte, publicKey []byte, err error) {
+	s.keypairMu.RLock()
+	defer s.keypairMu.RUnlock()
+	if KeypairInKeyring {
+		private, err := s.keyringGet(privateFile + suffix)
+		if errors.Is(err, keyring.ErrNotFound) {
+			return nil, nil, errors.New("no keypair archived at that time")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		public, err := s.keyringGet(publicFile + suffix)
+		if err == nil {
+			publicKey = []byte(public)
+		} else if !errors.Is(err, keyring.ErrNotFound) {
+			return nil, nil, err
+		}
+		return []byte(private), publicKey, nil
+	}
+	privateKey, err = os.ReadFile(path.Join(s.keyDir(), privateFile+suffix))
+	if os.IsNotExist(err) {
+		return nil, nil, errors.New("no keypair archived at that time")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey, err = os.ReadFile(path.Join(s.keyDir(), publicFile+suffix))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	return privateKey, publicKey, nil
+}
@@ -5,9 +5,12 @@ import (
 	"math/rand"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/zalando/go-keyring"
 )
 
 var (
@@ -29,7 +32,7 @@ func TestGenKeypair(t *testing.T) {
 	defer cipherSetup()()
 	privatePath := path.Join(alternateDir, privateFile)
 	publicPath := path.Join(alternateDir, publicFile)
-	assert.Nil(t, genKeypair())
+	assert.Nil(t, defaultStore.genKeypair())
 	info, err := os.Stat(privatePath)
 	assert.Nil(t, err)
 	fMode := info.Mode()
@@ -44,21 +47,21 @@ func TestGenKeypairAlreadyExists(t *testing.T) {
 	defer cipherSetup()()
 	privatePath := path.Join(alternateDir, privateFile)
 	publicPath := path.Join(alternateDir, publicFile)
-	assert.Nil(t, genKeypair())
+	assert.Nil(t, defaultStore.genKeypair())
 	_, err := os.Stat(privatePath)
 	assert.Nil(t, err)
 	_, err = os.Stat(publicPath)
 	assert.Nil(t, err)
 	// second try - overwriting
-	assert.Nil(t, genKeypair())
+	assert.Nil(t, defaultStore.genKeypair())
 	files, err := os.ReadDir(alternateDir)
 	assert.Equal(t, 4, len(files))
 }
 
 func TestCheckPrivateAndPublicKeys(t *testing.T) {
 	defer cipherSetup()()
-	assert.Nil(t, genKeypair())
-	privateKey, publicKey, err := readFromStorage(alternateDir)
+	assert.Nil(t, defaultStore.genKeypair())
+	privateKey, publicKey, err := defaultStore.readFromStorage(alternateDir)
 	assert.Nil(t, err)
 	assert.NotNil(t, privateKey)
 	assert.NotNil(t, publicKey)
@@ -67,19 +70,19 @@ func TestCheckPrivateAndPublicKeys(t *testing.T) {
 
 func TestEncryptDecryptMessage(t *testing.T) {
 	defer cipherSetup()()
-	assert.Nil(t, genKeypair())
+	assert.Nil(t, defaultStore.genKeypair())
 	sharedValue := []byte("34534532|34t4645")
 	message := []byte("Hello,World! This is me!")
-	encrypted, err := encryptMessage(message, sharedValue)
+	encrypted, err := defaultStore.encryptMessage(message, sharedValue)
 	assert.Nil(t, err)
-	decrypted, err := decryptMessage(encrypted, sharedValue)
+	decrypted, err := defaultStore.decryptMessage(encrypted, sharedValue)
 	assert.Nil(t, err)
 	assert.Equal(t, message, decrypted)
 }
 
 func TestHashFile(t *testing.T) {
 	defer cipherSetup()()
-	assert.Nil(t, genKeypair())
+	assert.Nil(t, defaultStore.genKeypair())
 	privatePath := path.Join(alternateDir, privateFile)
 	publicPath := path.Join(alternateDir, publicFile)
 	hash, err := hashFile(privatePath)
@@ -130,3 +133,207 @@ func TestExtractString(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, cutTo32, extracted)
 }
+
+func TestKeypairInKeyring(t *testing.T) {
+	keyring.MockInit()
+	KeypairInKeyring = true
+	defer func() { KeypairInKeyring = false }()
+	teardown := setup()
+	defer teardown()
+	_, err := os.Stat(path.Join(KeyPath, privateFile))
+	assert.True(t, os.IsNotExist(err))
+	stored, err := keyring.Get(defaultStore.keyringService(), privateFile)
+	assert.Nil(t, err)
+	assert.Contains(t, stored, "PRIVATE KEY")
+
+	message := []byte("secret message")
+	encrypted, err := defaultStore.encryptMessage(message, nil)
+	assert.Nil(t, err)
+	decrypted, err := defaultStore.decryptMessage(encrypted, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, message, decrypted)
+
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, InsertEntry("testdb", "key", []byte("value")))
+	// the key db still opens from the keyring-held key after a restart
+	assert.Nil(t, Shutdown())
+	Startup()
+	value, err := GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	_, restore := fixClock(time.Unix(1700000000, 0))
+	defer restore()
+	assert.Nil(t, defaultStore.writeToStorage([]byte("private"), []byte("public"), KeyPath, true))
+	_, err = keyring.Get(defaultStore.keyringService(), privateFile+".1700000000")
+	assert.Nil(t, err)
+	assert.NotNil(t, defaultStore.writeToStorage([]byte("private"), []byte("public"), KeyPath))
+}
+
+func TestKeypairInKeyringPerStore(t *testing.T) {
+	keyring.MockInit()
+	KeypairInKeyring = true
+	defer func() { KeypairInKeyring = false }()
+	defer setup()()
+	dirs := []string{"./test-store-other/", "./.test-private-other/"}
+	defer func() {
+		for _, dir := range dirs {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+	other, err := NewStore(WithStorePath(dirs[0]), WithKeyPath(dirs[1]))
+	assert.Nil(t, err)
+	assert.NotEqual(t, defaultStore.keyringService(), other.keyringService())
+	first, err := defaultStore.privateKeyHash()
+	assert.Nil(t, err)
+	second, err := other.privateKeyHash()
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, second)
+
+	// both key dbs still open after the other store made its keypair
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, InsertEntry("testdb", "key", []byte("value")))
+	assert.Nil(t, other.CreateDatabase("testdb", true))
+	assert.Nil(t, Shutdown())
+	Startup()
+	value, err := GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	// erasing one store leaves the other's keypair alone
+	assert.Nil(t, other.SecureErase())
+	_, err = keyring.Get(other.keyringService(), privateFile)
+	assert.ErrorIs(t, err, keyring.ErrNotFound)
+	_, err = keyring.Get(defaultStore.keyringService(), privateFile)
+	assert.Nil(t, err)
+
+	// a keypair kept before stores had a service of their own is still read
+	stored, err := keyring.Get(defaultStore.keyringService(), privateFile)
+	assert.Nil(t, err)
+	assert.Nil(t, keyring.Set(service, privateFile, stored))
+	assert.Nil(t, keyring.Delete(defaultStore.keyringService(), privateFile))
+	hash, err := defaultStore.privateKeyHash()
+	assert.Nil(t, err)
+	assert.Equal(t, first, hash)
+}
+
+func TestKeypairReplacedAtomically(t *testing.T) {
+	defer cipherSetup()()
+	assert.Nil(t, defaultStore.genKeypair())
+	privatePath := path.Join(alternateDir, privateFile)
+	firstHash, err := hashFile(privatePath)
+	assert.Nil(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			assert.Nil(t, defaultStore.genKeypair())
+		}
+	}()
+	// key derivation never sees a missing or partial private key
+	hashes := map[string]bool{firstHash: true}
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		hash, err := defaultStore.privateKeyHash()
+		assert.Nil(t, err)
+		hashes[hash] = true
+	}
+	final, err := defaultStore.privateKeyHash()
+	assert.Nil(t, err)
+	assert.True(t, hashes[final])
+	// no temporary files are left next to the keypair
+	files, err := os.ReadDir(alternateDir)
+	assert.Nil(t, err)
+	for _, file := range files {
+		assert.False(t, strings.Contains(file.Name(), ".tmp-"), file.Name())
+	}
+}
+
+func TestRestoreKeypair(t *testing.T) {
+	defer setup()()
+	advance, restore := fixClock(time.Unix(1700000000, 0))
+	defer restore()
+	privatePath := path.Join(KeyPath, privateFile)
+	original, err := os.ReadFile(privatePath)
+	assert.Nil(t, err)
+	archived, err := ListArchivedKeypairs()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(archived))
+
+	// a stray regeneration leaves the key db locked under the old keypair
+	assert.Nil(t, defaultStore.genKeypair())
+	advance(time.Minute)
+	archived, err = ListArchivedKeypairs()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(archived))
+	assert.Equal(t, int64(1700000000), archived[0].Timestamp)
+	assert.NotEqual(t, "", archived[0].PublicPath)
+	regenerated, err := os.ReadFile(privatePath)
+	assert.Nil(t, err)
+
+	assert.NotNil(t, RestoreKeypair(1))
+	assert.Nil(t, RestoreKeypair(archived[0].Timestamp))
+	current, err := os.ReadFile(privatePath)
+	assert.Nil(t, err)
+	assert.Equal(t, original, current)
+	_, err = defaultStore.getFromKeyring(prefixMetaKey)
+	assert.Nil(t, err)
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, InsertEntry("testdb", "key", []byte("value")))
+
+	// the replaced keypair was archived, but it can't unlock the key db
+	archived, err = ListArchivedKeypairs()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(archived))
+	assert.Equal(t, int64(1700000060), archived[1].Timestamp)
+	assert.NotNil(t, RestoreKeypair(archived[1].Timestamp))
+	current, err = os.ReadFile(privatePath)
+	assert.Nil(t, err)
+	assert.Equal(t, original, current)
+	stray, err := os.ReadFile(archived[1].PrivatePath)
+	assert.Nil(t, err)
+	assert.Equal(t, regenerated, stray)
+}
+
+func TestArchivedKeypairsInOneSecond(t *testing.T) {
+	defer setup()()
+	_, restore := fixClock(time.Unix(1700000000, 0))
+	defer restore()
+	privatePath := path.Join(KeyPath, privateFile)
+	original, err := os.ReadFile(privatePath)
+	assert.Nil(t, err)
+
+	// rotations in the same second each keep the keypair they replace
+	assert.Nil(t, defaultStore.genKeypair())
+	second, err := os.ReadFile(privatePath)
+	assert.Nil(t, err)
+	assert.Nil(t, defaultStore.genKeypair())
+	archived, err := ListArchivedKeypairs()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(archived))
+	for i, expected := range [][]byte{original, second} {
+		assert.Equal(t, int64(1700000000), archived[i].Timestamp)
+		assert.Equal(t, i, archived[i].Seq)
+		assert.NotEqual(t, "", archived[i].PublicPath)
+		stored, err := os.ReadFile(archived[i].PrivatePath)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, stored)
+	}
+	assert.Nil(t, RestoreKeypair(archived[0].Timestamp, archived[0].Seq))
+	current, err := os.ReadFile(privatePath)
+	assert.Nil(t, err)
+	assert.Equal(t, original, current)
+	_, err = defaultStore.getFromKeyring(prefixMetaKey)
+	assert.Nil(t, err)
+
+	_, seq, err := parseArchiveSuffix("1700000000-2")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, seq)
+	_, _, err = parseArchiveSuffix("1700000000-0")
+	assert.NotNil(t, err)
+}
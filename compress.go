@@ -0,0 +1,71 @@
+package cachekv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// encodingCompressed is the envelope flag of gzip-compressed values, see
+// Config.CompressValues.
+const encodingCompressed byte = 1 << 0
+
+// DefaultCompressionThreshold is the size in bytes values have to be over to
+// be compressed when Config.CompressionThreshold is zero.
+const DefaultCompressionThreshold = 1024
+
+func compressValue(value []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(value); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompressValue(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// valueEncoding is how a write encodes its values: with the envelope flags,
+// except compression for values of compressAbove bytes or less, which gzip
+// would barely shrink, if at all.
+type valueEncoding struct {
+	flags         byte
+	compressAbove int
+}
+
+// flagsFor returns the envelope flags value is written with.
+func (e valueEncoding) flagsFor(value []byte) byte {
+	if e.flags&encodingCompressed != 0 && len(value) <= e.compressAbove {
+		return e.flags &^ encodingCompressed
+	}
+	return e.flags
+}
+
+// writeEncoding is how writes to the database dbObject describes encode
+// values: with its Encoding, and compressed when the store's config says so.
+// Reads don't depend on it, each value's envelope says how to decode it, so
+// turning compression on or off leaves existing values readable.
+func (s *Store) writeEncoding(dbObject *DbObject) valueEncoding {
+	enc := valueEncoding{flags: dbObject.Encoding}
+	if config := s.config; config != nil && config.CompressValues {
+		enc.flags |= encodingCompressed
+		enc.compressAbove = config.CompressionThreshold
+		if enc.compressAbove == 0 {
+			enc.compressAbove = DefaultCompressionThreshold
+		}
+	}
+	return enc
+}
@@ -0,0 +1,86 @@
+package cachekv
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// storedValue reads key's bytes as badger holds them, envelope included.
+func storedValue(t *testing.T, dbName, key string) ([]byte, byte) {
+	storage, err := OpenStorage(dbName)
+	assert.Nil(t, err)
+	defer storage.Close()
+	var data []byte
+	var userMeta byte
+	assert.Nil(t, storage.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		userMeta = item.UserMeta()
+		data, err = item.ValueCopy(nil)
+		return err
+	}))
+	return data, userMeta
+}
+
+func TestCompressValues(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	cfg, err := ListConfigurations()
+	assert.Nil(t, err)
+	cfg.CompressValues = true
+	assert.Nil(t, UpdateConfigurations(cfg))
+
+	payload := bytes.Repeat([]byte(`{"name":"cachekv","tags":["a","b","c"],"count":12345},`), 2000)
+	assert.Nil(t, InsertEntry("testdb", "big", payload))
+	small := []byte(`{"name":"cachekv"}`)
+	assert.Nil(t, InsertEntry("testdb", "small", small))
+
+	data, userMeta := storedValue(t, "testdb", "big")
+	assert.Equal(t, userMetaEnvelope, userMeta)
+	assert.Equal(t, encodingCompressed, data[1])
+	assert.Less(t, len(data), len(payload)/10)
+	data, userMeta = storedValue(t, "testdb", "small")
+	assert.Equal(t, byte(0), userMeta)
+	assert.Equal(t, small, data)
+
+	value, err := GetEntry("testdb", "big")
+	assert.Nil(t, err)
+	assert.Equal(t, payload, value)
+	value, err = GetEntry("testdb", "small")
+	assert.Nil(t, err)
+	assert.Equal(t, small, value)
+
+	// compressed values stay readable with compression turned off
+	cfg.CompressValues = false
+	assert.Nil(t, UpdateConfigurations(cfg))
+	value, err = GetEntry("testdb", "big")
+	assert.Nil(t, err)
+	assert.Equal(t, payload, value)
+	assert.Nil(t, InsertEntry("testdb", "big2", payload))
+	data, _ = storedValue(t, "testdb", "big2")
+	assert.Equal(t, payload, data)
+}
+
+func TestStorageAllCompressed(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	cfg, err := ListConfigurations()
+	assert.Nil(t, err)
+	cfg.CompressValues = true
+	assert.Nil(t, UpdateConfigurations(cfg))
+	payload := bytes.Repeat([]byte("compressible "), 1000)
+	assert.Nil(t, InsertEntry("testdb", "big", payload))
+	assert.Nil(t, InsertEntry("testdb", "small", []byte("small")))
+
+	storage, err := OpenStorage("testdb")
+	assert.Nil(t, err)
+	defer storage.Close()
+	all, err := storage.All()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"big": payload, "small": []byte("small")}, all)
+}
@@ -0,0 +1,63 @@
+package cachekv
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancelledContext(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := GetEntryContext(ctx, testDb, "key")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, InsertEntryContext(ctx, testDb, "key2", []byte("value2")), context.Canceled)
+	assert.ErrorIs(t, RemoveEntryContext(ctx, testDb, "key"), context.Canceled)
+	entries := make(map[string][]byte)
+	for i := range 10 {
+		entries["batch"+strconv.Itoa(i)] = []byte("value")
+	}
+	assert.ErrorIs(t, BatchInsertContext(ctx, testDb, entries), context.Canceled)
+	_, err = ListDatabasesContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	// nothing was changed
+	found, err := Exists(testDb, "key2")
+	assert.Nil(t, err)
+	assert.False(t, found)
+	found, err = Exists(testDb, "batch0")
+	assert.Nil(t, err)
+	assert.False(t, found)
+	value, err := GetEntryContext(context.Background(), testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+}
+
+func TestScanPrefixContextStops(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	entries := make(map[string][]byte)
+	for i := range 100 {
+		entries["key"+strconv.Itoa(i)] = []byte("value")
+	}
+	assert.Nil(t, BatchInsert(testDb, entries))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	visited := 0
+	err := ScanPrefixContext(ctx, testDb, "key", func(key string, value []byte) error {
+		visited++
+		if visited == 3 {
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 3, visited)
+}
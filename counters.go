@@ -0,0 +1,156 @@
+package cachekv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// defaultCounterMergeInterval is how often Counters folds the increments
+// written for a counter into a single value when OpenCounters gets 0.
+const defaultCounterMergeInterval = time.Second
+
+// Counters keeps hot int64 counters in a database through badger's merge
+// operator: Add appends the delta without reading the current value, and the
+// deltas are folded together in the background. Counter values are kept as
+// 8-byte big-endian integers, outside the value envelope, so the database
+// should hold nothing but counters.
+//
+// Counters holds its database like a running operation until Close;
+// CloseDatabaseByName, key rotation and Shutdown wait for it, up to
+// DrainTimeout, see OpenStorage.
+type Counters struct {
+	dbName   string
+	db       *badger.DB
+	interval time.Duration
+
+	mu     sync.Mutex
+	ops    map[string]*badger.MergeOperator
+	closed bool
+	store  *Store
+}
+
+// OpenCounters opens the counters kept in dbName, which must exist and be
+// writable. mergeInterval is how often pending increments are folded into
+// one value; 0 uses a second. Call Close when done.
+func (s *Store) OpenCounters(dbName string, mergeInterval time.Duration) (*Counters, error) {
+	if mergeInterval < 0 {
+		return nil, errors.New("merge interval must not be negative")
+	}
+	if mergeInterval == 0 {
+		mergeInterval = defaultCounterMergeInterval
+	}
+	db, _, err := s.openWritableDbByName(dbName)
+	if err != nil {
+		return nil, err
+	}
+	return &Counters{
+		store:    s,
+		dbName:   dbName,
+		db:       db,
+		interval: mergeInterval,
+		ops:      make(map[string]*badger.MergeOperator),
+	}, nil
+}
+
+// OpenCounters calls Store.OpenCounters on the default store.
+func OpenCounters(dbName string, mergeInterval time.Duration) (*Counters, error) {
+	return defaultStore.OpenCounters(dbName, mergeInterval)
+}
+
+func addCounterValues(existing, delta []byte) []byte {
+	return counterBytes(counterValue(existing) + counterValue(delta))
+}
+
+func counterBytes(n int64) []byte {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(n))
+	return value
+}
+
+func counterValue(value []byte) int64 {
+	if len(value) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(value))
+}
+
+// operator returns the merge operator for name, starting it on first use.
+// c.mu must be held.
+func (c *Counters) operator(name string) (*badger.MergeOperator, error) {
+	if c.closed {
+		return nil, fmt.Errorf("%s - counters are closed", c.dbName)
+	}
+	if name == "" {
+		return nil, errors.New("counter name must not be empty")
+	}
+	op, ok := c.ops[name]
+	if !ok {
+		op = c.db.GetMergeOperator([]byte(name), addCounterValues, c.interval)
+		c.ops[name] = op
+	}
+	return op, nil
+}
+
+// Add adds delta, which may be negative, to the named counter.
+func (c *Counters) Add(name string, delta int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	op, err := c.operator(name)
+	if err != nil {
+		return err
+	}
+	return op.Add(counterBytes(delta))
+}
+
+// Get returns the named counter's current value, 0 if it was never added to.
+func (c *Counters) Get(name string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	op, err := c.operator(name)
+	if err != nil {
+		return 0, err
+	}
+	value, err := op.Get()
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return counterValue(value), nil
+}
+
+// Reset sets the named counter back to 0.
+func (c *Counters) Reset(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.operator(name); err != nil {
+		return err
+	}
+	c.ops[name].Stop()
+	delete(c.ops, name)
+	return c.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(name))
+	})
+}
+
+// Close stops the background merges and closes the database. Increments
+// already added stay in the database and are folded on the next Get.
+func (c *Counters) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	for name, op := range c.ops {
+		op.Stop()
+		delete(c.ops, name)
+	}
+	return c.store.releaseDb(c.dbName, c.db)
+}
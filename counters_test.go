@@ -0,0 +1,63 @@
+package cachekv
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounters(t *testing.T) {
+	defer setup()()
+	testDb := "counters"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	counters, err := OpenCounters(testDb, 0)
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				assert.Nil(t, counters.Add("hits", 1))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Nil(t, counters.Add("hits", -500))
+	n, err := counters.Get("hits")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(500), n)
+	n, err = counters.Get("never")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	assert.Nil(t, counters.Reset("hits"))
+	n, err = counters.Get("hits")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	assert.Nil(t, counters.Add("hits", 7))
+	assert.Nil(t, counters.Close())
+	assert.Nil(t, counters.Close())
+	assert.NotNil(t, counters.Add("hits", 1))
+
+	// increments survive reopening
+	counters, err = OpenCounters(testDb, 0)
+	assert.Nil(t, err)
+	n, err = counters.Get("hits")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), n)
+	assert.Nil(t, counters.Close())
+}
+
+func TestCountersReadOnly(t *testing.T) {
+	defer setup()()
+	testDb := "counters"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, SetReadOnly(testDb, true))
+	_, err := OpenCounters(testDb, 0)
+	assert.ErrorIs(t, err, ErrDbReadOnly)
+	_, err = OpenCounters("missing", 0)
+	assert.NotNil(t, err)
+}
@@ -4,19 +4,24 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"math"
 	"math/big"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/options"
 	"github.com/dgraph-io/badger/v4/pb"
 	"github.com/dgraph-io/ristretto/v2/z"
 	"google.golang.org/protobuf/proto"
@@ -24,11 +29,11 @@ import (
 
 // meta db stores the list of databases we have, etc.
 var (
-	StorePath   = "./store/"
-	KeyPath     = "./.private"
-	metaStorage Storage
-	keyStorage  Storage
-	fxConfig    *Config
+	StorePath = "./store/"
+	KeyPath   = "./.private"
+	// clock stamps events and DbObject times; tests swap it for a fixed one.
+	// Entry TTLs are kept by badger against the real time.
+	clock = time.Now
 )
 
 const (
@@ -38,86 +43,126 @@ const (
 	service      = "fxstorage"
 )
 
-func Startup() {
-	_, err := os.Stat(StorePath)
-	if err != nil && os.IsNotExist(err) {
+// Startup creates or loads the store at its store path. It is safe to call from
+// several goroutines and more than once: only the first call does the work,
+// later ones return once it's done and leave the loaded store as it is. Call
+// Shutdown before Startup to load the store again. A Startup that fails
+// leaves the store unloaded, and can be tried again.
+func (s *Store) Startup() error {
+	s.startupMu.Lock()
+	defer s.startupMu.Unlock()
+	if s.started {
+		return nil
+	}
+	_, err := os.Stat(s.storeDir())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error checking store dir: %w", err)
+	}
+	if err != nil {
 		syscall.Umask(0)
-		err = os.MkdirAll(StorePath, 0744)
+		err = os.MkdirAll(s.storeDir(), 0744)
 		if err != nil {
-			log.Fatal("error creating store dir: ", err)
-			return
+			return fmt.Errorf("error creating store dir: %w", err)
 		}
-		err = initKeyDb()
+		if err = s.checkStoreFilesystem(); err != nil {
+			return err
+		}
+		err = s.initKeyDb()
 		if err != nil {
-			log.Fatal("error initializing keydb: ", err)
-			return
+			return fmt.Errorf("error initializing keydb: %w", err)
 		}
-		err = initMetaDb()
+		err = s.initMetaDb()
 		if err != nil {
-			log.Fatal("error initializing meta db: ", err)
-			return
+			return fmt.Errorf("error initializing meta db: %w", err)
 		}
 	} else {
+		if err = s.checkStoreFilesystem(); err != nil {
+			return err
+		}
 		// load up the key db
-		err = openKeyDb()
+		err = s.openKeyDb()
 		if err != nil {
-			log.Fatal("error opening keydb: ", err)
-			return
+			return fmt.Errorf("error opening keydb: %w", err)
 		}
 		// load up the saved metafile
-		err = openMetaDb()
+		err = s.openMetaDb()
 		if err != nil {
-			log.Fatal("error opening meta db: ", err)
-			return
+			return fmt.Errorf("error opening meta db: %w", err)
 		}
 	}
+	s.started = true
+	if config, err := s.CurrentConfig(); err == nil {
+		s.startIntegrityChecks(config.IntegrityCheckInterval)
+	}
+	return nil
 }
 
-func DefaultConfig() *Config {
+// Startup calls Store.Startup on the default store.
+func Startup() error {
+	return defaultStore.Startup()
+}
+
+// MustStartup is Startup for callers that can't run without the store: it
+// panics if Startup fails.
+func MustStartup() {
+	if err := Startup(); err != nil {
+		panic(err)
+	}
+}
+
+// Shutdown flushes anything the package still holds in memory, such as
+// buffered events, and closes the database handles kept open between
+// operations, before the process exits. It first waits for running write
+// batches, up to ShutdownTimeout, and then for the operations using each
+// handle, up to DrainTimeout: a handle still in use by then, by a Storage or
+// Reader left open for example, is left open and reported as ErrDbBusy. A
+// later Startup loads the store again.
+func (s *Store) Shutdown() error {
+	s.stopIntegrityChecks()
+	s.drainBatches(ShutdownTimeout)
+	err := errors.Join(s.FlushEvents(), s.closeAllDbs(), s.closeInternalDbs())
+	s.startupMu.Lock()
+	s.started = false
+	s.startupMu.Unlock()
+	return err
+}
+
+// Shutdown calls Store.Shutdown on the default store.
+func Shutdown() error {
+	return defaultStore.Shutdown()
+}
+
+func (s *Store) DefaultConfig() *Config {
 	return &Config{
-		StorePath:   StorePath,
+		StorePath:   s.storeDir(),
 		SecureNewDb: true,
-		MetaStore:   StorePath,
-		MetaFile:    metaStorage.file,
+		MetaStore:   s.storeDir(),
+		MetaFile:    s.meta.file,
 	}
 }
 
-func writeMetaEntry(key string, value []byte) error {
-	if metaStorage.rotatingKey {
-		return errors.New(errDbRotating)
-	}
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
-	db, err := OpenDatabase(metaPath, metaStorage.key)
+// DefaultConfig calls Store.DefaultConfig on the default store.
+func DefaultConfig() *Config {
+	return defaultStore.DefaultConfig()
+}
+
+func (s *Store) writeMetaEntry(key string, value []byte) error {
+	db, err := s.openMeta()
 	if err != nil {
 		return err
 	}
-	defer func(db *badger.DB) {
-		err = db.Close()
-		if err != nil {
-			log.Println("Error closing meta db: ", err)
-		}
-	}(db)
-	err = setDbEntry([]byte(key), value, db)
-	return err
+	defer s.releaseMeta()
+	return setDbEntry([]byte(key), value, db)
 }
 
-func getMetaEntry(key string) ([]byte, error) {
-	if metaStorage.rotatingKey {
-		return nil, errors.New(errDbRotating)
-	}
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
-	db, err := OpenDatabase(metaPath, metaStorage.key)
+func (s *Store) getMetaEntry(key string) ([]byte, error) {
+	db, err := s.openMeta()
 	if err != nil {
 		return nil, err
 	}
-	defer func(db *badger.DB) {
-		err = db.Close()
-		if err != nil {
-			log.Println("Error closing meta db: ", err)
-		}
-	}(db)
+	defer s.releaseMeta()
 
-	value := make([]byte, 0)
+	var value []byte
 	err = db.View(func(txn *badger.Txn) error {
 		item, e := txn.Get([]byte(key))
 		if e != nil {
@@ -130,75 +175,105 @@ func getMetaEntry(key string) ([]byte, error) {
 			}
 			return e
 		}
-		e = item.Value(func(val []byte) error {
-			value = val
-			return nil
-		})
+		// the value is only valid inside the transaction
+		value, e = item.ValueCopy(nil)
 		return e
 	})
-	return value, err
+	if err == nil && len(value) == 0 {
+		// no entry read this way is legitimately empty; report it as missing
+		// rather than leave callers to fail unmarshalling it
+		err = &EMetaKeyNotFound{
+			Code:    8404,
+			Message: "empty meta entry: " + key,
+			Wrapped: badger.ErrKeyNotFound,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (s *Store) writeMetaEvent(eventType EventType, comment string) error {
+	return s.writeDbEvent(eventType, "", comment)
 }
 
-func writeMetaEvent(eventType EventType, comment string) error {
-	now := time.Now().UnixMilli()
+// writeDbEvent records an event about dbName, see ListEventsForDatabase.
+func (s *Store) writeDbEvent(eventType EventType, dbName string, comment string) error {
+	now := clock().UnixMilli()
 	event := Event{
 		Type:    eventType,
 		Comment: comment,
 		TSTamp:  now,
+		DbName:  dbName,
 	}
-	key := prefixMetaEvent + strconv.FormatInt(now, 10)
+	key := eventKey(now, s.eventSeq.Add(1))
 	value, err := json.Marshal(event)
 	if err != nil {
 		return err
 	}
-	return writeMetaEntry(key, value)
+	if buffered, err := s.bufferEvent(key, value); buffered {
+		return err
+	}
+	return s.writeMetaEntry(key, value)
 }
 
-func WriteMetaConfig(config *Config) error {
+func (s *Store) WriteMetaConfig(config *Config) error {
 	value, err := json.Marshal(config)
 	if err != nil {
 		return err
 	}
-	err = writeMetaEntry(prefixMetaConfig, value)
+	err = s.writeMetaEntry(prefixMetaConfig, value)
 	if err != nil {
 		return err
 	}
-	err = writeMetaEvent(EventTypeConfigChange, "Updating config")
+	err = s.writeMetaEvent(EventTypeConfigChange, "Updating config")
 	return err
 }
 
-func getMetaConfig() (*Config, error) {
-	entry, err := getMetaEntry(prefixMetaConfig)
+// WriteMetaConfig calls Store.WriteMetaConfig on the default store.
+func WriteMetaConfig(config *Config) error {
+	return defaultStore.WriteMetaConfig(config)
+}
+
+func (s *Store) getMetaConfig() (*Config, error) {
+	entry, err := s.getMetaEntry(prefixMetaConfig)
 	if err != nil {
 		return nil, err
 	}
-	config := &Config{}
-	err = json.Unmarshal(entry, config)
-	if err != nil {
+	return s.decodeConfig(entry)
+}
+
+// decodeConfig reads a stored Config over DefaultConfig, so fields missing
+// from a config written before they were added keep their defaults rather
+// than coming back zero. Fields that were stored, zero or not, are kept.
+func (s *Store) decodeConfig(entry []byte) (*Config, error) {
+	config := s.DefaultConfig()
+	if err := json.Unmarshal(entry, config); err != nil {
 		return nil, err
 	}
-	return config, err
+	return config, nil
 }
 
-func writeMetaDbObject(dbName string, dbObject *DbObject, isUpdate bool) error {
+func (s *Store) writeMetaDbObject(dbName string, dbObject *DbObject, isUpdate bool) error {
 	jsonDb, err := json.Marshal(dbObject)
 	if err != nil {
 		return err
 	}
-	err = writeMetaEntry(prefixMetaDb+dbName, jsonDb)
+	err = s.writeMetaEntry(prefixMetaDb+dbName, jsonDb)
 	if err != nil {
 		return err
 	}
 	if isUpdate {
-		err = writeMetaEvent(EventTypeUpdate, "Updated db object: "+dbName)
+		err = s.writeDbEvent(EventTypeUpdate, dbName, "Updated db object: "+dbName)
 	} else {
-		err = writeMetaEvent(EventTypeCreate, "Created db object: "+dbName)
+		err = s.writeDbEvent(EventTypeCreate, dbName, "Created db object: "+dbName)
 	}
 	return err
 }
 
-func getMetaDbObject(dbName string) (*DbObject, error) {
-	entry, err := getMetaEntry(prefixMetaDb + dbName)
+func (s *Store) getMetaDbObject(dbName string) (*DbObject, error) {
+	entry, err := s.getMetaEntry(prefixMetaDb + dbName)
 	if err != nil {
 		return nil, err
 	}
@@ -207,44 +282,45 @@ func getMetaDbObject(dbName string) (*DbObject, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = writeMetaEvent(EventTypeRead, "Read meta db object: "+prefixMetaDb+dbName)
+	err = s.writeDbEvent(EventTypeRead, dbName, "Read meta db object: "+prefixMetaDb+dbName)
 	return dbo, err
 }
 
+func (s *Store) WriteToKeyring(key string, value []byte) error {
+	return s.writeKeyringEntry(badger.NewEntry([]byte(key), value))
+}
+
+// WriteToKeyring calls Store.WriteToKeyring on the default store.
 func WriteToKeyring(key string, value []byte) error {
-	if keyStorage.rotatingKey {
-		return errors.New(errDbRotating)
-	}
-	keyPath := path.Join(keyStorage.path, keyStorage.file)
-	db, err := OpenDatabase(keyPath, keyStorage.key)
+	return defaultStore.WriteToKeyring(key, value)
+}
+
+func (s *Store) writeKeyringEntry(entry *badger.Entry) error {
+	db, err := s.openKeyring()
 	if err != nil {
 		return err
 	}
-	defer func(db *badger.DB) {
-		err := db.Close()
-		if err != nil {
-			log.Println("Error closing key db: ", err)
-		}
-	}(db)
-	err = setDbEntry([]byte(key), value, db)
-	return err
+	defer s.releaseKeyring()
+	return setDbValueEntry(entry, db)
 }
 
-func getFromKeyring(key string) ([]byte, error) {
-	if keyStorage.rotatingKey {
-		return nil, errors.New(errDbRotating)
+func (s *Store) removeFromKeyring(key string) error {
+	db, err := s.openKeyring()
+	if err != nil {
+		return err
 	}
-	keyPath := path.Join(keyStorage.path, keyStorage.file)
-	db, err := OpenDatabase(keyPath, keyStorage.key)
+	defer s.releaseKeyring()
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	})
+}
+
+func (s *Store) getFromKeyring(key string) ([]byte, error) {
+	db, err := s.openKeyring()
 	if err != nil {
 		return nil, err
 	}
-	defer func(db *badger.DB) {
-		err := db.Close()
-		if err != nil {
-			log.Println("Error closing key db: ", err)
-		}
-	}(db)
+	defer s.releaseKeyring()
 
 	value := make([]byte, 0)
 	err = db.View(func(txn *badger.Txn) error {
@@ -252,15 +328,69 @@ func getFromKeyring(key string) ([]byte, error) {
 		if e != nil {
 			return e
 		}
-		e = item.Value(func(val []byte) error {
-			value = val
-			return nil
-		})
+		// val is only valid inside the transaction
+		value, e = item.ValueCopy(nil)
 		return e
 	})
 	return value, err
 }
 
+// ListKeyringEntries returns the names of the entries in the keyring, in
+// key order, without reading their values.
+func (s *Store) ListKeyringEntries() ([]string, error) {
+	db, err := s.openKeyring()
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseKeyring()
+	names := make([]string, 0)
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			names = append(names, string(it.Item().Key()))
+		}
+		return nil
+	})
+	return names, err
+}
+
+// ListKeyringEntries calls Store.ListKeyringEntries on the default store.
+func ListKeyringEntries() ([]string, error) {
+	return defaultStore.ListKeyringEntries()
+}
+
+// KeyringRetries is how many more times reading a database's key from the
+// keyring is tried after a failure, KeyringRetryBackoff apart and doubling
+// each time, before the open fails with ErrKeyringUnavailable. A key that
+// isn't there isn't retried.
+var (
+	KeyringRetries      = 3
+	KeyringRetryBackoff = 50 * time.Millisecond
+)
+
+// keyringSleep waits between keyring retries; tests replace it.
+var keyringSleep = time.Sleep
+
+// getDbKeyFromKeyring reads dbName's stored key, riding out transient
+// keyring failures such as the key db being rotated.
+func (s *Store) getDbKeyFromKeyring(dbName string) ([]byte, error) {
+	backoff := KeyringRetryBackoff
+	for attempt := 0; ; attempt++ {
+		key, err := s.getFromKeyring(prefixMetaDb + dbName)
+		if err == nil || errors.Is(err, badger.ErrKeyNotFound) {
+			return key, err
+		}
+		if attempt >= KeyringRetries {
+			return nil, fmt.Errorf("%s - %w after %d attempts: %w", dbName, ErrKeyringUnavailable, attempt+1, err)
+		}
+		keyringSleep(backoff)
+		backoff *= 2
+	}
+}
+
 func randomValues(length int) ([]byte, error) {
 	var alphaNum = []rune("abcdefghijklmnopqrstuvwxyz0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ")
 	randoms := make([]rune, length)
@@ -273,36 +403,35 @@ func randomValues(length int) ([]byte, error) {
 	return dst, nil
 }
 
-func checkMetaFile() bool {
-	if metaStorage.path == "" || metaStorage.file == "" {
+func (s *Store) checkMetaFile() bool {
+	if s.meta.path == "" || s.meta.file == "" {
 		return false
 	}
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
+	metaPath := path.Join(s.meta.path, s.meta.file)
 	if _, err := os.Stat(metaPath); os.IsNotExist(err) {
 		return false
 	}
 	return true
 }
 
-func checkConfig() bool {
-	if fxConfig == nil {
+func (s *Store) checkConfig() bool {
+	if s.config == nil {
 		return false
 	}
-	if fxConfig.StorePath != StorePath {
+	if s.config.StorePath != s.storeDir() {
 		return false
 	}
 	return true
 }
 
-func initKeyDb() error {
-	keyStorage.path = StorePath
-	keyStorage.file = lockDb
-	err := genKeypair()
+func (s *Store) initKeyDb() error {
+	s.key.path = s.storeDir()
+	s.key.file = lockDb
+	err := s.genKeypair()
 	if err != nil {
 		return err
 	}
-	privatePath := path.Join(KeyPath, privateFile)
-	hash, err := hashFile(privatePath)
+	hash, err := s.privateKeyHash()
 	if err != nil {
 		return err
 	}
@@ -310,67 +439,69 @@ func initKeyDb() error {
 	if err != nil {
 		return err
 	}
-	keyStorage.key = []byte(extractedKey)
-	keyPath := path.Join(keyStorage.path, keyStorage.file)
-	keyStorage.db, err = OpenDatabase(keyPath, keyStorage.key)
+	s.key.key = []byte(extractedKey)
+	keyPath := path.Join(s.key.path, s.key.file)
+	s.key.db, err = s.OpenDatabase(keyPath, s.key.key)
 	if err != nil {
 		return err
 	}
-	err = CloseDatabase(keyStorage.db)
+	err = CloseDatabase(s.key.db)
 	return err
 }
 
-func initMetaDb() error {
+func (s *Store) initMetaDb() error {
 	fileKey, fErr := randomValues(fileKey)
 	if fErr != nil {
-		log.Println("Error generating random values:", fErr)
+		logger().Errorf("Error generating random values: %v", fErr)
 		return fErr
 	}
-	metaStorage.path = StorePath
-	metaStorage.file = "meta-" + string(fileKey)
-	metaStorage.key, fErr = randomValues(keyLength)
+	s.meta.path = s.storeDir()
+	s.meta.file = "meta-" + string(fileKey)
+	s.meta.key, fErr = randomValues(keyLength)
 	if fErr != nil {
-		log.Println("Error generating random values:", fErr)
+		logger().Errorf("Error generating random values: %v", fErr)
 		return fErr
 	}
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
+	metaPath := path.Join(s.meta.path, s.meta.file)
 	var err error
-	metaStorage.db, err = OpenDatabase(metaPath, metaStorage.key)
+	s.meta.db, err = s.OpenDatabase(metaPath, s.meta.key)
 	if err != nil {
 		return err
 	}
-	fErr = WriteToKeyring(prefixMetaKey, metaStorage.key)
+	fErr = s.WriteToKeyring(prefixMetaKey, s.meta.key)
 	if fErr != nil {
-		log.Println("Error saving key file to keyring:", fErr)
+		logger().Errorf("Error saving key file to keyring: %v", fErr)
 	}
-	err = CloseDatabase(metaStorage.db)
+	err = CloseDatabase(s.meta.db)
 	if err != nil {
 		return err
 	}
-	_ = writeMetaEvent(EventTypeWrite, "wrote keyring")
-	fxConfig = DefaultConfig()
-	err = WriteMetaConfig(fxConfig)
+	_ = s.writeMetaEvent(EventTypeWrite, "wrote keyring")
+	s.config = s.DefaultConfig()
+	err = s.WriteMetaConfig(s.config)
 
 	return err
 }
 
-func openKeyDb() error {
-	keyStorage.path = StorePath
-	keyStorage.file = lockDb
-	keyPath := path.Join(keyStorage.path, keyStorage.file)
+func (s *Store) openKeyDb() error {
+	s.key.path = s.storeDir()
+	s.key.file = lockDb
+	keyPath := path.Join(s.key.path, s.key.file)
 	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
 		// I'm not finding the key db, init one
-		err = initKeyDb()
+		err = s.initKeyDb()
 		if err != nil {
-			log.Println("Error opening/initialising key db: ", err)
+			logger().Errorf("Error opening/initialising key db: %v", err)
 			return err
 		}
 	}
-	privatePath := path.Join(KeyPath, privateFile)
-	if _, err := os.Stat(privatePath); os.IsNotExist(err) {
-		return err
+	if !KeypairInKeyring {
+		privatePath := path.Join(s.keyDir(), privateFile)
+		if _, err := os.Stat(privatePath); os.IsNotExist(err) {
+			return err
+		}
 	}
-	hash, err := hashFile(privatePath)
+	hash, err := s.privateKeyHash()
 	if err != nil {
 		return err
 	}
@@ -378,22 +509,22 @@ func openKeyDb() error {
 	if err != nil {
 		return err
 	}
-	keyStorage.key = []byte(extractedKey)
+	s.key.key = []byte(extractedKey)
 	return nil
 }
 
-func openMetaDb() error {
+func (s *Store) openMetaDb() error {
 	var latestMetaName string
 	var latestMetaTimestamp int64 = 0
-	entries, err := os.ReadDir(StorePath)
+	entries, err := os.ReadDir(s.storeDir())
 	if err != nil {
-		log.Println("error reading store dir: ", err)
+		logger().Errorf("error reading store dir: %v", err)
 		return err
 	}
 	if len(entries) == 0 {
-		err = initMetaDb()
+		err = s.initMetaDb()
 		if err != nil {
-			log.Println("Error opening/initialising meta db: ", err)
+			logger().Errorf("Error opening/initialising meta db: %v", err)
 			return err
 		}
 	}
@@ -401,7 +532,7 @@ func openMetaDb() error {
 		if entry.IsDir() && strings.HasPrefix(entry.Name(), "meta-") {
 			fInfo, e := entry.Info()
 			if e != nil {
-				log.Println("error reading file info: ", e)
+				logger().Errorf("error reading file info: %v", e)
 				continue
 			}
 			fileTstamp := fInfo.ModTime().UnixMilli()
@@ -412,83 +543,255 @@ func openMetaDb() error {
 		}
 	}
 	if latestMetaTimestamp > 0 {
-		metaStorage.path = StorePath
-		metaStorage.file = latestMetaName
-		key, e := getFromKeyring(prefixMetaKey)
+		s.meta.path = s.storeDir()
+		s.meta.file = latestMetaName
+		key, e := s.getFromKeyring(prefixMetaKey)
 		if e != nil {
-			log.Println("error reading keyring for meta key: ", err)
+			logger().Errorf("error reading keyring for meta key: %v", err)
 			return err
 		}
-		metaStorage.key = key
+		s.meta.key = key
 	} else {
-		err = initMetaDb()
+		err = s.initMetaDb()
 		if err != nil {
-			log.Println("Error opening/initialising meta db: ", err)
+			logger().Errorf("Error opening/initialising meta db: %v", err)
 			return err
 		}
 		return nil
 	}
-	fxConfig, err = getMetaConfig()
+	s.config, err = s.getMetaConfig()
 	return err
 }
 
+func (s *Store) GetStorageObject(dbName string) (*Storage, error) {
+	return s.getStorageObject(dbName, s.OpenDatabase)
+}
+
+// GetStorageObject calls Store.GetStorageObject on the default store.
 func GetStorageObject(dbName string) (*Storage, error) {
+	return defaultStore.GetStorageObject(dbName)
+}
+
+func (s *Store) getStorageObject(dbName string, open dbOpener) (*Storage, error) {
 	// we need to know 3 things:
 	// 1. does it have an entry in the meta storage?
 	// 2. does it have actual db folder in store path?
 	// 3. if it's secured, does it have key stored in keyring?
-	dbObject, err := getMetaDbObject(dbName)
+	if s.isDbRotating(dbName) {
+		return nil, errors.New(dbName + " - " + errDbRotating)
+	}
+	dbObject, err := s.getMetaDbObject(dbName)
 	if err != nil {
-		log.Println("error getting db object: ", err)
+		logger().Errorf("error getting db object: %v", err)
+		return nil, err
+	}
+	// the Storage gets a handle of its own, so the shared one has to let go
+	// of the directory lock
+	if err = s.evictDb(dbName); err != nil {
+		return nil, err
+	}
+	if err = checkBadgerVersion(dbName, dbObject); err != nil {
 		return nil, err
 	}
 	dbPath := path.Join(dbObject.DbPath, dbObject.DbFile)
 	if _, err = os.Stat(dbPath); os.IsNotExist(err) {
-		log.Println("database file not found: ", err)
+		logger().Errorf("database file not found: %v", err)
 		return nil, err
 	}
 	var dbKey = make([]byte, 0)
 	var b64Decoded = make([]byte, 0)
-	if dbObject.Secure && dbObject.Active {
-		dbKey, err = getFromKeyring(prefixMetaDb + dbName)
+	if dbObject.Secure && dbObject.KeyDerived {
+		b64Decoded, err = s.masterDbKey(dbName)
+		if err != nil {
+			logger().Errorf("unable to get db key: %v", err)
+			return nil, err
+		}
+	} else if dbObject.Secure {
+		dbKey, err = s.getDbKeyFromKeyring(dbName)
 		if err != nil {
-			log.Println("unable to find key for db: ", err)
+			logger().Errorf("unable to find key for db: %v", err)
 			return nil, err
 		}
-		b64Decoded, err = b64Decode(string(dbKey))
+		b64Decoded, err = decodeDbKey(dbName, dbKey)
 		if err != nil {
-			log.Println("unable to get db key: ", err)
+			logger().Errorf("unable to get db key: %v", err)
 			return nil, err
 		}
 	}
-	db, err := OpenDatabase(dbPath, b64Decoded)
+	db, err := open(dbPath, b64Decoded)
+	if err != nil {
+		return nil, explainOpenError(dbName, err)
+	}
+	if dbObject.Secure {
+		if err = verifyEncryption(db, b64Decoded); err != nil {
+			_ = CloseDatabase(db)
+			return nil, fmt.Errorf("%s - %w", dbName, err)
+		}
+	}
+	// the handle's methods trust this snapshot instead of asking meta per call
 	storageObject := &Storage{
+		store:       s,
 		db:          db,
 		path:        dbObject.DbPath,
 		file:        dbObject.DbFile,
 		key:         dbKey,
 		rotatingKey: false,
+		name:        dbName,
+		encoding:    s.writeEncoding(dbObject),
+		maxValue:    dbObject.MaxValueSize,
+		defaultTTL:  dbObject.DefaultTTL,
+		active:      dbObject.Active,
+		secure:      dbObject.Secure,
+		readOnly:    dbObject.ReadOnly,
 	}
 	return storageObject, nil
 }
 
-func openUnsecuredDb(path string) (*badger.DB, error) {
-	opt := badger.DefaultOptions(path)
-	opt.IndexCacheSize = 100 << 20
+// Close hands a Storage from OpenStorage back to the shared handle, and
+// closes the handle of one from GetStorageObject or OpenWithOptions. Closing
+// twice is a no-op, and the Storage's operations fail once it is closed.
+func (t *Storage) Close() error {
+	if t.db == nil {
+		return nil
+	}
+	var err error
+	if t.release != nil {
+		err = t.release()
+	} else {
+		err = CloseDatabase(t.db)
+	}
+	t.db = nil
+	t.release = nil
+	return err
+}
+
+// Name is the database name the handle was opened for.
+func (t *Storage) Name() string {
+	return t.name
+}
+
+// Active reports whether the database was active when the handle was opened.
+func (t *Storage) Active() bool {
+	return t.active
+}
+
+// Secure reports whether the database is encrypted.
+func (t *Storage) Secure() bool {
+	return t.secure
+}
+
+// ReadOnly reports whether the database was read-only when the handle was opened.
+func (t *Storage) ReadOnly() bool {
+	return t.readOnly
+}
+
+// checkReadable and checkWritable apply the Active/ReadOnly rules to a handle
+// using the state cached at open time, so handle methods never touch meta.
+func (t *Storage) checkReadable() error {
+	if t.db == nil {
+		return errors.New(t.name + " - storage is closed")
+	}
+	if !t.active {
+		return errors.New(t.name + " - " + errDbInactive)
+	}
+	return nil
+}
+
+func (t *Storage) checkWritable() error {
+	if err := t.checkReadable(); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return fmt.Errorf("%s - %w", t.name, ErrDbReadOnly)
+	}
+	return nil
+}
+
+// DefaultOpenOptions returns the options OpenDatabase uses unless changed with
+// SetOpenOptions.
+func DefaultOpenOptions() OpenOptions {
+	return OpenOptions{
+		IndexCacheSize:      100 << 20,
+		KeyRotationDuration: 24 * time.Hour,
+	}
+}
+
+// SetOpenOptions replaces the options used for every database the package
+// opens from then on.
+func (s *Store) SetOpenOptions(opts OpenOptions) {
+	s.openOptions = opts
+}
+
+// SetOpenOptions calls Store.SetOpenOptions on the default store.
+func SetOpenOptions(opts OpenOptions) {
+	defaultStore.SetOpenOptions(opts)
+}
+
+func (o OpenOptions) apply(opt badger.Options) badger.Options {
+	opt.IndexCacheSize = o.IndexCacheSize
+	if o.DisableKeyRotation {
+		opt.EncryptionKeyRotationDuration = math.MaxInt64
+	} else if o.KeyRotationDuration > 0 {
+		opt.EncryptionKeyRotationDuration = o.KeyRotationDuration
+	}
+	if o.Compression != "" {
+		// ApplyTemplate rejects unknown names before they get here
+		if compression, err := parseCompression(o.Compression); err == nil {
+			opt.Compression = compression
+		}
+	}
+	if o.NumVersionsToKeep > 0 {
+		opt.NumVersionsToKeep = o.NumVersionsToKeep
+	}
+	if o.inMemory {
+		opt = opt.WithInMemory(true).WithDir("").WithValueDir("")
+	}
+	return opt
+}
+
+// parseCompression maps a Compression setting onto badger's compression types.
+func parseCompression(name string) (options.CompressionType, error) {
+	switch name {
+	case "", "snappy":
+		return options.Snappy, nil
+	case "none":
+		return options.None, nil
+	case "zstd":
+		return options.ZSTD, nil
+	}
+	return options.None, errors.New("unknown compression: " + name)
+}
+
+func (s *Store) openUnsecuredDb(path string) (*badger.DB, error) {
+	return openUnsecuredDbWithOptions(path, s.openOptions)
+}
+
+func openUnsecuredDbWithOptions(path string, opts OpenOptions) (*badger.DB, error) {
+	opt := opts.apply(badger.DefaultOptions(path))
 	db, err := badger.Open(opt)
 	if err != nil {
-		log.Println("Error opening unsecured db:", err)
+		logger().Errorf("Error opening unsecured db: %v", err)
 		return nil, err
 	}
 	return db, nil
 }
 
+func (s *Store) OpenDatabase(path string, key []byte) (*badger.DB, error) {
+	return OpenDatabaseWithOptions(path, key, s.openOptions)
+}
+
+// OpenDatabase calls Store.OpenDatabase on the default store.
 func OpenDatabase(path string, key []byte) (*badger.DB, error) {
-	opt := badger.DefaultOptions(path).WithEncryptionKey(key).WithEncryptionKeyRotationDuration(24 * time.Hour)
-	opt.IndexCacheSize = 100 << 20
+	return defaultStore.OpenDatabase(path, key)
+}
+
+// OpenDatabaseWithOptions is OpenDatabase with explicit open options instead
+// of the package-wide ones.
+func OpenDatabaseWithOptions(path string, key []byte, opts OpenOptions) (*badger.DB, error) {
+	opt := opts.apply(badger.DefaultOptions(path).WithEncryptionKey(key))
 	db, err := badger.Open(opt)
 	if err != nil {
-		log.Println("Error opening database: ", err)
+		logger().Errorf("Error opening database: %v", err)
 		return nil, err
 	}
 	return db, nil
@@ -508,7 +811,7 @@ func setDbEntry(key []byte, value []byte, db *badger.DB) error {
 		return nil
 	})
 	if err != nil {
-		log.Println("meta update error: ", err)
+		logger().Errorf("meta update error: %v", err)
 	}
 
 	return err
@@ -522,33 +825,54 @@ func getDbEntry(key []byte, db *badger.DB) ([]byte, error) {
 		if err != nil {
 			return err
 		}
-		err = item.Value(func(val []byte) error {
-			value = val
-			return nil
-		})
+		if itemExpired(item) {
+			return badger.ErrKeyNotFound
+		}
+		value, err = itemValue(item)
 		return err
 	})
 	if err != nil {
-		log.Println("meta get error: ", err)
+		logger().Errorf("meta get error: %v", err)
 	}
 	return value, err
 }
 
-func listDatabases() (map[string]*DbObject, error) {
-	if metaStorage.rotatingKey {
-		return nil, errors.New(errDbRotating)
-	}
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
-	db, err := OpenDatabase(metaPath, metaStorage.key)
+// ListDatabasesByCreation returns every registered database ordered by its
+// Created time, oldest first unless descending, with Name filled in.
+func (s *Store) ListDatabasesByCreation(descending bool) ([]DbObject, error) {
+	dbs, err := s.listDatabases()
 	if err != nil {
 		return nil, err
 	}
-	defer func(db *badger.DB) {
-		err := db.Close()
-		if err != nil {
-			log.Println("Error closing meta db:", err)
+	list := make([]DbObject, 0, len(dbs))
+	for key, dbObject := range dbs {
+		dbObject.Name = strings.TrimPrefix(key, prefixMetaDb)
+		list = append(list, *dbObject)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if descending {
+			a, b = b, a
 		}
-	}(db)
+		if a.Created != b.Created {
+			return a.Created < b.Created
+		}
+		return a.Name < b.Name
+	})
+	return list, nil
+}
+
+// ListDatabasesByCreation calls Store.ListDatabasesByCreation on the default store.
+func ListDatabasesByCreation(descending bool) ([]DbObject, error) {
+	return defaultStore.ListDatabasesByCreation(descending)
+}
+
+func (s *Store) listDatabases() (map[string]*DbObject, error) {
+	db, err := s.openMeta()
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseMeta()
 	m := make(map[string]*DbObject)
 	err = db.View(func(txn *badger.Txn) error {
 		iterator := txn.NewIterator(badger.DefaultIteratorOptions)
@@ -572,59 +896,105 @@ func listDatabases() (map[string]*DbObject, error) {
 	return m, err
 }
 
-func metaBatchInsert(values *map[string][]byte) error {
-	if metaStorage.rotatingKey {
-		return errors.New(errDbRotating)
-	}
-	var err error
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
-	metaStorage.db, err = OpenDatabase(metaPath, metaStorage.key)
+func (s *Store) metaBatchInsert(values *map[string][]byte) error {
+	db, err := s.openMeta()
 	if err != nil {
 		return err
 	}
-	defer func(db *badger.DB) {
-		err = db.Close()
-		if err != nil {
-			log.Println("Error closing meta database: ", err)
-		}
-	}(metaStorage.db)
-	wb := metaStorage.db.NewWriteBatch()
+	defer s.releaseMeta()
+	wb := db.NewWriteBatch()
 	defer wb.Cancel()
 
 	for key, val := range *values {
 		err = wb.Set([]byte(key), val)
 		if err != nil {
-			log.Println("error writing value to batch: ", err)
+			logger().Errorf("error writing value to batch: %v", err)
 		}
 	}
 	return wb.Flush()
 }
 
-func batchInsertGeneric(values *map[string][]byte, db *badger.DB) error {
+// batchInsertGeneric writes values through a single WriteBatch, expiring at
+// expiresAt unless it is 0. halt is asked before each entry; once it returns
+// an error, what is staged so far is flushed and that error returned.
+func batchInsertGeneric(values *map[string][]byte, encoding valueEncoding, expiresAt uint64, db *badger.DB, halt func() error) error {
 	var err error
 	wb := db.NewWriteBatch()
 	defer wb.Cancel()
 	for key, val := range *values {
-		err = wb.Set([]byte(key), val)
+		if haltErr := halt(); haltErr != nil {
+			return errors.Join(haltErr, wb.Flush())
+		}
+		var entry *badger.Entry
+		entry, err = valueEntry([]byte(key), val, encoding)
+		if err == nil {
+			entry.ExpiresAt = expiresAt
+			err = wb.SetEntry(entry)
+		}
 		if err != nil {
-			log.Println("error writing value to batch: ", err)
+			logger().Errorf("error writing value to batch: %v", err)
 		}
 	}
 	return wb.Flush()
 }
 
+// batchInsertDetailedGeneric writes values through a single WriteBatch and
+// records which keys were rejected. A failed flush marks every staged key as
+// failed since badger does not say which of its internal commits went wrong;
+// re-setting those keys is always safe. Once halt returns an error, the keys
+// not yet staged are failed with it, and the staged ones flushed. Entries
+// expire at expiresAt unless it is 0.
+func batchInsertDetailedGeneric(values *map[string][]byte, encoding valueEncoding, expiresAt uint64, db *badger.DB, halt func() error) (BatchResult, error) {
+	result := BatchResult{Total: len(*values)}
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+	staged := make([]string, 0, len(*values))
+	var haltErr error
+	for key, val := range *values {
+		if haltErr == nil {
+			haltErr = halt()
+		}
+		if haltErr != nil {
+			result.Failed = append(result.Failed, BatchFailure{Key: key, Reason: haltErr.Error()})
+			continue
+		}
+		entry, err := valueEntry([]byte(key), val, encoding)
+		if err == nil {
+			entry.ExpiresAt = expiresAt
+			err = wb.SetEntry(entry)
+		}
+		if err != nil {
+			result.Failed = append(result.Failed, BatchFailure{Key: key, Reason: err.Error()})
+			continue
+		}
+		staged = append(staged, key)
+	}
+	err := wb.Flush()
+	if err != nil {
+		for _, key := range staged {
+			result.Failed = append(result.Failed, BatchFailure{Key: key, Reason: err.Error()})
+		}
+		return result, err
+	}
+	result.Succeeded = len(staged)
+	return result, haltErr
+}
+
 func countRecords(prefix string, db *badger.DB, verbose bool) (int, error) {
 	var err error
 	count := 0
 	err = db.View(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: false})
 		defer it.Close()
 		prefix := []byte(prefix)
 		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			if isReservedKey(it.Item().Key()) {
+				continue
+			}
 			if verbose {
 				item := it.Item()
 				k := item.Key()
-				log.Println("key: ", string(k))
+				logger().Debugf("key: %s", k)
 			}
 			count += 1
 		}
@@ -636,68 +1006,50 @@ func countRecords(prefix string, db *badger.DB, verbose bool) (int, error) {
 	return count, nil
 }
 
-func copyMetas() (newPath string, newKey []byte, err error) {
-	if metaStorage.rotatingKey {
+// copyMetas copies the meta db into a new directory under a fresh key. The
+// entries are streamed straight into the new db's WriteBatch, so memory use
+// stays bounded however large the meta db is.
+func (s *Store) copyMetas() (newPath string, newKey []byte, err error) {
+	if s.meta.rotatingKey {
 		return "", nil, errors.New("rotate flag already raised")
 	}
-	var e error
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
-	metaStorage.db, e = OpenDatabase(metaPath, metaStorage.key)
+	ctx, state, e := s.beginDbRotation(metaRotationName)
 	if e != nil {
 		return "", nil, e
 	}
-	defer func(db *badger.DB) {
-		err := db.Close()
-		if err != nil {
-			log.Println("Error closing meta database: ", err)
-		}
-	}(metaStorage.db)
+	defer s.endDbRotation(state)
+	src, e := s.acquireMeta()
+	if e != nil {
+		return "", nil, e
+	}
+	defer s.releaseMeta()
 
-	metaStorage.rotatingKey = true
+	s.meta.rotatingKey = true
+	defer func() {
+		s.meta.rotatingKey = false
+	}()
 	newMetaKey, _ := randomValues(keyLength)
 	metaFileRandom, _ := randomValues(10)
 	newMetaFile := "meta-" + string(metaFileRandom)
-	newDb, err := OpenDatabase(StorePath+newMetaFile, newMetaKey)
+	newMetaPath := path.Join(s.storeDir(), newMetaFile)
+	state.setTarget(newMetaPath)
+	newDb, err := s.OpenDatabase(newMetaPath, newMetaKey)
 	if err != nil {
-		log.Println("Error opening new meta database: ", err)
+		logger().Errorf("Error opening new meta database: %v", err)
 		return "", nil, err
 	}
 	defer func(db *badger.DB) {
 		err = db.Close()
 		if err != nil {
-			log.Println("Error closing new meta database: ", err)
+			logger().Errorf("Error closing new meta database: %v", err)
 		}
 	}(newDb)
 
-	values := make(map[string][]byte)
-	stream := metaStorage.db.NewStream()
-	stream.NumGo = 20
-	stream.ChooseKey = func(item *badger.Item) bool {
-		return bytes.HasPrefix(item.Key(), stream.Prefix)
-	}
-	stream.Send = func(buffer *z.Buffer) error {
-		var list pb.KVList
-		err = buffer.SliceIterate(func(slice []byte) error {
-			kv := new(pb.KV)
-			if err = proto.Unmarshal(slice, kv); err != nil {
-				return err
-			}
-			list.Kv = append(list.Kv, kv)
-			return nil
-		})
-		if err != nil {
-			return err
-		}
-		for _, element := range list.Kv {
-			key := element.Key
-			value := element.Value
-			values[string(key)] = value
-		}
-		return err
+	err = streamCopy(ctx, src, newDb)
+	if err != nil {
+		return "", nil, err
 	}
-	err = stream.Orchestrate(context.Background())
-	err = batchInsertGeneric(&values, newDb)
-	metaStorage.rotatingKey = false
+	err = state.commit()
 	return newMetaFile, newMetaKey, err
 }
 
@@ -709,77 +1061,596 @@ func b64Decode(input string) ([]byte, error) {
 	return base64.StdEncoding.DecodeString(input)
 }
 
-func getDbKey(dbName string, dbObject *DbObject) ([]byte, error) {
+func (s *Store) getDbKey(dbName string, dbObject *DbObject) ([]byte, error) {
 	bDbKey := make([]byte, 0)
 	var err error
+	if dbObject.Secure && dbObject.KeyDerived {
+		return s.masterDbKey(dbName)
+	}
 	if dbObject.Secure {
-		bDbKey, err = getFromKeyring(prefixMetaDb + dbName)
+		bDbKey, err = s.getDbKeyFromKeyring(dbName)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, fmt.Errorf("%s - %w: not in the keyring", dbName, ErrMissingDbKey)
+		}
 		if err != nil {
 			return nil, err
 		}
-		dbKey, e := b64Decode(string(bDbKey))
-		if e != nil {
-			return nil, e
-		}
-		return dbKey, nil
+		return decodeDbKey(dbName, bDbKey)
 	}
 	return nil, nil
 }
 
-func CreateDatabase(dbName string, secure bool) error {
-	// check first
-	exist, err := databaseExist(dbName)
+// decodeDbKey decodes a secure database's key as stored in the keyring, and
+// makes sure there is a usable key before anything tries to open with it.
+func decodeDbKey(dbName string, b64Key []byte) ([]byte, error) {
+	if len(b64Key) == 0 {
+		return nil, fmt.Errorf("%s - %w: the keyring entry is empty", dbName, ErrMissingDbKey)
+	}
+	dbKey, err := b64Decode(string(b64Key))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("%s - %w: %v", dbName, ErrMissingDbKey, err)
 	}
-	if exist {
-		return errors.New("database already exists")
+	switch len(dbKey) {
+	case 16, 24, 32:
+		return dbKey, nil
 	}
-	// open db with name and optional key - store the key on keyring
-	dbId, _ := randomValues(fileIdLength)
-	dbActualName := dbName + "-" + string(dbId)
-	dbPath := path.Join(fxConfig.StorePath, dbActualName)
-	var db *badger.DB
-	if secure {
-		key, secErr := randomValues(keyLength)
-		if secErr != nil {
-			return secErr
+	return nil, fmt.Errorf("%s - %w: key is %d bytes", dbName, ErrMissingDbKey, len(dbKey))
+}
+
+// openDbByName resolves dbName through the meta db and returns its badger
+// handle, refusing inactive databases. The handle is opened with the db's key
+// on first use and then kept open for later operations, see handles.go. The
+// caller must hand it back with releaseDb, and must not close it.
+func (s *Store) openDbByName(dbName string) (db *badger.DB, dbObject *DbObject, err error) {
+	db, dbObject, err = s.openCachedDb(dbName)
+	if errors.Is(err, errStaleHandle) {
+		// the database moved since the handle was opened
+		if err = s.evictDb(dbName); err != nil {
+			return nil, nil, err
 		}
-		db, secErr = OpenDatabase(dbPath, key)
-		if secErr != nil {
-			return secErr
+		db, dbObject, err = s.openCachedDb(dbName)
+	}
+	return db, dbObject, err
+}
+
+func (s *Store) openCachedDb(dbName string) (db *badger.DB, dbObject *DbObject, err error) {
+	if s.isDbRotating(dbName) {
+		return nil, nil, errors.New(dbName + " - " + errDbRotating)
+	}
+	handle := s.dbHandleFor(dbName)
+	handle.gate.RLock()
+	defer func() {
+		if err != nil {
+			handle.gate.RUnlock()
 		}
-		b64Key := b64Encode(key)
-		secErr = WriteToKeyring(prefixMetaDb+dbName, []byte(b64Key))
+	}()
+	dbObject, err = s.getMetaDbObject(dbName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !dbObject.Active {
+		return nil, nil, errors.New(dbName + " - " + errDbInactive)
+	}
+	if err = checkBadgerVersion(dbName, dbObject); err != nil {
+		return nil, nil, err
+	}
+	dbPath := path.Join(dbObject.DbPath, dbObject.DbFile)
+	db, err = handle.acquire(dbPath, func() (*badger.DB, error) {
+		return s.openDbObject(dbName, dbObject)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, dbObject, nil
+}
+
+// openDbObject opens the badger database dbObject describes with its key.
+func (s *Store) openDbObject(dbName string, dbObject *DbObject) (*badger.DB, error) {
+	dbKey, err := s.getDbKey(dbName, dbObject)
+	if err != nil {
+		return nil, err
+	}
+	dbPath := path.Join(dbObject.DbPath, dbObject.DbFile)
+	opts := s.dbOpenOptions(dbObject)
+	opened := time.Now()
+	var db *badger.DB
+	if dbObject.Secure {
+		db, err = OpenDatabaseWithOptions(dbPath, dbKey, opts)
+	} else {
+		db, err = openUnsecuredDbWithOptions(dbPath, opts)
+	}
+	if err != nil {
+		return nil, explainOpenError(dbName, err)
+	}
+	s.observeOp(dbName, "open", opened)
+	if dbObject.Secure {
+		if err = verifyEncryption(db, dbKey); err != nil {
+			_ = CloseDatabase(db)
+			return nil, fmt.Errorf("%s - %w", dbName, err)
+		}
+	}
+	return db, nil
+}
+
+// dbOpenOptions are the package-wide open options with dbObject's own
+// settings applied.
+func (s *Store) dbOpenOptions(dbObject *DbObject) OpenOptions {
+	opts := s.openOptions
+	if dbObject.Compression != "" {
+		opts.Compression = dbObject.Compression
+	}
+	opts.inMemory = s.inMemory
+	return opts
+}
+
+// verifyEncryption checks that a secure database was really opened with its
+// key, so a key lost somewhere on the way can't open it unencrypted.
+func verifyEncryption(db *badger.DB, key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return ErrEncryptionNotApplied
+	}
+	if !bytes.Equal(db.Opts().EncryptionKey, key) {
+		return ErrEncryptionNotApplied
+	}
+	return nil
+}
+
+// openWritableDbByName is openDbByName for operations that modify data, and
+// also refuses read-only databases.
+func (s *Store) openWritableDbByName(dbName string) (*badger.DB, *DbObject, error) {
+	db, dbObject, err := s.openDbByName(dbName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dbObject.ReadOnly {
+		_ = s.releaseDb(dbName, db)
+		return nil, nil, fmt.Errorf("%s - %w", dbName, ErrDbReadOnly)
+	}
+	return db, dbObject, nil
+}
+
+// SetReadOnly freezes or unfreezes dbName. A read-only database still serves
+// reads, but InsertEntry, UpdateEntry, RemoveEntry and the batch inserts fail
+// with ErrDbReadOnly.
+func (s *Store) SetReadOnly(dbName string, ro bool) error {
+	dbObject, err := s.getMetaDbObject(dbName)
+	if err != nil {
+		return err
+	}
+	dbObject.ReadOnly = ro
+	return s.writeMetaDbObject(dbName, dbObject, true)
+}
+
+// SetReadOnly calls Store.SetReadOnly on the default store.
+func SetReadOnly(dbName string, ro bool) error {
+	return defaultStore.SetReadOnly(dbName, ro)
+}
+
+// SetDatabaseActive takes dbName offline, or brings it back. While inactive
+// its operations fail with the inactive error and its shared handle is
+// closed, so the directory can be worked on; operations already running
+// finish first. A soft-deleted database is brought back with RestoreDatabase
+// instead.
+func (s *Store) SetDatabaseActive(dbName string, active bool) error {
+	gate := s.dbGate(dbName)
+	if err := gate.Lock(); err != nil {
+		return fmt.Errorf("%s - %w", dbName, err)
+	}
+	defer gate.Unlock()
+	dbObject, err := s.getMetaDbObject(dbName)
+	if err != nil {
+		return err
+	}
+	if active && dbObject.Deleted != 0 {
+		return errors.New(dbName + " is soft-deleted, use RestoreDatabase")
+	}
+	if !active {
+		if err = s.dbHandleFor(dbName).close(); err != nil {
+			return err
+		}
+	}
+	dbObject.Active = active
+	return s.writeMetaDbObject(dbName, dbObject, true)
+}
+
+// SetDatabaseActive calls Store.SetDatabaseActive on the default store.
+func SetDatabaseActive(dbName string, active bool) error {
+	return defaultStore.SetDatabaseActive(dbName, active)
+}
+
+// ApplyTemplate stamps the settings in tmpl onto every database in names, in
+// a single batched meta write. Either all of them are updated or, when a name
+// isn't registered or the template is invalid, none are.
+func (s *Store) ApplyTemplate(names []string, tmpl DbTemplate) error {
+	if tmpl.DefaultTTL != nil && *tmpl.DefaultTTL < 0 {
+		return errors.New("default ttl must not be negative")
+	}
+	if tmpl.Compression != nil {
+		if _, err := parseCompression(*tmpl.Compression); err != nil {
+			return err
+		}
+	}
+	dbs, err := s.listDatabases()
+	if err != nil {
+		return err
+	}
+	values := make(map[string][]byte, len(names))
+	for _, dbName := range names {
+		dbObject, ok := dbs[prefixMetaDb+dbName]
+		if !ok {
+			return errors.New("database not found: " + dbName)
+		}
+		if tmpl.DefaultTTL != nil {
+			dbObject.DefaultTTL = *tmpl.DefaultTTL
+		}
+		if tmpl.Compression != nil {
+			dbObject.Compression = *tmpl.Compression
+		}
+		if tmpl.ReadOnly != nil {
+			dbObject.ReadOnly = *tmpl.ReadOnly
+		}
+		if tmpl.Tags != nil {
+			dbObject.Tags = append([]string(nil), tmpl.Tags...)
+		}
+		jsonDb, err := json.Marshal(dbObject)
+		if err != nil {
+			return err
+		}
+		values[prefixMetaDb+dbName] = jsonDb
+	}
+	err = s.metaBatchInsert(&values)
+	if err != nil {
+		return err
+	}
+	return s.writeMetaEvent(EventTypeUpdate, "Applied template to db objects: "+strings.Join(names, ","))
+}
+
+// ApplyTemplate calls Store.ApplyTemplate on the default store.
+func ApplyTemplate(names []string, tmpl DbTemplate) error {
+	return defaultStore.ApplyTemplate(names, tmpl)
+}
+
+// dbOpener opens the badger db at dbPath; key is empty for unsecured dbs.
+type dbOpener func(dbPath string, key []byte) (*badger.DB, error)
+
+func (s *Store) defaultOpener(dbPath string, key []byte) (*badger.DB, error) {
+	if len(key) > 0 {
+		return s.OpenDatabase(dbPath, key)
+	}
+	return s.openUnsecuredDb(dbPath)
+}
+
+// optionsOpener opens databases with caller-supplied badger options. Only the
+// directories and the encryption key are overridden, those stay managed by the
+// package, plus the index cache size if an encrypted db would go without.
+func (s *Store) optionsOpener(opt badger.Options) dbOpener {
+	return func(dbPath string, key []byte) (*badger.DB, error) {
+		opt.Dir = dbPath
+		opt.ValueDir = dbPath
+		opt.EncryptionKey = key
+		if len(key) > 0 {
+			// badger panics on encrypted dbs without caches: use ours for the
+			// index cache, which badger leaves unset by default
+			if opt.IndexCacheSize == 0 {
+				opt.IndexCacheSize = s.openOptions.IndexCacheSize
+			}
+			if opt.BlockCacheSize == 0 {
+				return nil, errors.New("BlockCacheSize must be set for encrypted databases")
+			}
+		}
+		return badger.Open(opt)
+	}
+}
+
+// CreateDatabase creates and registers a new database. dbName becomes part of
+// the directory name, so it must pass ValidateDatabaseName. opts, such as
+// WithMaxValueSize, adjust its settings before they are stored.
+func (s *Store) CreateDatabase(dbName string, secure bool, opts ...DbOption) error {
+	if err := ValidateDatabaseName(dbName); err != nil {
+		return err
+	}
+	return s.createDatabase(dbName, secure, s.defaultOpener, opts...)
+}
+
+// CreateDatabase calls Store.CreateDatabase on the default store.
+func CreateDatabase(dbName string, secure bool, opts ...DbOption) error {
+	return defaultStore.CreateDatabase(dbName, secure, opts...)
+}
+
+// DbOption sets up a database CreateDatabase is creating. What it sets is
+// stored in meta with the rest of the database's settings.
+type DbOption func(dbObject *DbObject)
+
+// WithMaxValueSize caps the values the database accepts at n bytes, see
+// DbObject.MaxValueSize.
+func WithMaxValueSize(n int64) DbOption {
+	return func(dbObject *DbObject) {
+		dbObject.MaxValueSize = n
+	}
+}
+
+// checkValueSize fails with ErrValueTooLarge if value is over max, zero
+// meaning no limit.
+func checkValueSize(dbName string, max int64, value []byte) error {
+	if max > 0 && int64(len(value)) > max {
+		return fmt.Errorf("%s - %w: %d bytes, the limit is %d", dbName, ErrValueTooLarge, len(value), max)
+	}
+	return nil
+}
+
+// checkValueSizes is checkValueSize over every value of a batch.
+func checkValueSizes(dbName string, max int64, entries map[string][]byte) error {
+	for key, value := range entries {
+		if err := checkValueSize(dbName, max, value); err != nil {
+			return fmt.Errorf("%w (key %s)", err, key)
+		}
+	}
+	return nil
+}
+
+// CreateDatabaseDefault creates dbName secure or not as Config.SecureNewDb
+// says, for callers that follow the store's policy rather than choosing.
+func (s *Store) CreateDatabaseDefault(dbName string) error {
+	config, err := s.CurrentConfig()
+	if err != nil {
+		return err
+	}
+	return s.CreateDatabase(dbName, config.SecureNewDb)
+}
+
+// CreateDatabaseDefault calls Store.CreateDatabaseDefault on the default store.
+func CreateDatabaseDefault(dbName string) error {
+	return defaultStore.CreateDatabaseDefault(dbName)
+}
+
+// ValidateDatabaseName checks dbName against the names CreateDatabase
+// accepts: 1 to 128 ASCII letters, digits, '.', '_' and '-', starting with a
+// letter or digit. Names starting with '_' are reserved for the package's own
+// databases. The error wraps ErrInvalidDatabaseName.
+func ValidateDatabaseName(dbName string) error {
+	if dbName == "" || len(dbName) > maxDbNameLength {
+		return fmt.Errorf("%q - %w: length must be 1 to %d", dbName, ErrInvalidDatabaseName, maxDbNameLength)
+	}
+	for i, c := range dbName {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case (c == '.' || c == '_' || c == '-') && i > 0:
+		default:
+			return fmt.Errorf("%q - %w: unexpected character %q", dbName, ErrInvalidDatabaseName, c)
+		}
+	}
+	return nil
+}
+
+// CreateDatabaseWithOptions creates dbName like CreateDatabase but opens it
+// with a fully-formed badger.Options, for tuning anything OpenOptions doesn't
+// cover. The package still sets the directory and encryption key and
+// registers the database in meta. The options aren't persisted: open the
+// database with OpenWithOptions and the same options afterwards.
+func (s *Store) CreateDatabaseWithOptions(dbName string, opt badger.Options, secure bool) error {
+	if err := ValidateDatabaseName(dbName); err != nil {
+		return err
+	}
+	return s.createDatabase(dbName, secure, s.optionsOpener(opt))
+}
+
+// CreateDatabaseWithOptions calls Store.CreateDatabaseWithOptions on the default store.
+func CreateDatabaseWithOptions(dbName string, opt badger.Options, secure bool) error {
+	return defaultStore.CreateDatabaseWithOptions(dbName, opt, secure)
+}
+
+// OpenWithOptions opens dbName as a Storage handle using opt, see
+// CreateDatabaseWithOptions.
+func (s *Store) OpenWithOptions(dbName string, opt badger.Options) (*Storage, error) {
+	return s.getStorageObject(dbName, s.optionsOpener(opt))
+}
+
+// OpenWithOptions calls Store.OpenWithOptions on the default store.
+func OpenWithOptions(dbName string, opt badger.Options) (*Storage, error) {
+	return defaultStore.OpenWithOptions(dbName, opt)
+}
+
+func (s *Store) createDatabase(dbName string, secure bool, open dbOpener, opts ...DbOption) error {
+	// check first
+	exist, err := s.databaseExist(dbName)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return errors.New("database already exists")
+	}
+	// open db with name and optional key - store the key on keyring
+	var dbActualName string
+	if s.config.DeterministicDirNames {
+		dbActualName = DeterministicDirName(dbName)
+	} else {
+		dbId, _ := randomValues(fileIdLength)
+		dbActualName = dbName + "-" + string(dbId)
+	}
+	dbPath := path.Join(s.config.StorePath, dbActualName)
+	if s.config.DeterministicDirNames {
+		// a leftover directory would otherwise be adopted as the new database
+		if _, statErr := os.Stat(dbPath); statErr == nil {
+			return errors.New("database directory already exists: " + dbPath)
+		}
+	}
+	var db *badger.DB
+	keyDerived := secure && s.masterKey != nil
+	if keyDerived {
+		db, err = open(dbPath, DeriveDbKey(s.masterKey, dbName))
+		if err != nil {
+			return err
+		}
+	} else if secure {
+		key, secErr := randomValues(keyLength)
 		if secErr != nil {
 			return secErr
 		}
+		db, secErr = open(dbPath, key)
+		if secErr != nil {
+			return secErr
+		}
+		b64Key := b64Encode(key)
+		secErr = s.WriteToKeyring(prefixMetaDb+dbName, []byte(b64Key))
+		if secErr != nil {
+			// nothing refers to the new directory yet
+			return errors.Join(secErr, CloseDatabase(db), os.RemoveAll(dbPath))
+		}
 	} else {
-		db, err = openUnsecuredDb(dbPath)
+		db, err = open(dbPath, nil)
 		if err != nil {
 			return err
 		}
 	}
 	// create a new DbObject struct and store it in meta db
 	dbObject := DbObject{
-		DbPath:      fxConfig.StorePath,
-		DbFile:      dbActualName,
-		Secure:      secure,
-		Created:     time.Now().UnixMilli(),
-		Active:      true,
-		LastRotated: 0,
-		Deleted:     0,
-	}
-	err = writeMetaDbObject(dbName, &dbObject, false)
+		DbPath:        s.config.StorePath,
+		DbFile:        dbActualName,
+		Secure:        secure,
+		Created:       clock().UnixMilli(),
+		Active:        true,
+		LastRotated:   0,
+		Deleted:       0,
+		KeyDerived:    keyDerived,
+		BadgerVersion: badgerVersion(),
+	}
+	for _, opt := range opts {
+		opt(&dbObject)
+	}
+	err = s.writeMetaDbObject(dbName, &dbObject, false)
 	if err != nil {
-		return err
+		if secure && !keyDerived {
+			_ = s.removeFromKeyring(prefixMetaDb + dbName)
+		}
+		return errors.Join(err, CloseDatabase(db), os.RemoveAll(dbPath))
 	}
 	err = CloseDatabase(db)
 	return err
 }
 
-func databaseExist(dbName string) (bool, error) {
-	_, err := GetStorageObject(dbName)
+// DeleteDatabase removes dbName altogether: its meta entry and expiry index,
+// its key in the keyring and its directory. Operations already running
+// against it finish first. The meta entry goes first, so if the directory
+// can't be removed afterwards it is left as an orphan, see
+// ListOrphanedDirectories.
+func (s *Store) DeleteDatabase(dbName string) error {
+	if s.isDbRotating(dbName) {
+		return errors.New(dbName + " - " + errDbRotating)
+	}
+	gate, err := s.lockDb(dbName)
+	if err != nil {
+		return err
+	}
+	defer gate.Unlock()
+	dbObject, err := s.getMetaDbObject(dbName)
+	if err != nil {
+		return err
+	}
+	meta, err := s.openMeta()
+	if err != nil {
+		return err
+	}
+	err = meta.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(prefixMetaDb + dbName))
+	})
+	if err == nil {
+		err = meta.DropPrefix([]byte(expiryIndexPrefix(dbName)))
+	}
+	s.releaseMeta()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if dbObject.Secure && !dbObject.KeyDerived {
+		if err = s.removeFromKeyring(prefixMetaDb + dbName); err != nil {
+			logger().Errorf("error removing db key: %v", err)
+			errs = append(errs, err)
+		}
+	}
+	if err = os.RemoveAll(path.Join(dbObject.DbPath, dbObject.DbFile)); err != nil {
+		logger().Errorf("error removing db dir: %v", err)
+		errs = append(errs, err)
+	}
+	_ = s.writeDbEvent(EventTypeDelete, dbName, "Deleted database: "+dbName)
+	return errors.Join(errs...)
+}
+
+// DeleteDatabase calls Store.DeleteDatabase on the default store.
+func DeleteDatabase(dbName string) error {
+	return defaultStore.DeleteDatabase(dbName)
+}
+
+// SoftDeleteDatabase takes dbName out of use without removing anything: it is
+// marked deleted and inactive, hidden from ListDatabases, and its directory
+// and key stay where they are until RestoreDatabase brings it back or
+// DeleteDatabase removes it for good. Operations already running against it
+// finish first.
+func (s *Store) SoftDeleteDatabase(dbName string) error {
+	if s.isDbRotating(dbName) {
+		return errors.New(dbName + " - " + errDbRotating)
+	}
+	gate, err := s.lockDb(dbName)
+	if err != nil {
+		return err
+	}
+	defer gate.Unlock()
+	dbObject, err := s.getMetaDbObject(dbName)
+	if err != nil {
+		return err
+	}
+	dbObject.Deleted = clock().UnixMilli()
+	dbObject.Active = false
+	if err = s.writeMetaDbObject(dbName, dbObject, true); err != nil {
+		return err
+	}
+	_ = s.writeDbEvent(EventTypeDelete, dbName, "Soft-deleted database: "+dbName)
+	return nil
+}
+
+// SoftDeleteDatabase calls Store.SoftDeleteDatabase on the default store.
+func SoftDeleteDatabase(dbName string) error {
+	return defaultStore.SoftDeleteDatabase(dbName)
+}
+
+// RestoreDatabase brings back a database taken out of use by
+// SoftDeleteDatabase, active again and listed. It fails with ErrDbNotDeleted
+// for a database that isn't soft-deleted.
+func (s *Store) RestoreDatabase(dbName string) error {
+	dbObject, err := s.getMetaDbObject(dbName)
+	if err != nil {
+		return err
+	}
+	if dbObject.Deleted == 0 {
+		return ErrDbNotDeleted
+	}
+	dbObject.Deleted = 0
+	dbObject.Active = true
+	return s.writeMetaDbObject(dbName, dbObject, true)
+}
+
+// RestoreDatabase calls Store.RestoreDatabase on the default store.
+func RestoreDatabase(dbName string) error {
+	return defaultStore.RestoreDatabase(dbName)
+}
+
+// DeterministicDirName is the directory name CreateDatabase uses for dbName
+// when Config.DeterministicDirNames is set: the name plus a hash of it, so
+// backup scripts can find a database without reading the meta db.
+func DeterministicDirName(dbName string) string {
+	hash := sha256.Sum256([]byte(dbName))
+	return dbName + "-" + hex.EncodeToString(hash[:])[:fileIdLength]
+}
+
+// databaseExist reports whether dbName is registered in meta. Only the meta
+// entry is read, so probing never opens the database or disturbs its shared
+// handle.
+func (s *Store) databaseExist(dbName string) (bool, error) {
+	if s.hasOpenHandle(dbName) {
+		return true, nil
+	}
+	_, err := s.getMetaEntry(prefixMetaDb + dbName)
 	if err != nil {
 		var metaKeyNotFound *EMetaKeyNotFound
 		if errors.As(err, &metaKeyNotFound) {
@@ -790,166 +1661,582 @@ func databaseExist(dbName string) (bool, error) {
 	return true, nil
 }
 
+// InsertEntry stores value under key in dbName and records the write in the
+// event log.
+func (s *Store) InsertEntry(dbName string, key string, value []byte) error {
+	return s.InsertEntryContext(context.Background(), dbName, key, value)
+}
+
+// InsertEntry calls Store.InsertEntry on the default store.
 func InsertEntry(dbName string, key string, value []byte) error {
-	dbObject, err := getMetaDbObject(dbName)
+	return defaultStore.InsertEntry(dbName, key, value)
+}
+
+// InsertEntryContext is InsertEntry giving up with ctx's error if ctx is
+// done before the write starts.
+func (s *Store) InsertEntryContext(ctx context.Context, dbName string, key string, value []byte) (err error) {
+	defer s.observeOpResult(dbName, "InsertEntry", time.Now(), &err)
+	if err := s.insertEntry(ctx, dbName, key, value); err != nil {
+		return err
+	}
+	_ = s.writeDbEvent(EventTypeWrite, dbName, "Wrote entry: "+dbName+":"+key)
+	return nil
+}
+
+// InsertEntryContext calls Store.InsertEntryContext on the default store.
+func InsertEntryContext(ctx context.Context, dbName string, key string, value []byte) (err error) {
+	return defaultStore.InsertEntryContext(ctx, dbName, key, value)
+}
+
+// insertEntry is InsertEntryContext without the event.
+func (s *Store) insertEntry(ctx context.Context, dbName string, key string, value []byte) error {
+	db, dbObject, err := s.openWritableDbByName(dbName)
 	if err != nil {
 		return err
 	}
-	if !dbObject.Active {
-		return errors.New(dbName + " - " + errDbInactive)
+	if err = ctx.Err(); err != nil {
+		_ = s.releaseDb(dbName, db)
+		return err
+	}
+	if err = checkValueSize(dbName, dbObject.MaxValueSize, value); err != nil {
+		_ = s.releaseDb(dbName, db)
+		return err
 	}
-	dbKey, err := getDbKey(dbName, dbObject)
+	entry, err := valueEntry([]byte(key), value, s.writeEncoding(dbObject))
 	if err != nil {
+		_ = s.releaseDb(dbName, db)
 		return err
 	}
-	dbPath := path.Join(dbObject.DbPath, dbObject.DbFile)
-	var db *badger.DB
-	if dbObject.Secure {
-		db, err = OpenDatabase(dbPath, dbKey)
-	} else {
-		db, err = openUnsecuredDb(dbPath)
+	if dbObject.DefaultTTL > 0 {
+		entry = entry.WithTTL(dbObject.DefaultTTL)
 	}
+	err = setDbValueEntry(entry, db)
+	closeErr := s.releaseDb(dbName, db)
 	if err != nil {
 		return err
 	}
-	err = setDbEntry([]byte(key), value, db)
+	if closeErr != nil {
+		return closeErr
+	}
+	if entry.ExpiresAt > 0 {
+		return s.indexExpiry(dbName, key, entry.ExpiresAt)
+	}
+	return nil
+}
+
+// setDbValueEntry writes an entry built by valueEntry.
+func setDbValueEntry(entry *badger.Entry, db *badger.DB) error {
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(entry)
+	})
+}
+
+func (t *Storage) InsertEntry(key string, value []byte) error {
+	if err := t.checkWritable(); err != nil {
+		return err
+	}
+	if err := checkValueSize(t.name, t.maxValue, value); err != nil {
+		return err
+	}
+	entry, err := valueEntry([]byte(key), value, t.encoding)
 	if err != nil {
 		return err
 	}
-	err = CloseDatabase(db)
-	return err
+	if t.defaultTTL > 0 {
+		entry = entry.WithTTL(t.defaultTTL)
+	}
+	if err = setDbValueEntry(entry, t.db); err != nil {
+		return err
+	}
+	if entry.ExpiresAt > 0 {
+		return t.store.indexExpiry(t.name, key, entry.ExpiresAt)
+	}
+	return nil
 }
 
-func (t *Storage) InsertEntry(key string, value []byte) error {
-	return setDbEntry([]byte(key), value, t.db)
+// UpdateEntry stores value under key like InsertEntry, and records it in the
+// event log as an update rather than a write.
+func (s *Store) UpdateEntry(dbName string, key string, value []byte) (err error) {
+	defer s.observeOpResult(dbName, "UpdateEntry", time.Now(), &err)
+	if err := s.insertEntry(context.Background(), dbName, key, value); err != nil {
+		return err
+	}
+	_ = s.writeDbEvent(EventTypeUpdate, dbName, "Updated entry: "+dbName+":"+key)
+	return nil
 }
 
-func UpdateEntry(dbName string, key string, value []byte) error {
-	return InsertEntry(dbName, key, value)
+// UpdateEntry calls Store.UpdateEntry on the default store.
+func UpdateEntry(dbName string, key string, value []byte) (err error) {
+	return defaultStore.UpdateEntry(dbName, key, value)
 }
 
 func (t *Storage) UpdateEntry(key string, value []byte) error {
-	return setDbEntry([]byte(key), value, t.db)
+	return t.InsertEntry(key, value)
+}
+
+// RemoveEntry removes key, and the metadata InsertEntryWithMeta stored with
+// it, in one transaction.
+func (s *Store) RemoveEntry(dbName string, key string) error {
+	return s.RemoveEntryContext(context.Background(), dbName, key)
 }
 
+// RemoveEntry calls Store.RemoveEntry on the default store.
 func RemoveEntry(dbName string, key string) error {
-	dbObject, err := getMetaDbObject(dbName)
-	if err != nil {
+	return defaultStore.RemoveEntry(dbName, key)
+}
+
+// RemoveEntryContext is RemoveEntry giving up with ctx's error if ctx is
+// done before the delete starts.
+func (s *Store) RemoveEntryContext(ctx context.Context, dbName string, key string) (err error) {
+	defer s.observeOpResult(dbName, "RemoveEntry", time.Now(), &err)
+	if err = checkKey(key); err != nil {
 		return err
 	}
-	if !dbObject.Active {
-		return errors.New(dbName + " - " + errDbInactive)
-	}
-	dbKey, err := getDbKey(dbName, dbObject)
+	db, _, err := s.openWritableDbByName(dbName)
 	if err != nil {
 		return err
 	}
-	dbPath := path.Join(dbObject.DbPath, dbObject.DbFile)
-	var db *badger.DB
-	if dbObject.Secure {
-		db, err = OpenDatabase(dbPath, dbKey)
-	} else {
-		db, err = openUnsecuredDb(dbPath)
-	}
-	if err != nil {
+	if err = ctx.Err(); err != nil {
+		_ = s.releaseDb(dbName, db)
 		return err
 	}
 
 	err = db.Update(func(txn *badger.Txn) error {
-		return txn.Delete([]byte(key))
+		if err := txn.Delete([]byte(key)); err != nil {
+			return err
+		}
+		return deleteEntryMeta(txn, key)
 	})
 	if err != nil {
+		_ = s.releaseDb(dbName, db)
 		return err
 	}
-	_ = writeMetaEvent(EventTypeDelete, "Deleted entry: "+dbName+":"+key)
+	_ = s.writeDbEvent(EventTypeDelete, dbName, "Deleted entry: "+dbName+":"+key)
 
-	err = CloseDatabase(db)
+	err = s.releaseDb(dbName, db)
 	return err
 }
 
+// RemoveEntryContext calls Store.RemoveEntryContext on the default store.
+func RemoveEntryContext(ctx context.Context, dbName string, key string) (err error) {
+	return defaultStore.RemoveEntryContext(ctx, dbName, key)
+}
+
 func (t *Storage) RemoveEntry(key string) error {
+	if err := t.checkWritable(); err != nil {
+		return err
+	}
+	if err := checkKey(key); err != nil {
+		return err
+	}
 	err := t.db.Update(func(txn *badger.Txn) error {
-		return txn.Delete([]byte(key))
+		if err := txn.Delete([]byte(key)); err != nil {
+			return err
+		}
+		return deleteEntryMeta(txn, key)
 	})
-	_ = writeMetaEvent(EventTypeDelete, "Deleted entry: "+t.file+":"+key)
+	_ = t.store.writeDbEvent(EventTypeDelete, t.name, "Deleted entry: "+t.file+":"+key)
 	return err
 
 }
 
+func (s *Store) BatchInsert(dbName string, entries map[string][]byte) error {
+	return s.BatchInsertContext(context.Background(), dbName, entries)
+}
+
+// BatchInsert calls Store.BatchInsert on the default store.
 func BatchInsert(dbName string, entries map[string][]byte) error {
-	dbObject, err := getMetaDbObject(dbName)
+	return defaultStore.BatchInsert(dbName, entries)
+}
+
+// BatchInsertContext is BatchInsert stopping once ctx is done: the entries
+// staged by then are flushed, the rest left out, and ctx's error returned.
+func (s *Store) BatchInsertContext(ctx context.Context, dbName string, entries map[string][]byte) (err error) {
+	defer s.observeOpResult(dbName, "BatchInsert", time.Now(), &err)
+	stop, err := s.startBatch()
 	if err != nil {
 		return err
 	}
-	if !dbObject.Active {
-		return errors.New(dbName + " - " + errDbInactive)
-	}
-	dbKey, err := getDbKey(dbName, dbObject)
+	defer s.endBatch()
+	db, dbObject, err := s.openWritableDbByName(dbName)
 	if err != nil {
 		return err
 	}
-	dbPath := path.Join(dbObject.DbPath, dbObject.DbFile)
-	var db *badger.DB
-	if dbObject.Secure {
-		db, err = OpenDatabase(dbPath, dbKey)
-	} else {
-		db, err = openUnsecuredDb(dbPath)
+	if err = checkKeys(dbName, entries); err != nil {
+		_ = s.releaseDb(dbName, db)
+		return err
+	}
+	if err = checkValueSizes(dbName, dbObject.MaxValueSize, entries); err != nil {
+		_ = s.releaseDb(dbName, db)
+		return err
+	}
+
+	expiresAt := defaultExpiry(dbObject.DefaultTTL)
+	err = batchInsertGeneric(&entries, s.writeEncoding(dbObject), expiresAt, db, batchHalt(ctx, stop))
+	closeErr := s.releaseDb(dbName, db)
+	if expiresAt > 0 {
+		// keys left out after a halt are indexed too; PurgeExpired drops them
+		err = errors.Join(err, s.indexExpiries(dbName, entries, expiresAt))
 	}
 	if err != nil {
 		return err
 	}
+	return closeErr
+}
+
+// BatchInsertContext calls Store.BatchInsertContext on the default store.
+func BatchInsertContext(ctx context.Context, dbName string, entries map[string][]byte) (err error) {
+	return defaultStore.BatchInsertContext(ctx, dbName, entries)
+}
 
-	err = batchInsertGeneric(&entries, db)
+// BatchInsertDetailed behaves like BatchInsert but reports the outcome of
+// every key, so callers can retry only the entries that failed.
+func (s *Store) BatchInsertDetailed(dbName string, entries map[string][]byte) (BatchResult, error) {
+	defer s.observeOp(dbName, "BatchInsertDetailed", time.Now())
+	stop, err := s.startBatch()
+	if err != nil {
+		return BatchResult{Total: len(entries)}, err
+	}
+	defer s.endBatch()
+	db, dbObject, err := s.openWritableDbByName(dbName)
+	if err != nil {
+		return BatchResult{Total: len(entries)}, err
+	}
+	// oversized values fail on their own, the rest are written
+	var tooLarge []BatchFailure
+	if dbObject.MaxValueSize > 0 {
+		allowed := make(map[string][]byte, len(entries))
+		for key, value := range entries {
+			if sizeErr := checkValueSize(dbName, dbObject.MaxValueSize, value); sizeErr != nil {
+				tooLarge = append(tooLarge, BatchFailure{Key: key, Reason: sizeErr.Error()})
+				continue
+			}
+			allowed[key] = value
+		}
+		entries = allowed
+	}
+	expiresAt := defaultExpiry(dbObject.DefaultTTL)
+	result, err := batchInsertDetailedGeneric(&entries, s.writeEncoding(dbObject), expiresAt, db, batchHalt(context.Background(), stop))
+	result.Total += len(tooLarge)
+	result.Failed = append(result.Failed, tooLarge...)
+	closeErr := s.releaseDb(dbName, db)
+	if expiresAt > 0 {
+		// failed keys are indexed too; PurgeExpired drops them
+		err = errors.Join(err, s.indexExpiries(dbName, entries, expiresAt))
+	}
+	if err != nil {
+		return result, err
+	}
+	return result, closeErr
+}
+
+// BatchInsertDetailed calls Store.BatchInsertDetailed on the default store.
+func BatchInsertDetailed(dbName string, entries map[string][]byte) (BatchResult, error) {
+	return defaultStore.BatchInsertDetailed(dbName, entries)
+}
+
+// BatchDelete removes keys, and their metadata, from dbName in a single
+// transaction, so either all of them are removed or none are. Keys that
+// aren't there are ignored. A set too large for one badger transaction fails
+// with badger.ErrTxnTooBig; use DeleteRange for bulk removals.
+func (s *Store) BatchDelete(dbName string, keys []string) (err error) {
+	defer s.observeOpResult(dbName, "BatchDelete", time.Now(), &err)
+	for _, key := range keys {
+		if err = checkKey(key); err != nil {
+			return fmt.Errorf("%s - %w", dbName, err)
+		}
+	}
+	db, _, err := s.openWritableDbByName(dbName)
+	if err != nil {
+		return err
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		for _, key := range keys {
+			if err := txn.Delete([]byte(key)); err != nil {
+				return err
+			}
+			if err := deleteEntryMeta(txn, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	closeErr := s.releaseDb(dbName, db)
 	if err != nil {
 		return err
 	}
+	_ = s.writeDbEvent(EventTypeDelete, dbName, "Deleted batch of "+strconv.Itoa(len(keys))+" entries: "+dbName)
+	return closeErr
+}
 
-	err = CloseDatabase(db)
-	return err
+// BatchDelete calls Store.BatchDelete on the default store.
+func BatchDelete(dbName string, keys []string) (err error) {
+	return defaultStore.BatchDelete(dbName, keys)
 }
 
 func (t *Storage) BatchInsert(entries *map[string][]byte) error {
-	err := batchInsertGeneric(entries, t.db)
-	_ = writeMetaEvent(EventTypeWrite, "Wrote batch data to db: "+t.file)
+	if err := t.checkWritable(); err != nil {
+		return err
+	}
+	stop, err := t.store.startBatch()
+	if err != nil {
+		return err
+	}
+	defer t.store.endBatch()
+	if err = checkKeys(t.name, *entries); err != nil {
+		return err
+	}
+	if err = checkValueSizes(t.name, t.maxValue, *entries); err != nil {
+		return err
+	}
+	expiresAt := defaultExpiry(t.defaultTTL)
+	err = batchInsertGeneric(entries, t.encoding, expiresAt, t.db, batchHalt(context.Background(), stop))
+	if expiresAt > 0 {
+		err = errors.Join(err, t.store.indexExpiries(t.name, *entries, expiresAt))
+	}
+	_ = t.store.writeDbEvent(EventTypeWrite, t.name, "Wrote batch data to db: "+t.file)
 	return err
 }
 
+// GetEntry returns the value stored under key. If the key is missing and a
+// loader was registered with SetLoader, the loader's value is stored and
+// returned instead.
+func (s *Store) GetEntry(dbName string, key string) ([]byte, error) {
+	return s.GetEntryContext(context.Background(), dbName, key)
+}
+
+// GetEntry calls Store.GetEntry on the default store.
 func GetEntry(dbName string, key string) ([]byte, error) {
-	dbObject, err := getMetaDbObject(dbName)
+	return defaultStore.GetEntry(dbName, key)
+}
+
+// GetEntryContext is GetEntry giving up with ctx's error if ctx is done
+// before the read starts.
+func (s *Store) GetEntryContext(ctx context.Context, dbName string, key string) (value []byte, err error) {
+	defer s.observeOpResult(dbName, "GetEntry", time.Now(), &err)
+	value, err = s.getEntry(ctx, dbName, key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		if l, ok := s.getLoader(dbName); ok {
+			return s.loadThrough(dbName, key, l)
+		}
+	}
+	if err == nil && s.config != nil && s.config.AuditReads {
+		_ = s.writeDbEvent(EventTypeRead, dbName, "Read entry: "+dbName+":"+key)
+	}
+	return value, err
+}
+
+// GetEntryContext calls Store.GetEntryContext on the default store.
+func GetEntryContext(ctx context.Context, dbName string, key string) (value []byte, err error) {
+	return defaultStore.GetEntryContext(ctx, dbName, key)
+}
+
+// GetEntryOrDefault is GetEntry returning def when key isn't in dbName, so
+// callers needn't pick badger's not-found error out of the real failures. A
+// database that doesn't exist is still an error.
+func (s *Store) GetEntryOrDefault(dbName, key string, def []byte) ([]byte, error) {
+	value, err := s.GetEntry(dbName, key)
+	if isEntryNotFound(err) {
+		return def, nil
+	}
+	return value, err
+}
+
+// GetEntryOrDefault calls Store.GetEntryOrDefault on the default store.
+func GetEntryOrDefault(dbName, key string, def []byte) ([]byte, error) {
+	return defaultStore.GetEntryOrDefault(dbName, key, def)
+}
+
+// isEntryNotFound reports whether err is badger not finding an entry, as
+// opposed to not finding the database's meta entry.
+func isEntryNotFound(err error) bool {
+	var metaErr *EMetaKeyNotFound
+	return errors.Is(err, badger.ErrKeyNotFound) && !errors.As(err, &metaErr)
+}
+
+func (s *Store) getEntry(ctx context.Context, dbName string, key string) ([]byte, error) {
+	db, _, err := s.openDbByName(dbName)
 	if err != nil {
 		return nil, err
 	}
-	if !dbObject.Active {
-		return nil, errors.New(dbName + " - " + errDbInactive)
+	if err = ctx.Err(); err != nil {
+		_ = s.releaseDb(dbName, db)
+		return nil, err
 	}
-	dbKey, err := getDbKey(dbName, dbObject)
+	value, err := getDbEntry([]byte(key), db)
 	if err != nil {
+		// a missing key must not leave the db open
+		_ = s.releaseDb(dbName, db)
 		return nil, err
 	}
+	err = s.releaseDb(dbName, db)
+	return value, err
+}
 
-	dbPath := path.Join(dbObject.DbPath, dbObject.DbFile)
-	var db *badger.DB
-	if dbObject.Secure {
-		db, err = OpenDatabase(dbPath, dbKey)
-	} else {
-		db, err = openUnsecuredDb(dbPath)
+// ViewEntry calls fn with the value stored under key without copying it out
+// of badger, for readers that process values inline and want to skip
+// GetEntry's allocation. val is only valid until fn returns: it must not be
+// kept, appended to, or handed to another goroutine, and anything that
+// outlives fn needs its own copy. fn's error is returned as is. Loaders
+// registered with SetLoader aren't consulted.
+func (s *Store) ViewEntry(dbName string, key string, fn func(val []byte) error) error {
+	defer s.observeOp(dbName, "ViewEntry", time.Now())
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		return err
+	}
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		if itemExpired(item) {
+			return badger.ErrKeyNotFound
+		}
+		return item.Value(func(val []byte) error {
+			value, err := decodeValue(val, item.UserMeta())
+			if err != nil {
+				return err
+			}
+			return fn(value)
+		})
+	})
+	closeErr := s.releaseDb(dbName, db)
+	if err == nil {
+		err = closeErr
 	}
+	return err
+}
+
+// ViewEntry calls Store.ViewEntry on the default store.
+func ViewEntry(dbName string, key string, fn func(val []byte) error) error {
+	return defaultStore.ViewEntry(dbName, key, fn)
+}
+
+// Exists reports whether key is present in dbName without reading its value.
+func (s *Store) Exists(dbName string, key string) (bool, error) {
+	db, _, err := s.openDbByName(dbName)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	value, err := getDbEntry([]byte(key), db)
+	found, err := dbHasKey([]byte(key), db)
+	closeErr := s.releaseDb(dbName, db)
+	if err == nil {
+		err = closeErr
+	}
+	return found, err
+}
+
+// Exists calls Store.Exists on the default store.
+func Exists(dbName string, key string) (bool, error) {
+	return defaultStore.Exists(dbName, key)
+}
+
+func (t *Storage) Exists(key string) (bool, error) {
+	if err := t.checkReadable(); err != nil {
+		return false, err
+	}
+	return dbHasKey([]byte(key), t.db)
+}
+
+func dbHasKey(key []byte, db *badger.DB) (bool, error) {
+	found := false
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = !itemExpired(item)
+		return nil
+	})
+	return found, err
+}
+
+// BatchGet reads keys from dbName in one transaction. Missing keys are left
+// out of the result; GetMissing also lists which ones they were.
+func (s *Store) BatchGet(dbName string, keys []string) (map[string][]byte, error) {
+	present, _, err := s.GetMissing(dbName, keys)
+	return present, err
+}
+
+// BatchGet calls Store.BatchGet on the default store.
+func BatchGet(dbName string, keys []string) (map[string][]byte, error) {
+	return defaultStore.BatchGet(dbName, keys)
+}
+
+// GetMissing looks keys up in one read transaction and splits them into the
+// values of those present and, in the order given, those that are absent,
+// for cache-aside callers that only load what's missing. Keys listed
+// more than once are reported once.
+func (s *Store) GetMissing(dbName string, keys []string) (present map[string][]byte, missing []string, err error) {
+	defer s.observeOp(dbName, "GetMissing", time.Now())
+	db, _, err := s.openDbByName(dbName)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	err = CloseDatabase(db)
-	return value, err
+	present = make(map[string][]byte)
+	missing = make([]string, 0)
+	err = db.View(func(txn *badger.Txn) error {
+		seen := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			item, err := txn.Get([]byte(key))
+			if errors.Is(err, badger.ErrKeyNotFound) || err == nil && itemExpired(item) {
+				missing = append(missing, key)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			value, err := itemValue(item)
+			if err != nil {
+				return err
+			}
+			present[key] = value
+		}
+		return nil
+	})
+	closeErr := s.releaseDb(dbName, db)
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return present, missing, nil
+}
+
+// GetMissing calls Store.GetMissing on the default store.
+func GetMissing(dbName string, keys []string) (present map[string][]byte, missing []string, err error) {
+	return defaultStore.GetMissing(dbName, keys)
 }
 
 func (t *Storage) GetEntry(key string) ([]byte, error) {
+	if err := t.checkReadable(); err != nil {
+		return nil, err
+	}
 	return getDbEntry([]byte(key), t.db)
 }
 
+// GetEntryOrDefault is GetEntry returning def when key isn't stored.
+func (t *Storage) GetEntryOrDefault(key string, def []byte) ([]byte, error) {
+	value, err := t.GetEntry(key)
+	if isEntryNotFound(err) {
+		return def, nil
+	}
+	return value, err
+}
+
 func (t *Storage) All() (map[string][]byte, error) {
+	if err := t.checkReadable(); err != nil {
+		return nil, err
+	}
 	m := make(map[string][]byte)
 	db := t.db
 	stream := db.NewStream()
@@ -962,7 +2249,15 @@ func (t *Storage) All() (map[string][]byte, error) {
 			if err := proto.Unmarshal(slice, kv); err != nil {
 				return err
 			}
-			m[string(kv.Key)] = kv.Value
+			var userMeta byte
+			if len(kv.UserMeta) > 0 {
+				userMeta = kv.UserMeta[0]
+			}
+			value, err := decodeValue(kv.Value, userMeta)
+			if err != nil {
+				return err
+			}
+			m[string(kv.Key)] = value
 			return nil
 		})
 	}
@@ -970,30 +2265,69 @@ func (t *Storage) All() (map[string][]byte, error) {
 	return m, err
 }
 
+// ListDatabases returns the meta keys of the registered databases, leaving
+// out those taken out of use by SoftDeleteDatabase; ListAllDatabases
+// includes them.
+func (s *Store) ListDatabases() ([]string, error) {
+	return s.ListDatabasesContext(context.Background())
+}
+
+// ListDatabases calls Store.ListDatabases on the default store.
 func ListDatabases() ([]string, error) {
-	if metaStorage.rotatingKey {
-		return nil, errors.New(errDbRotating)
+	return defaultStore.ListDatabases()
+}
+
+// ListDatabasesContext is ListDatabases stopping with ctx's error once ctx
+// is done.
+func (s *Store) ListDatabasesContext(ctx context.Context) ([]string, error) {
+	return s.listDatabaseKeys(ctx, false)
+}
+
+// ListDatabasesContext calls Store.ListDatabasesContext on the default store.
+func ListDatabasesContext(ctx context.Context) ([]string, error) {
+	return defaultStore.ListDatabasesContext(ctx)
+}
+
+// ListAllDatabases is ListDatabases with the soft-deleted databases included.
+func (s *Store) ListAllDatabases() ([]string, error) {
+	return s.listDatabaseKeys(context.Background(), true)
+}
+
+// ListAllDatabases calls Store.ListAllDatabases on the default store.
+func ListAllDatabases() ([]string, error) {
+	return defaultStore.ListAllDatabases()
+}
+
+func (s *Store) listDatabaseKeys(ctx context.Context, includeDeleted bool) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
-	db, err := OpenDatabase(metaPath, metaStorage.key)
+	db, err := s.openMeta()
 	if err != nil {
 		return nil, err
 	}
-	defer func(db *badger.DB) {
-		err = db.Close()
-		if err != nil {
-			log.Println("Error closing meta database: ", err)
-		}
-	}(db)
+	defer s.releaseMeta()
 	var dbList []string
 	err = db.View(func(txn *badger.Txn) error {
 		iterator := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer iterator.Close()
 		prefix := []byte(prefixMetaDb)
 		for iterator.Seek(prefix); iterator.ValidForPrefix(prefix); iterator.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			item := iterator.Item()
 			key := string(item.Key())
 			err := item.Value(func(v []byte) error {
+				if !includeDeleted {
+					var dbObject DbObject
+					if err := json.Unmarshal(v, &dbObject); err != nil {
+						return err
+					}
+					if dbObject.Deleted != 0 {
+						return nil
+					}
+				}
 				dbList = append(dbList, key)
 				return nil
 			})
@@ -1006,41 +2340,82 @@ func ListDatabases() ([]string, error) {
 	return dbList, err
 }
 
-func NewStorage(db *badger.DB, path string, file string, key []byte, rotating bool) *Storage {
+// NewStorage wraps an already opened badger db. The result is treated as an
+// active, writable database.
+func (s *Store) NewStorage(db *badger.DB, path string, file string, key []byte, rotating bool) *Storage {
 	return &Storage{
+		store:       s,
 		db:          db,
 		path:        path,
 		file:        file,
 		key:         key,
 		rotatingKey: rotating,
+		name:        file,
+		active:      true,
 	}
 }
 
-func ListConfigurations() (*Config, error) {
-	if metaStorage.rotatingKey {
+// NewStorage calls Store.NewStorage on the default store.
+func NewStorage(db *badger.DB, path string, file string, key []byte, rotating bool) *Storage {
+	return defaultStore.NewStorage(db, path, file, key, rotating)
+}
+
+func (s *Store) ListConfigurations() (*Config, error) {
+	if s.meta.rotatingKey {
 		return nil, errors.New(errDbRotating)
 	}
 
-	dbEntry, err := getMetaEntry(prefixMetaConfig)
+	dbEntry, err := s.getMetaEntry(prefixMetaConfig)
 	if err != nil {
 		return nil, err
 	}
-	config := &Config{}
-	err = json.Unmarshal(dbEntry, config)
-	if err != nil {
-		return nil, err
+	return s.decodeConfig(dbEntry)
+}
+
+// ListConfigurations calls Store.ListConfigurations on the default store.
+func ListConfigurations() (*Config, error) {
+	return defaultStore.ListConfigurations()
+}
+
+// CurrentConfig returns a copy of the cached store configuration. The cache is
+// filled at Startup and kept in step by UpdateConfigurations, so the meta db is
+// only read here when nothing has been cached yet.
+func (s *Store) CurrentConfig() (*Config, error) {
+	if s.config == nil {
+		config, err := s.getMetaConfig()
+		if err != nil {
+			return nil, err
+		}
+		s.config = config
 	}
-	return config, nil
+	config := *s.config
+	return &config, nil
 }
 
-func UpdateConfigurations(config *Config) error {
-	err := WriteMetaConfig(config)
+// CurrentConfig calls Store.CurrentConfig on the default store.
+func CurrentConfig() (*Config, error) {
+	return defaultStore.CurrentConfig()
+}
+
+func (s *Store) UpdateConfigurations(config *Config) error {
+	// the check would compete for meta while it is written
+	s.stopIntegrityChecks()
+	err := s.WriteMetaConfig(config)
 	if err == nil {
-		fxConfig = config
+		// keep our own copy so later changes by the caller don't leak into the cache
+		cached := *config
+		s.config = &cached
+	}
+	s.startupMu.Lock()
+	running := s.started
+	s.startupMu.Unlock()
+	if running && s.config != nil {
+		s.startIntegrityChecks(s.config.IntegrityCheckInterval)
 	}
 	return err
 }
 
-func Cache(value []byte, duration time.Duration) error {
-	return nil
+// UpdateConfigurations calls Store.UpdateConfigurations on the default store.
+func UpdateConfigurations(config *Config) error {
+	return defaultStore.UpdateConfigurations(config)
 }
@@ -1,16 +1,23 @@
 package cachekv
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"log"
 	"maps"
+	"math"
 	"math/rand"
 	randv2 "math/rand/v2"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/dgraph-io/badger/v4"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
@@ -21,10 +28,15 @@ func setup() func() {
 	StorePath = "./test-store/"
 	KeyPath = "./.test-private/"
 	var err error
-	Startup()
+	if err = Startup(); err != nil {
+		log.Println("error starting test store: ", err)
+	}
 	// teardown
 	return func() {
-		metaPath := path.Join(metaStorage.path, metaStorage.file)
+		if err := Shutdown(); err != nil {
+			log.Println("error shutting down test store: ", err)
+		}
+		metaPath := path.Join(defaultStore.meta.path, defaultStore.meta.file)
 		_, err = os.Stat(metaPath)
 		if err == nil {
 			err = os.RemoveAll(metaPath)
@@ -54,33 +66,97 @@ func TestRandomValues(t *testing.T) {
 	assert.Equal(t, 32, len(value))
 }
 
+// fixClock pins the package clock at start. The returned advance moves it on;
+// restore puts the real clock back.
+func fixClock(start time.Time) (advance func(time.Duration), restore func()) {
+	current := start
+	clock = func() time.Time {
+		return current
+	}
+	return func(d time.Duration) {
+			current = current.Add(d)
+		}, func() {
+			clock = time.Now
+		}
+}
+
 func TestInit(t *testing.T) {
 	defer setup()()
-	assert.True(t, checkMetaFile())
-	assert.NotNil(t, metaStorage.db)
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
+	assert.True(t, defaultStore.checkMetaFile())
+	assert.NotNil(t, defaultStore.meta.db)
+	metaPath := path.Join(defaultStore.meta.path, defaultStore.meta.file)
 	_, err := os.Stat(metaPath)
 	assert.Nil(t, err)
 }
 
+func TestStartupOnce(t *testing.T) {
+	defer setup()()
+	metaKey := defaultStore.meta.key
+	keyDbKey := defaultStore.key.key
+	// a second call leaves the loaded store alone
+	defaultStore.meta.key = nil
+	assert.Nil(t, Startup())
+	assert.Nil(t, defaultStore.meta.key)
+	defaultStore.meta.key = metaKey
+
+	assert.Nil(t, Shutdown())
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, Startup())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, metaKey, defaultStore.meta.key)
+	assert.Equal(t, keyDbKey, defaultStore.key.key)
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, InsertEntry("testdb", "key", []byte("value")))
+	value, err := GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+}
+
+func TestStartupUnwritableStorePath(t *testing.T) {
+	// a file where the store's parent directory should be; permissions
+	// don't keep root out, this does
+	notADir := "./test-not-a-dir"
+	assert.Nil(t, os.WriteFile(notADir, []byte("file"), 0644))
+	defer os.Remove(notADir)
+	storePath, keyPath := StorePath, KeyPath
+	StorePath, KeyPath = notADir+"/store/", notADir+"/private/"
+	defer func() {
+		StorePath, KeyPath = storePath, keyPath
+	}()
+	assert.NotNil(t, Startup())
+	assert.Panics(t, MustStartup)
+	// still not started, so a Startup somewhere sensible loads it
+	StorePath, KeyPath = "./test-store/", "./.test-private/"
+	defer os.RemoveAll(StorePath)
+	defer os.RemoveAll(KeyPath)
+	assert.Nil(t, Startup())
+	assert.Nil(t, Shutdown())
+}
+
 func TestSetGetMetaEntry(t *testing.T) {
 	defer setup()()
-	assert.Nil(t, writeMetaEntry("testkey", []byte("testvalue")))
-	value, err := getMetaEntry("testkey")
+	assert.Nil(t, defaultStore.writeMetaEntry("testkey", []byte("testvalue")))
+	value, err := defaultStore.getMetaEntry("testkey")
 	assert.Nil(t, err)
 	assert.Equal(t, value, []byte("testvalue"))
 }
 
 func TestDifferentEncryptionKeys(t *testing.T) {
 	defer setup()()
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
-	assert.Nil(t, writeMetaEntry("testkey", []byte("testvalue")))
-	time.Sleep(2 * time.Second)
-	value, err := getMetaEntry("testkey")
+	metaPath := path.Join(defaultStore.meta.path, defaultStore.meta.file)
+	assert.Nil(t, defaultStore.writeMetaEntry("testkey", []byte("testvalue")))
+	value, err := defaultStore.getMetaEntry("testkey")
 	assert.Nil(t, err)
 	assert.NotNil(t, value)
 	assert.Equal(t, value, []byte("testvalue"))
 	metaKey, _ := randomValues(32)
+	assert.Nil(t, defaultStore.closeInternalDbs())
 	db, err := OpenDatabase(metaPath, metaKey)
 	assert.NotNil(t, err)
 	assert.Nil(t, db)
@@ -88,17 +164,16 @@ func TestDifferentEncryptionKeys(t *testing.T) {
 
 func TestCopyMetasTwoRecords(t *testing.T) {
 	defer setup()()
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
-	oldDb, err := OpenDatabase(metaPath, metaStorage.key)
+	oldDb, err := defaultStore.openMeta()
+	assert.Nil(t, err)
 	assert.Nil(t, setDbEntry([]byte("prefix:testkey"), []byte("testvalue"), oldDb))
 	assert.Nil(t, setDbEntry([]byte("prefix:testkey2"), []byte("testvalue2"), oldDb))
 	keys, err := countRecords("prefix:", oldDb, true)
 	assert.Nil(t, err)
 	assert.Equal(t, 2, keys)
-	err = CloseDatabase(oldDb)
-	assert.Nil(t, err)
-	newPath, newKey, err := copyMetas()
-	newMetaPath := path.Join(metaStorage.path, newPath)
+	defaultStore.releaseMeta()
+	newPath, newKey, err := defaultStore.copyMetas()
+	newMetaPath := path.Join(defaultStore.meta.path, newPath)
 	newDb, err := OpenDatabase(newMetaPath, newKey)
 	assert.Nil(t, err)
 	assert.NotNil(t, newDb)
@@ -109,6 +184,19 @@ func TestCopyMetasTwoRecords(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestCopyMetasStorePathWithoutSlash(t *testing.T) {
+	defer setup()()
+	dir := "./test-store-noslash"
+	defer func() { _ = os.RemoveAll(dir) }()
+	s, err := NewStore(WithStorePath(dir), WithKeyPath(path.Join(dir, "private")))
+	assert.Nil(t, err)
+	defer func() { _ = s.Shutdown() }()
+	newFile, _, err := s.copyMetas()
+	assert.Nil(t, err)
+	assert.DirExists(t, path.Join(dir, newFile))
+	assert.NoDirExists(t, dir+newFile)
+}
+
 func TestCopyMetas(t *testing.T) {
 	defer setup()()
 	newMeta, _ := randomValues(32)
@@ -130,11 +218,11 @@ func TestCopyMetas(t *testing.T) {
 	end := time.Now()
 	duration := end.Sub(start)
 	log.Printf("data generation completed in %d seconds", int(duration.Seconds()))
-	assert.Nil(t, initMetaDb())
-	err := metaBatchInsert(&values)
+	assert.Nil(t, defaultStore.initMetaDb())
+	err := defaultStore.metaBatchInsert(&values)
+	assert.Nil(t, err)
+	oldDb, err := defaultStore.openMeta()
 	assert.Nil(t, err)
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
-	oldDb, err := OpenDatabase(metaPath, metaStorage.key)
 	records, err := countRecords("prefix:", oldDb, false)
 	assert.Nil(t, err)
 	assert.Equal(t, records, n)
@@ -145,10 +233,9 @@ func TestCopyMetas(t *testing.T) {
 		assert.NotNil(t, value)
 		assert.Equal(t, value, v)
 	}
-	err = CloseDatabase(oldDb)
-	assert.Nil(t, err)
+	defaultStore.releaseMeta()
 	start = time.Now()
-	newPath, newKey, err := copyMetas()
+	newPath, newKey, err := defaultStore.copyMetas()
 	end = time.Now()
 	assert.Nil(t, err)
 	duration = end.Sub(start)
@@ -177,7 +264,7 @@ func TestDefaultConfig(t *testing.T) {
 	assert.True(t, cfg.SecureNewDb)
 	assert.Equal(t, StorePath, cfg.StorePath)
 	assert.Equal(t, StorePath, cfg.MetaStore)
-	assert.Equal(t, metaStorage.file, cfg.MetaFile)
+	assert.Equal(t, defaultStore.meta.file, cfg.MetaFile)
 }
 
 func TestUpdateConfigurations(t *testing.T) {
@@ -187,7 +274,7 @@ func TestUpdateConfigurations(t *testing.T) {
 	assert.True(t, cfg.SecureNewDb)
 	assert.Equal(t, StorePath, cfg.StorePath)
 	assert.Equal(t, StorePath, cfg.MetaStore)
-	assert.Equal(t, metaStorage.file, cfg.MetaFile)
+	assert.Equal(t, defaultStore.meta.file, cfg.MetaFile)
 	// change the config
 	newStorePath := "/var/tmp/blah"
 	newMetaFile := "blah-blah.meta"
@@ -206,11 +293,29 @@ func TestUpdateConfigurations(t *testing.T) {
 	assert.Equal(t, newMetaStore, cfg2.MetaStore)
 }
 
+func TestConfigMissingFieldsDefault(t *testing.T) {
+	defer setup()()
+	// a config stored before secure_new_db and meta_file existed
+	assert.Nil(t, defaultStore.writeMetaEntry(prefixMetaConfig, []byte(`{"store_path":"/var/tmp/blah","deterministic_dir_names":false}`)))
+	cfg, err := ListConfigurations()
+	assert.Nil(t, err)
+	assert.Equal(t, "/var/tmp/blah", cfg.StorePath)
+	assert.True(t, cfg.SecureNewDb)
+	assert.Equal(t, StorePath, cfg.MetaStore)
+	assert.Equal(t, defaultStore.meta.file, cfg.MetaFile)
+
+	// stored zero values aren't replaced
+	assert.Nil(t, defaultStore.writeMetaEntry(prefixMetaConfig, []byte(`{"store_path":"/var/tmp/blah","secure_new_db":false}`)))
+	cfg, err = ListConfigurations()
+	assert.Nil(t, err)
+	assert.False(t, cfg.SecureNewDb)
+}
+
 func TestKeyring(t *testing.T) {
 	defer setup()()
 	err := WriteToKeyring("user", []byte("pass"))
 	assert.Nil(t, err)
-	pwd, err := getFromKeyring("user")
+	pwd, err := defaultStore.getFromKeyring("user")
 	assert.Nil(t, err)
 	assert.Equal(t, "pass", string(pwd))
 }
@@ -230,16 +335,16 @@ func TestCreateAndListDatabases(t *testing.T) {
 	// create database
 	err = CreateDatabase(testdb1, true)
 	assert.Nil(t, err)
-	_, err = getFromKeyring(prefixMetaDb + testdb1)
+	_, err = defaultStore.getFromKeyring(prefixMetaDb + testdb1)
 	assert.Nil(t, err)
 	err = CreateDatabase(testdb2, false)
 	assert.Nil(t, err)
-	_, err = getFromKeyring(prefixMetaDb + testdb2)
+	_, err = defaultStore.getFromKeyring(prefixMetaDb + testdb2)
 	assert.NotNil(t, err)
 	listDbs, err := ListDatabases()
 	assert.Nil(t, err)
 	assert.Greater(t, len(listDbs), 0)
-	listAllDbs, err := listDatabases()
+	listAllDbs, err := defaultStore.listDatabases()
 	assert.Nil(t, err)
 	assert.Greater(t, len(listAllDbs), 0)
 	for _, db := range listDbs {
@@ -252,11 +357,11 @@ func TestCreateAndListDatabases(t *testing.T) {
 		assert.Nil(t, err)
 		// check for key in keyring
 		if dbInfo.Secure {
-			fromKeyring, err := getFromKeyring(db)
+			fromKeyring, err := defaultStore.getFromKeyring(db)
 			assert.Nil(t, err)
 			assert.Greater(t, len(fromKeyring), 0)
 		} else {
-			_, err = getFromKeyring(db)
+			_, err = defaultStore.getFromKeyring(db)
 			assert.NotNil(t, err)
 		}
 	}
@@ -296,6 +401,231 @@ func TestInsertAndGetEntry(t *testing.T) {
 	assert.Equal(t, string(dataValue), string(getValue))
 }
 
+func TestViewEntry(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	var seen string
+	assert.Nil(t, ViewEntry(testDb, "key", func(val []byte) error {
+		seen = string(val)
+		return nil
+	}))
+	assert.Equal(t, "value", seen)
+	stop := errors.New("stop")
+	assert.ErrorIs(t, ViewEntry(testDb, "key", func(val []byte) error {
+		return stop
+	}), stop)
+	assert.ErrorIs(t, ViewEntry(testDb, "missing", func(val []byte) error {
+		t.Fatal("fn called for a missing key")
+		return nil
+	}), badger.ErrKeyNotFound)
+	assert.NotNil(t, ViewEntry("missing", "key", func(val []byte) error {
+		return nil
+	}))
+}
+
+func TestGetEntryOrDefault(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	value, err := GetEntryOrDefault(testDb, "key", []byte("fallback"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	value, err = GetEntryOrDefault(testDb, "missing", []byte("fallback"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("fallback"), value)
+	_, err = GetEntryOrDefault("missing", "key", []byte("fallback"))
+	assert.NotNil(t, err)
+
+	storage, err := OpenStorage(testDb)
+	assert.Nil(t, err)
+	value, err = storage.GetEntryOrDefault("missing", []byte("fallback"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("fallback"), value)
+	value, err = storage.GetEntryOrDefault("key", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.Nil(t, storage.Close())
+	_, err = storage.GetEntryOrDefault("key", nil)
+	assert.NotNil(t, err)
+}
+
+func TestExists(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	found, err := Exists(testDb, "key")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	found, err = Exists(testDb, "missing")
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	storage, err := OpenStorage(testDb)
+	assert.Nil(t, err)
+	found, err = storage.Exists("key")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	found, err = storage.Exists("missing")
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Nil(t, storage.Close())
+
+	dbObject, err := defaultStore.getMetaDbObject(testDb)
+	assert.Nil(t, err)
+	dbObject.Active = false
+	assert.Nil(t, defaultStore.writeMetaDbObject(testDb, dbObject, true))
+	_, err = Exists(testDb, "key")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), errDbInactive)
+	storage, err = GetStorageObject(testDb)
+	assert.Nil(t, err)
+	_, err = storage.Exists("key")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), errDbInactive)
+	assert.Nil(t, storage.Close())
+}
+
+func TestStorageClose(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	storage, err := GetStorageObject(testDb)
+	assert.Nil(t, err)
+	assert.Nil(t, storage.InsertEntry("key", []byte("value")))
+	value, err := storage.GetEntry("key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.Nil(t, storage.Close())
+	assert.Nil(t, storage.Close())
+	_, err = storage.GetEntry("key")
+	assert.ErrorContains(t, err, "storage is closed")
+	assert.ErrorContains(t, storage.InsertEntry("key", []byte("value")), "storage is closed")
+
+	// the shared handle is released once however often it's closed
+	storage, err = OpenStorage(testDb)
+	assert.Nil(t, err)
+	assert.Nil(t, storage.Close())
+	assert.Nil(t, storage.Close())
+	_, err = storage.Exists("key")
+	assert.ErrorContains(t, err, "storage is closed")
+	assert.Nil(t, CloseDatabaseByName(testDb))
+	value, err = GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+}
+
+func TestBatchDelete(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	entries := make(map[string][]byte)
+	deleted := make([]string, 0)
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		entries[key] = []byte("value")
+		if i%2 == 0 {
+			deleted = append(deleted, key)
+		}
+	}
+	assert.Nil(t, BatchInsert(testDb, entries))
+	assert.Nil(t, BatchDelete(testDb, append(deleted, "missing")))
+	db, _, err := defaultStore.openDbByName(testDb)
+	assert.Nil(t, err)
+	count, err := countRecords("", db, false)
+	assert.Nil(t, err)
+	assert.Nil(t, defaultStore.releaseDb(testDb, db))
+	assert.Equal(t, 50, count)
+	found, err := Exists(testDb, "key0")
+	assert.Nil(t, err)
+	assert.False(t, found)
+	found, err = Exists(testDb, "key1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+
+	assert.Nil(t, SetReadOnly(testDb, true))
+	assert.ErrorIs(t, BatchDelete(testDb, []string{"key1"}), ErrDbReadOnly)
+}
+
+func TestBatchGet(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	entries := make(map[string][]byte)
+	for i := 0; i < 1000; i++ {
+		entries["key"+strconv.Itoa(i)] = []byte("value" + strconv.Itoa(i))
+	}
+	assert.Nil(t, BatchInsert(testDb, entries))
+	keys := make([]string, 0)
+	for _, i := range rand.Perm(1000)[:100] {
+		keys = append(keys, "key"+strconv.Itoa(i))
+	}
+	keys = append(keys, "missing")
+	values, err := BatchGet(testDb, keys)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(values))
+	for _, key := range keys[:100] {
+		assert.Equal(t, entries[key], values[key])
+	}
+	_, found := values["missing"]
+	assert.False(t, found)
+}
+
+func TestGetMissing(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, BatchInsert(testDb, map[string][]byte{
+		"a": []byte("1"),
+		"c": []byte("3"),
+	}))
+	present, missing, err := GetMissing(testDb, []string{"d", "a", "b", "c", "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"a": []byte("1"), "c": []byte("3")}, present)
+	assert.Equal(t, []string{"d", "b"}, missing)
+	present, missing, err = GetMissing(testDb, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(present))
+	assert.Equal(t, 0, len(missing))
+	_, _, err = GetMissing("missing", []string{"a"})
+	assert.NotNil(t, err)
+}
+
+func TestReadValuesOutliveTransaction(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	entries := make(map[string][]byte)
+	for i := 0; i < 25; i++ {
+		key := "key" + strconv.Itoa(i)
+		entries[key] = []byte(strings.Repeat(key, i%3*400+1))
+		assert.Nil(t, WriteToKeyring("test:"+key, entries[key]))
+	}
+	assert.Nil(t, BatchInsert(testDb, entries))
+	values := make(map[string][]byte)
+	secrets := make(map[string][]byte)
+	for key := range entries {
+		value, err := GetEntry(testDb, key)
+		assert.Nil(t, err)
+		values[key] = value
+		secret, err := defaultStore.getFromKeyring("test:" + key)
+		assert.Nil(t, err)
+		secrets[key] = secret
+		assert.Nil(t, defaultStore.writeMetaEntry("test:"+key, entries[key]))
+		meta, err := defaultStore.getMetaEntry("test:" + key)
+		assert.Nil(t, err)
+		assert.Equal(t, entries[key], meta)
+	}
+	// everything read earlier is still intact
+	for key, expected := range entries {
+		assert.Equal(t, expected, values[key], key)
+		assert.Equal(t, expected, secrets[key], key)
+	}
+}
+
 func TestInsertAndUpdateEntry(t *testing.T) {
 	defer setup()()
 	testDb1 := "testdb1"
@@ -389,11 +719,13 @@ func TestInsertBatch(t *testing.T) {
 	assert.Nil(t, err)
 	log.Printf("Batch insert %d entries completed in %d seconds\n", n, int(duration.Seconds()))
 	// asserting every record is present
-	dbo, err := getMetaDbObject(testDb1)
+	dbo, err := defaultStore.getMetaDbObject(testDb1)
 	assert.Nil(t, err)
-	dbKey, err := getDbKey(testDb1, dbo)
+	dbKey, err := defaultStore.getDbKey(testDb1, dbo)
 	assert.Nil(t, err)
 	dbPath := path.Join(dbo.DbPath, dbo.DbFile)
+	// the package keeps its own handle open, which holds the directory lock
+	assert.Nil(t, CloseDatabaseByName(testDb1))
 	db, err := OpenDatabase(dbPath, dbKey)
 	assert.Nil(t, err)
 	records, err := countRecords("", db, false)
@@ -464,18 +796,20 @@ func TestGetEntryWithinALotOfEntries(t *testing.T) {
 
 func TestInitReloadingExistingMetafile(t *testing.T) {
 	defer setup()()
-	assert.Nil(t, openMetaDb())
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
-	metaDb, err := OpenDatabase(metaPath, metaStorage.key)
+	assert.Nil(t, defaultStore.openMetaDb())
+	// the shared handles hold the directories
+	assert.Nil(t, defaultStore.closeInternalDbs())
+	metaPath := path.Join(defaultStore.meta.path, defaultStore.meta.file)
+	metaDb, err := OpenDatabase(metaPath, defaultStore.meta.key)
 	assert.Nil(t, err)
 	assert.NotNil(t, metaDb)
 	assert.Nil(t, CloseDatabase(metaDb))
-	assert.Nil(t, openKeyDb())
-	keyPath := path.Join(keyStorage.path, keyStorage.file)
-	keyDb, err := OpenDatabase(keyPath, keyStorage.key)
+	assert.Nil(t, defaultStore.openKeyDb())
+	keyPath := path.Join(defaultStore.key.path, defaultStore.key.file)
+	keyDb, err := OpenDatabase(keyPath, defaultStore.key.key)
 	assert.Nil(t, err)
 	assert.NotNil(t, keyDb)
-	assert.True(t, checkConfig())
+	assert.True(t, defaultStore.checkConfig())
 	assert.Nil(t, CloseDatabase(keyDb))
 }
 
@@ -520,25 +854,27 @@ func TestDbObjectInsertEntry(t *testing.T) {
 
 func TestOpenKeyDbWithDirAndNoFiles(t *testing.T) {
 	defer setup()()
-	keyPath := path.Join(keyStorage.path, keyStorage.file)
+	keyPath := path.Join(defaultStore.key.path, defaultStore.key.file)
 	_, err := os.Stat(keyPath)
 	assert.Nil(t, err)
+	assert.Nil(t, defaultStore.closeInternalDbs())
 	err = os.RemoveAll(keyPath)
 	assert.Nil(t, err)
-	assert.Nil(t, openKeyDb())
+	assert.Nil(t, defaultStore.openKeyDb())
 	_, err = os.Stat(keyPath)
 	assert.Nil(t, err)
 }
 
 func TestOpenMetaDbWithDirAndNoFiles(t *testing.T) {
 	defer setup()()
-	metaPath := path.Join(metaStorage.path, metaStorage.file)
+	metaPath := path.Join(defaultStore.meta.path, defaultStore.meta.file)
 	_, err := os.Stat(metaPath)
 	assert.Nil(t, err)
+	assert.Nil(t, defaultStore.closeInternalDbs())
 	err = os.RemoveAll(metaPath)
 	assert.Nil(t, err)
-	assert.Nil(t, openMetaDb())
-	metaPath = path.Join(metaStorage.path, metaStorage.file)
+	assert.Nil(t, defaultStore.openMetaDb())
+	metaPath = path.Join(defaultStore.meta.path, defaultStore.meta.file)
 	_, err = os.Stat(metaPath)
 	assert.Nil(t, err)
 }
@@ -686,3 +1022,607 @@ func TestCreateSameDbs(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, err.Error(), "database already exists")
 }
+
+func TestBatchInsertDetailed(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	n := 100
+	entries := make(map[string][]byte)
+	for i := 0; i < n; i++ {
+		rv, _ := randomValues(keyLength)
+		entries[uuid.NewString()] = rv
+	}
+	// badger rejects empty keys, which should be reported rather than dropped
+	entries[""] = []byte("no key")
+	result, err := BatchInsertDetailed(testDb, entries)
+	assert.Nil(t, err)
+	assert.Equal(t, n+1, result.Total)
+	assert.Equal(t, n, result.Succeeded)
+	assert.Equal(t, 1, len(result.Failed))
+	assert.Equal(t, "", result.Failed[0].Key)
+	assert.NotEmpty(t, result.Failed[0].Reason)
+	for k, v := range entries {
+		if k == "" {
+			continue
+		}
+		value, e := GetEntry(testDb, k)
+		assert.Nil(t, e)
+		assert.Equal(t, v, value)
+	}
+}
+
+func TestCurrentConfig(t *testing.T) {
+	defer setup()()
+	cfg, err := CurrentConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, StorePath, cfg.StorePath)
+	assert.True(t, cfg.SecureNewDb)
+	// mutating the returned copy must not touch the cache
+	cfg.SecureNewDb = false
+	cached, err := CurrentConfig()
+	assert.Nil(t, err)
+	assert.True(t, cached.SecureNewDb)
+	// updates are visible through the cache and the meta db alike
+	assert.Nil(t, UpdateConfigurations(cfg))
+	cached, err = CurrentConfig()
+	assert.Nil(t, err)
+	assert.False(t, cached.SecureNewDb)
+	stored, err := ListConfigurations()
+	assert.Nil(t, err)
+	assert.Equal(t, cached, stored)
+}
+
+func TestOpenOptionsKeyRotation(t *testing.T) {
+	defer setup()()
+	defer SetOpenOptions(DefaultOpenOptions())
+	key, _ := randomValues(keyLength)
+	dbPath := path.Join(StorePath, "rotation-test")
+	db, err := OpenDatabase(dbPath, key)
+	assert.Nil(t, err)
+	assert.Equal(t, 24*time.Hour, db.Opts().EncryptionKeyRotationDuration)
+	assert.Nil(t, CloseDatabase(db))
+
+	opts := DefaultOpenOptions()
+	opts.KeyRotationDuration = time.Hour
+	db, err = OpenDatabaseWithOptions(dbPath, key, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Hour, db.Opts().EncryptionKeyRotationDuration)
+	assert.Nil(t, CloseDatabase(db))
+
+	opts.DisableKeyRotation = true
+	SetOpenOptions(opts)
+	db, err = OpenDatabase(dbPath, key)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(math.MaxInt64), db.Opts().EncryptionKeyRotationDuration)
+	assert.Nil(t, CloseDatabase(db))
+}
+
+func TestDeterministicDirNames(t *testing.T) {
+	defer setup()()
+	cfg, err := ListConfigurations()
+	assert.Nil(t, err)
+	cfg.StorePath = alternateTestStorePath
+	cfg.DeterministicDirNames = true
+	assert.Nil(t, UpdateConfigurations(cfg))
+	assert.Nil(t, CreateDatabase("testdb", true))
+	dbObject, err := defaultStore.getMetaDbObject("testdb")
+	assert.Nil(t, err)
+	assert.Equal(t, DeterministicDirName("testdb"), dbObject.DbFile)
+	assert.Equal(t, DeterministicDirName("testdb"), DeterministicDirName("testdb"))
+	assert.NotEqual(t, DeterministicDirName("testdb"), DeterministicDirName("testdb2"))
+	_, err = os.Stat(path.Join(alternateTestStorePath, DeterministicDirName("testdb")))
+	assert.Nil(t, err)
+	// random suffixes remain the default
+	cfg.DeterministicDirNames = false
+	assert.Nil(t, UpdateConfigurations(cfg))
+	assert.Nil(t, CreateDatabase("testdb2", true))
+	dbObject, err = defaultStore.getMetaDbObject("testdb2")
+	assert.Nil(t, err)
+	assert.NotEqual(t, DeterministicDirName("testdb2"), dbObject.DbFile)
+}
+
+func TestSetReadOnly(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	assert.Nil(t, SetReadOnly(testDb, true))
+	assert.ErrorIs(t, InsertEntry(testDb, "key2", []byte("value2")), ErrDbReadOnly)
+	assert.ErrorIs(t, UpdateEntry(testDb, "key", []byte("changed")), ErrDbReadOnly)
+	assert.ErrorIs(t, RemoveEntry(testDb, "key"), ErrDbReadOnly)
+	assert.ErrorIs(t, BatchInsert(testDb, map[string][]byte{"key3": []byte("value3")}), ErrDbReadOnly)
+	// reads still work
+	value, err := GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	dbObject, err := defaultStore.getMetaDbObject(testDb)
+	assert.Nil(t, err)
+	assert.True(t, dbObject.ReadOnly)
+	assert.Nil(t, SetReadOnly(testDb, false))
+	assert.Nil(t, UpdateEntry(testDb, "key", []byte("changed")))
+	value, err = GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("changed"), value)
+}
+
+func TestStorageObjectCachedState(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	assert.Nil(t, SetReadOnly(testDb, true))
+	storageObject, err := GetStorageObject(testDb)
+	assert.Nil(t, err)
+	assert.Equal(t, testDb, storageObject.Name())
+	assert.True(t, storageObject.Active())
+	assert.True(t, storageObject.Secure())
+	assert.True(t, storageObject.ReadOnly())
+	value, err := storageObject.GetEntry("key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.ErrorIs(t, storageObject.InsertEntry("key", []byte("changed")), ErrDbReadOnly)
+	assert.ErrorIs(t, storageObject.RemoveEntry("key"), ErrDbReadOnly)
+	assert.Nil(t, CloseDatabase(storageObject.db))
+
+	// an inactive database opens, but its handle refuses to serve
+	dbObject, err := defaultStore.getMetaDbObject(testDb)
+	assert.Nil(t, err)
+	dbObject.Active = false
+	assert.Nil(t, defaultStore.writeMetaDbObject(testDb, dbObject, true))
+	storageObject, err = GetStorageObject(testDb)
+	assert.Nil(t, err)
+	assert.False(t, storageObject.Active())
+	_, err = storageObject.GetEntry("key")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), errDbInactive)
+	assert.Nil(t, CloseDatabase(storageObject.db))
+}
+
+func TestCreateDatabaseWithOptions(t *testing.T) {
+	defer setup()()
+	opt := badger.DefaultOptions("").WithNumVersionsToKeep(3).WithLoggingLevel(badger.WARNING)
+	assert.Nil(t, CreateDatabaseWithOptions("testdb", opt, true))
+	storageObject, err := OpenWithOptions("testdb", opt)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, storageObject.db.Opts().NumVersionsToKeep)
+	assert.NotEmpty(t, storageObject.db.Opts().EncryptionKey)
+	dbObject, err := defaultStore.getMetaDbObject("testdb")
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(dbObject.DbPath, dbObject.DbFile), storageObject.db.Opts().Dir)
+	assert.Nil(t, storageObject.InsertEntry("key", []byte("value")))
+	assert.Nil(t, CloseDatabase(storageObject.db))
+	// the regular API still reads it
+	value, err := GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	opt.BlockCacheSize = 0
+	assert.NotNil(t, CreateDatabaseWithOptions("testdb2", opt, true))
+}
+
+func TestValidateDatabaseName(t *testing.T) {
+	defer setup()()
+	for _, name := range []string{"testdb", "test-table", "Test_db.v2", "0a", uuid.New().String()} {
+		assert.Nil(t, ValidateDatabaseName(name), name)
+	}
+	for _, name := range []string{"", "../escape", "a/b", `a\b`, "nul\x00", "_locks", ".hidden", "-x", "with space", "ünicode", strings.Repeat("a", 129)} {
+		assert.ErrorIs(t, ValidateDatabaseName(name), ErrInvalidDatabaseName, name)
+	}
+	assert.ErrorIs(t, CreateDatabase("../escape", true), ErrInvalidDatabaseName)
+	assert.ErrorIs(t, CreateDatabaseWithOptions("a/b", badger.DefaultOptions(""), false), ErrInvalidDatabaseName)
+	dbs, err := ListDatabases()
+	assert.Nil(t, err)
+	assert.Empty(t, dbs)
+	// the package's own databases still get created
+	_, acquired, err := TryAcquireLock("job", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+}
+
+func TestClockStampsDbObjects(t *testing.T) {
+	defer setup()()
+	start := time.UnixMilli(1700000000000)
+	advance, restore := fixClock(start)
+	defer restore()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	advance(time.Hour)
+	assert.Nil(t, RotateDatabaseKey("testdb"))
+	dbObject, err := defaultStore.getMetaDbObject("testdb")
+	assert.Nil(t, err)
+	assert.Equal(t, start.UnixMilli(), dbObject.Created)
+	assert.Equal(t, start.Add(time.Hour).UnixMilli(), dbObject.LastRotated)
+}
+
+func TestApplyTemplate(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb1", true))
+	assert.Nil(t, CreateDatabase("testdb2", false))
+	assert.Nil(t, CreateDatabase("testdb3", true))
+	ttl := 2 * time.Second
+	compression := "zstd"
+	tmpl := DbTemplate{DefaultTTL: &ttl, Compression: &compression, Tags: []string{"fleet"}}
+	assert.Nil(t, ApplyTemplate([]string{"testdb1", "testdb2"}, tmpl))
+	for _, name := range []string{"testdb1", "testdb2"} {
+		dbObject, err := defaultStore.getMetaDbObject(name)
+		assert.Nil(t, err)
+		assert.Equal(t, ttl, dbObject.DefaultTTL)
+		assert.Equal(t, "zstd", dbObject.Compression)
+		assert.Equal(t, []string{"fleet"}, dbObject.Tags)
+		assert.False(t, dbObject.ReadOnly)
+	}
+	untouched, err := defaultStore.getMetaDbObject("testdb3")
+	assert.Nil(t, err)
+	assert.Empty(t, untouched.Tags)
+
+	// entries of the templated databases now expire
+	assert.Nil(t, InsertEntry("testdb2", "key", []byte("value")))
+	value, err := GetEntry("testdb2", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	time.Sleep(3 * time.Second)
+	_, err = GetEntry("testdb2", "key")
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+
+	readOnly := true
+	assert.NotNil(t, ApplyTemplate([]string{"testdb3", "missing"}, DbTemplate{ReadOnly: &readOnly}))
+	unknown := "lz4"
+	assert.NotNil(t, ApplyTemplate([]string{"testdb3"}, DbTemplate{Compression: &unknown}))
+	assert.Nil(t, InsertEntry("testdb3", "key", []byte("value")))
+	assert.Nil(t, ApplyTemplate([]string{"testdb3"}, DbTemplate{ReadOnly: &readOnly}))
+	assert.ErrorIs(t, InsertEntry("testdb3", "key", []byte("value")), ErrDbReadOnly)
+}
+
+func TestSecureDbMustOpenEncrypted(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, InsertEntry("testdb", "key", []byte("value")))
+	_, err := GetEntry("testdb", "key")
+	assert.Nil(t, err)
+
+	// a plain database flagged secure, with its key lost on the way
+	assert.Nil(t, CreateDatabase("plain", false))
+	dbObject, err := defaultStore.getMetaDbObject("plain")
+	assert.Nil(t, err)
+	dbObject.Secure = true
+	assert.Nil(t, defaultStore.writeMetaDbObject("plain", dbObject, true))
+	assert.Nil(t, WriteToKeyring(prefixMetaDb+"plain", []byte("")))
+	// an empty key is caught before the open is even attempted
+	_, err = GetEntry("plain", "key")
+	assert.ErrorIs(t, err, ErrMissingDbKey)
+	_, err = GetStorageObject("plain")
+	assert.ErrorIs(t, err, ErrMissingDbKey)
+}
+
+func TestMissingDbKey(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	dbObject, err := defaultStore.getMetaDbObject("testdb")
+	assert.Nil(t, err)
+	for _, stored := range []string{"", "not base64!", b64Encode([]byte("short"))} {
+		assert.Nil(t, WriteToKeyring(prefixMetaDb+"testdb", []byte(stored)))
+		_, err = defaultStore.getDbKey("testdb", dbObject)
+		assert.ErrorIs(t, err, ErrMissingDbKey, stored)
+		_, err = GetStorageObject("testdb")
+		assert.ErrorIs(t, err, ErrMissingDbKey, stored)
+	}
+	_, err = defaultStore.getDbKey("other", &DbObject{Secure: true})
+	assert.ErrorIs(t, err, ErrMissingDbKey)
+}
+
+func TestMaxValueSize(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true, WithMaxValueSize(8)))
+	dbObject, err := defaultStore.getMetaDbObject(testDb)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), dbObject.MaxValueSize)
+
+	assert.Nil(t, InsertEntry(testDb, "small", []byte("12345678")))
+	assert.ErrorIs(t, InsertEntry(testDb, "large", []byte("123456789")), ErrValueTooLarge)
+	assert.ErrorIs(t, UpdateEntry(testDb, "small", []byte("123456789")), ErrValueTooLarge)
+	assert.ErrorIs(t, InsertEntryWithTTL(testDb, "large", []byte("123456789"), time.Minute), ErrValueTooLarge)
+	_, err = CompareAndSwap(testDb, "small", []byte("12345678"), []byte("123456789"))
+	assert.ErrorIs(t, err, ErrValueTooLarge)
+	// a batch with one oversized value writes nothing
+	assert.ErrorIs(t, BatchInsert(testDb, map[string][]byte{"a": []byte("a"), "b": []byte("123456789")}), ErrValueTooLarge)
+	_, err = GetEntry(testDb, "a")
+	assert.NotNil(t, err)
+
+	result, err := BatchInsertDetailed(testDb, map[string][]byte{"a": []byte("a"), "b": []byte("123456789")})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Total)
+	assert.Equal(t, 1, result.Succeeded)
+	if assert.Len(t, result.Failed, 1) {
+		assert.Equal(t, "b", result.Failed[0].Key)
+	}
+
+	storage, err := OpenStorage(testDb)
+	assert.Nil(t, err)
+	assert.ErrorIs(t, storage.InsertEntry("large", []byte("123456789")), ErrValueTooLarge)
+	assert.Nil(t, storage.InsertEntry("fits", []byte("1234")))
+	assert.Nil(t, storage.Close())
+
+	// no limit by default
+	assert.Nil(t, CreateDatabase("testdb2", true))
+	assert.Nil(t, InsertEntry("testdb2", "large", make([]byte, 1<<16)))
+}
+
+// expiresAt returns the expiry badger holds for key, 0 for none.
+func expiresAt(t *testing.T, dbName, key string) uint64 {
+	storage, err := OpenStorage(dbName)
+	assert.Nil(t, err)
+	defer storage.Close()
+	var expires uint64
+	assert.Nil(t, storage.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		expires = item.ExpiresAt()
+		return nil
+	}))
+	return expires
+}
+
+func TestWritePathsApplyDbLimits(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true, WithMaxValueSize(8)))
+	ttl := time.Hour
+	assert.Nil(t, ApplyTemplate([]string{testDb}, DbTemplate{DefaultTTL: &ttl}))
+	large := []byte("123456789")
+
+	assert.ErrorIs(t, InsertEntryWithMeta(testDb, "large", large, map[string]string{"a": "b"}), ErrValueTooLarge)
+	_, err := InsertEntryVersioned(testDb, "large", large)
+	assert.ErrorIs(t, err, ErrValueTooLarge)
+	assert.ErrorIs(t, NewDedupStore(testDb).InsertEntry("large", large), ErrValueTooLarge)
+	found, err := Exists(testDb, "large")
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	// values that fit get the default TTL, and are indexed for PurgeExpired
+	_, err = InsertEntryVersioned(testDb, "versioned", []byte("small"))
+	assert.Nil(t, err)
+	assert.NotZero(t, expiresAt(t, testDb, "versioned"))
+	assert.Len(t, metaKeysWithPrefix(t, expiryIndexPrefix(testDb)), 1)
+	assert.Nil(t, InsertEntryWithMeta(testDb, "withmeta", []byte("small"), map[string]string{"a": "b"}))
+	assert.NotZero(t, expiresAt(t, testDb, "withmeta"))
+
+	// a transfer stops at an oversized value; what it sends without expiry
+	// gets the default TTL
+	assert.Nil(t, CreateDatabase("source", true))
+	assert.Nil(t, InsertEntry("source", "a", []byte("small")))
+	var buf bytes.Buffer
+	assert.Nil(t, SendDatabase("source", &buf))
+	assert.Nil(t, ReceiveDatabase(testDb, &buf, true))
+	assert.NotZero(t, expiresAt(t, testDb, "a"))
+	assert.Nil(t, InsertEntry("source", "b", large))
+	buf.Reset()
+	assert.Nil(t, SendDatabase("source", &buf))
+	assert.ErrorIs(t, ReceiveDatabase(testDb, &buf, true), ErrValueTooLarge)
+	found, err = Exists(testDb, "b")
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func TestBatchWritesApplyDefaultTTL(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	ttl := time.Hour
+	assert.Nil(t, ApplyTemplate([]string{testDb}, DbTemplate{DefaultTTL: &ttl}))
+
+	assert.Nil(t, BatchInsert(testDb, map[string][]byte{"batch": []byte("value")}))
+	result, err := BatchInsertDetailed(testDb, map[string][]byte{"detailed": []byte("value")})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Succeeded)
+	storage, err := OpenStorage(testDb)
+	assert.Nil(t, err)
+	assert.Nil(t, storage.InsertEntry("storage", []byte("value")))
+	assert.Nil(t, storage.BatchInsert(&map[string][]byte{"storage-batch": []byte("value")}))
+	assert.Nil(t, storage.Close())
+
+	for _, key := range []string{"batch", "detailed", "storage", "storage-batch"} {
+		assert.NotZero(t, expiresAt(t, testDb, key), key)
+	}
+	assert.Len(t, metaKeysWithPrefix(t, expiryIndexPrefix(testDb)), 4)
+}
+
+func TestKeyringRetry(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	dbObject, err := defaultStore.getMetaDbObject("testdb")
+	assert.Nil(t, err)
+	defer func() {
+		keyringSleep = time.Sleep
+		defaultStore.key.rotatingKey = false
+	}()
+
+	// the keyring comes back after a retry
+	waits := make([]time.Duration, 0)
+	keyringSleep = func(d time.Duration) {
+		waits = append(waits, d)
+		defaultStore.key.rotatingKey = len(waits) < 2
+	}
+	defaultStore.key.rotatingKey = true
+	key, err := defaultStore.getDbKey("testdb", dbObject)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, key)
+	assert.Equal(t, []time.Duration{KeyringRetryBackoff, 2 * KeyringRetryBackoff}, waits)
+
+	// or it doesn't
+	waits = waits[:0]
+	keyringSleep = func(d time.Duration) {
+		waits = append(waits, d)
+	}
+	defaultStore.key.rotatingKey = true
+	_, err = defaultStore.getDbKey("testdb", dbObject)
+	assert.ErrorIs(t, err, ErrKeyringUnavailable)
+	assert.Len(t, waits, KeyringRetries)
+	defaultStore.key.rotatingKey = false
+
+	// a missing key fails straight away
+	waits = waits[:0]
+	_, err = defaultStore.getDbKey("other", &DbObject{Secure: true})
+	assert.ErrorIs(t, err, ErrMissingDbKey)
+	assert.Empty(t, waits)
+}
+
+func TestCreateDatabaseKeyringFailure(t *testing.T) {
+	defer setup()()
+	defer func() { defaultStore.key.rotatingKey = false }()
+	defaultStore.key.rotatingKey = true
+	assert.NotNil(t, CreateDatabase("testdb", true))
+	defaultStore.key.rotatingKey = false
+
+	// the new directory was closed and removed, not left behind locked
+	orphans, err := ListOrphanedDirectories()
+	assert.Nil(t, err)
+	assert.Empty(t, orphans)
+	entries, err := os.ReadDir(StorePath)
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		assert.False(t, strings.HasPrefix(entry.Name(), "testdb-"), entry.Name())
+	}
+	assert.Nil(t, CreateDatabase("testdb", true))
+}
+
+func TestGetMetaEntryMissingOrEmpty(t *testing.T) {
+	defer setup()()
+	var notFound *EMetaKeyNotFound
+	_, err := defaultStore.getMetaEntry("missing")
+	assert.ErrorAs(t, err, &notFound)
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+
+	assert.Nil(t, defaultStore.writeMetaEntry(prefixMetaDb+"empty", []byte{}))
+	value, err := defaultStore.getMetaEntry(prefixMetaDb + "empty")
+	assert.Nil(t, value)
+	assert.ErrorAs(t, err, &notFound)
+	_, err = defaultStore.getMetaDbObject("empty")
+	assert.ErrorAs(t, err, &notFound)
+}
+
+func TestListDatabasesByCreation(t *testing.T) {
+	defer setup()()
+	advance, restore := fixClock(time.Unix(1700000000, 0))
+	defer restore()
+	for _, dbName := range []string{"second", "first", "third"} {
+		assert.Nil(t, CreateDatabase(dbName, false))
+		advance(time.Second)
+	}
+	names := func(list []DbObject) []string {
+		result := make([]string, 0)
+		for _, dbObject := range list {
+			result = append(result, dbObject.Name)
+		}
+		return result
+	}
+	list, err := ListDatabasesByCreation(false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"second", "first", "third"}, names(list))
+	assert.Equal(t, int64(1700000000000), list[0].Created)
+	list, err = ListDatabasesByCreation(true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"third", "first", "second"}, names(list))
+}
+
+func TestSetDatabaseActive(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	assert.Nil(t, SetDatabaseActive(testDb, false))
+	_, err := GetEntry(testDb, "key")
+	assert.ErrorContains(t, err, errDbInactive)
+	assert.ErrorContains(t, InsertEntry(testDb, "key2", []byte("value2")), errDbInactive)
+	assert.False(t, defaultStore.hasOpenHandle(testDb))
+
+	assert.Nil(t, SetDatabaseActive(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key2", []byte("value2")))
+	value, err := GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	assert.Nil(t, SoftDeleteDatabase(testDb))
+	assert.NotNil(t, SetDatabaseActive(testDb, true))
+}
+
+func TestCreateDatabaseDefault(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabaseDefault("testdb1"))
+	dbObject, err := defaultStore.getMetaDbObject("testdb1")
+	assert.Nil(t, err)
+	assert.True(t, dbObject.Secure)
+
+	cfg, err := ListConfigurations()
+	assert.Nil(t, err)
+	cfg.SecureNewDb = false
+	assert.Nil(t, UpdateConfigurations(cfg))
+	assert.Nil(t, CreateDatabaseDefault("testdb2"))
+	dbObject, err = defaultStore.getMetaDbObject("testdb2")
+	assert.Nil(t, err)
+	assert.False(t, dbObject.Secure)
+	assert.ErrorIs(t, CreateDatabaseDefault("../escape"), ErrInvalidDatabaseName)
+}
+
+func TestSoftDeleteDatabase(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	assert.ErrorIs(t, RestoreDatabase(testDb), ErrDbNotDeleted)
+
+	assert.Nil(t, SoftDeleteDatabase(testDb))
+	dbs, err := ListDatabases()
+	assert.Nil(t, err)
+	assert.NotContains(t, dbs, prefixMetaDb+testDb)
+	dbs, err = ListAllDatabases()
+	assert.Nil(t, err)
+	assert.Contains(t, dbs, prefixMetaDb+testDb)
+	dbObject, err := defaultStore.getMetaDbObject(testDb)
+	assert.Nil(t, err)
+	assert.NotZero(t, dbObject.Deleted)
+	assert.False(t, dbObject.Active)
+	_, err = os.Stat(path.Join(dbObject.DbPath, dbObject.DbFile))
+	assert.Nil(t, err)
+	_, err = GetEntry(testDb, "key")
+	assert.ErrorContains(t, err, errDbInactive)
+
+	assert.Nil(t, RestoreDatabase(testDb))
+	dbs, err = ListDatabases()
+	assert.Nil(t, err)
+	assert.Contains(t, dbs, prefixMetaDb+testDb)
+	value, err := GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+}
+
+func TestDeleteDatabase(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntryWithTTL(testDb, "key", []byte("value"), time.Hour))
+	dbObject, err := defaultStore.getMetaDbObject(testDb)
+	assert.Nil(t, err)
+	dbPath := path.Join(dbObject.DbPath, dbObject.DbFile)
+
+	assert.Nil(t, DeleteDatabase(testDb))
+	_, err = os.Stat(dbPath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = defaultStore.getFromKeyring(prefixMetaDb + testDb)
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+	dbs, err := ListDatabases()
+	assert.Nil(t, err)
+	assert.NotContains(t, dbs, prefixMetaDb+testDb)
+	assert.Equal(t, 0, expiryIndexSize(t, testDb))
+	var notFound *EMetaKeyNotFound
+	assert.ErrorAs(t, DeleteDatabase(testDb), &notFound)
+
+	// the name can be used again, for a fresh database
+	assert.Nil(t, CreateDatabase(testDb, false))
+	found, err := Exists(testDb, "key")
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Nil(t, DeleteDatabase(testDb))
+}
@@ -0,0 +1,186 @@
+package cachekv
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	prefixDedupRef   = "ref:"
+	prefixDedupBlob  = "blob:"
+	prefixDedupCount = "blobrefs:"
+)
+
+// DedupStore is a content-addressed view of a database: every distinct value
+// is stored once under blob:<sha256>, each user key holds a reference to its
+// blob, and blobs are reference-counted so the last RemoveEntry deletes it.
+// It pays off for data with many identical values. Blobs are stored in the
+// database's envelope, compressed as its other values are, and the hash is
+// taken of the plain value. Every operation runs in a single transaction,
+// retried if it conflicts with a concurrent one. A database should be used
+// either through a DedupStore or through the plain API, not both.
+type DedupStore struct {
+	dbName string
+	store  *Store
+}
+
+func (s *Store) NewDedupStore(dbName string) *DedupStore {
+	return &DedupStore{store: s, dbName: dbName}
+}
+
+// NewDedupStore calls Store.NewDedupStore on the default store.
+func NewDedupStore(dbName string) *DedupStore {
+	return defaultStore.NewDedupStore(dbName)
+}
+
+func contentHash(value []byte) string {
+	hash := sha256.Sum256(value)
+	return hex.EncodeToString(hash[:])
+}
+
+// adjustBlobRefs changes the reference count of hash by delta, storing data,
+// encoded as userMeta says, as the blob when the first reference appears and
+// deleting the blob with the last one.
+func adjustBlobRefs(txn *badger.Txn, hash string, delta int64, data []byte, userMeta byte) error {
+	countKey := []byte(prefixDedupCount + hash)
+	var count uint64
+	item, err := txn.Get(countKey)
+	if err == nil {
+		err = item.Value(func(val []byte) error {
+			count = binary.BigEndian.Uint64(val)
+			return nil
+		})
+	}
+	if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		return err
+	}
+	newCount := int64(count) + delta
+	if newCount <= 0 {
+		if err = txn.Delete(countKey); err != nil {
+			return err
+		}
+		return txn.Delete([]byte(prefixDedupBlob + hash))
+	}
+	if count == 0 {
+		if err = txn.SetEntry(badger.NewEntry([]byte(prefixDedupBlob+hash), data).WithMeta(userMeta)); err != nil {
+			return err
+		}
+	}
+	encoded := make([]byte, 8)
+	binary.BigEndian.PutUint64(encoded, uint64(newCount))
+	return txn.Set(countKey, encoded)
+}
+
+func getDedupRef(txn *badger.Txn, key string) (string, error) {
+	item, err := txn.Get([]byte(prefixDedupRef + key))
+	if err != nil {
+		return "", err
+	}
+	hash, err := item.ValueCopy(nil)
+	return string(hash), err
+}
+
+// InsertEntry points key at value's blob, storing the blob if it's new. The
+// database's MaxValueSize applies; its DefaultTTL doesn't, as an expired
+// reference would never give its blob back.
+func (d *DedupStore) InsertEntry(key string, value []byte) error {
+	db, dbObject, err := d.store.openWritableDbByName(d.dbName)
+	if err != nil {
+		return err
+	}
+	if err = checkValueSize(d.dbName, dbObject.MaxValueSize, value); err != nil {
+		_ = d.store.releaseDb(d.dbName, db)
+		return err
+	}
+	hash := contentHash(value)
+	data, userMeta, err := encodeValue(value, d.store.writeEncoding(dbObject).flagsFor(value))
+	if err != nil {
+		_ = d.store.releaseDb(d.dbName, db)
+		return err
+	}
+	err = updateRetrying(db, func(txn *badger.Txn) error {
+		oldHash, e := getDedupRef(txn, key)
+		if e != nil && !errors.Is(e, badger.ErrKeyNotFound) {
+			return e
+		}
+		if oldHash == hash {
+			return nil
+		}
+		if oldHash != "" {
+			if e = adjustBlobRefs(txn, oldHash, -1, nil, 0); e != nil {
+				return e
+			}
+		}
+		if e = adjustBlobRefs(txn, hash, 1, data, userMeta); e != nil {
+			return e
+		}
+		return txn.Set([]byte(prefixDedupRef+key), []byte(hash))
+	})
+	closeErr := d.store.releaseDb(d.dbName, db)
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func (d *DedupStore) UpdateEntry(key string, value []byte) error {
+	return d.InsertEntry(key, value)
+}
+
+// GetEntry resolves key's reference and returns its blob, or
+// badger.ErrKeyNotFound if key isn't set.
+func (d *DedupStore) GetEntry(key string) ([]byte, error) {
+	db, _, err := d.store.openDbByName(d.dbName)
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	err = db.View(func(txn *badger.Txn) error {
+		hash, e := getDedupRef(txn, key)
+		if e != nil {
+			return e
+		}
+		item, e := txn.Get([]byte(prefixDedupBlob + hash))
+		if e != nil {
+			return e
+		}
+		value, e = itemValue(item)
+		return e
+	})
+	closeErr := d.store.releaseDb(d.dbName, db)
+	if err != nil {
+		return nil, err
+	}
+	return value, closeErr
+}
+
+// RemoveEntry drops key's reference, and its blob too if nothing else
+// references it. Removing a missing key is not an error.
+func (d *DedupStore) RemoveEntry(key string) error {
+	db, _, err := d.store.openWritableDbByName(d.dbName)
+	if err != nil {
+		return err
+	}
+	err = updateRetrying(db, func(txn *badger.Txn) error {
+		hash, e := getDedupRef(txn, key)
+		if errors.Is(e, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if e != nil {
+			return e
+		}
+		if e = txn.Delete([]byte(prefixDedupRef + key)); e != nil {
+			return e
+		}
+		return adjustBlobRefs(txn, hash, -1, nil, 0)
+	})
+	closeErr := d.store.releaseDb(d.dbName, db)
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
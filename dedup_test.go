@@ -0,0 +1,110 @@
+package cachekv
+
+import (
+	"bytes"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func countBlobs(t *testing.T, dbName string) int {
+	dbObject, err := defaultStore.getMetaDbObject(dbName)
+	assert.Nil(t, err)
+	dbKey, err := defaultStore.getDbKey(dbName, dbObject)
+	assert.Nil(t, err)
+	assert.Nil(t, CloseDatabaseByName(dbName))
+	db, err := OpenDatabase(path.Join(dbObject.DbPath, dbObject.DbFile), dbKey)
+	assert.Nil(t, err)
+	defer func() {
+		assert.Nil(t, CloseDatabase(db))
+	}()
+	count, err := countRecords(prefixDedupBlob, db, false)
+	assert.Nil(t, err)
+	return count
+}
+
+func TestDedupStore(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	store := NewDedupStore("testdb")
+	shared := []byte("the same payload")
+	assert.Nil(t, store.InsertEntry("a", shared))
+	assert.Nil(t, store.InsertEntry("b", shared))
+	assert.Nil(t, store.InsertEntry("c", []byte("something else")))
+	assert.Equal(t, 2, countBlobs(t, "testdb"))
+	for _, key := range []string{"a", "b"} {
+		value, err := store.GetEntry(key)
+		assert.Nil(t, err)
+		assert.Equal(t, shared, value)
+	}
+
+	// the shared blob survives until its last reference goes
+	assert.Nil(t, store.RemoveEntry("a"))
+	_, err := store.GetEntry("a")
+	assert.NotNil(t, err)
+	value, err := store.GetEntry("b")
+	assert.Nil(t, err)
+	assert.Equal(t, shared, value)
+	assert.Equal(t, 2, countBlobs(t, "testdb"))
+	assert.Nil(t, store.UpdateEntry("b", []byte("something else")))
+	assert.Equal(t, 1, countBlobs(t, "testdb"))
+	value, err = store.GetEntry("b")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("something else"), value)
+
+	assert.Nil(t, store.RemoveEntry("b"))
+	assert.Nil(t, store.RemoveEntry("c"))
+	assert.Nil(t, store.RemoveEntry("missing"))
+	assert.Equal(t, 0, countBlobs(t, "testdb"))
+}
+
+func TestDedupStoreConcurrentInserts(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	store := NewDedupStore("testdb")
+	shared := []byte("the same payload")
+
+	// inserts of one blob under many keys conflict, and are retried
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, store.InsertEntry("key"+strconv.Itoa(i), shared))
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, countBlobs(t, "testdb"))
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, store.RemoveEntry("key"+strconv.Itoa(i)))
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 0, countBlobs(t, "testdb"))
+}
+
+func TestDedupStoreCompressesBlobs(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	cfg, err := ListConfigurations()
+	assert.Nil(t, err)
+	cfg.CompressValues = true
+	assert.Nil(t, UpdateConfigurations(cfg))
+	store := NewDedupStore("testdb")
+	payload := bytes.Repeat([]byte(`{"name":"cachekv","tags":["a","b","c"],"count":12345},`), 2000)
+	assert.Nil(t, store.InsertEntry("key", payload))
+
+	data, userMeta := storedValue(t, "testdb", prefixDedupBlob+contentHash(payload))
+	assert.Equal(t, userMetaEnvelope, userMeta)
+	assert.Equal(t, encodingCompressed, data[1])
+	assert.Less(t, len(data), len(payload)/10)
+	value, err := store.GetEntry("key")
+	assert.Nil(t, err)
+	assert.Equal(t, payload, value)
+}
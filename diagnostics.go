@@ -0,0 +1,96 @@
+package cachekv
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DiagnosticEvents is how many of the most recent events DiagnosticDump
+// includes.
+var DiagnosticEvents = 1000
+
+// DiagnosticBundle is what DiagnosticDump writes. It holds no key material
+// and no values: databases are described by their DbObject, the keyring by
+// the names of its entries.
+type DiagnosticBundle struct {
+	Generated      int64                `json:"generated"`
+	BadgerVersion  string               `json:"badger_version"`
+	Config         *Config              `json:"config,omitempty"`
+	Databases      map[string]*DbObject `json:"databases,omitempty"`
+	Events         []Event              `json:"events,omitempty"`
+	KeyringEntries []string             `json:"keyring_entries,omitempty"`
+	Stats          DiagnosticStats      `json:"stats"`
+	// Errors lists the parts of the bundle that couldn't be gathered, which
+	// are left out; a store that's misbehaving is when a dump is needed.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// DiagnosticStats are the store-level numbers in a DiagnosticBundle. Sizes
+// are measured as for Prometheus, without opening any database.
+type DiagnosticStats struct {
+	Databases         int   `json:"databases"`
+	OpenDatabases     int   `json:"open_databases"`
+	RotationRunning   bool  `json:"rotation_running"`
+	CacheEntries      int   `json:"cache_entries"`
+	CacheExpiringSoon int   `json:"cache_expiring_soon"`
+	LsmBytes          int64 `json:"lsm_bytes"`
+	VlogBytes         int64 `json:"vlog_bytes"`
+}
+
+// DiagnosticDump writes a JSON DiagnosticBundle to w: the config, every
+// DbObject, the last DiagnosticEvents events, the names of the keyring's
+// entries and store-level stats, enough to look into a problem without
+// access to the data. A part that can't be read is reported in the bundle's
+// Errors; only failing to write to w is an error.
+func (s *Store) DiagnosticDump(w io.Writer) error {
+	bundle := DiagnosticBundle{
+		Generated:     clock().UnixMilli(),
+		BadgerVersion: badgerVersion(),
+	}
+	fail := func(part string, err error) {
+		bundle.Errors = append(bundle.Errors, part+": "+err.Error())
+	}
+	var err error
+	if bundle.Config, err = s.ListConfigurations(); err != nil {
+		fail("config", err)
+	}
+	if dbs, err := s.listDatabases(); err != nil {
+		fail("databases", err)
+	} else {
+		bundle.Databases = make(map[string]*DbObject, len(dbs))
+		for key, dbObject := range dbs {
+			dbName := strings.TrimPrefix(key, prefixMetaDb)
+			bundle.Databases[dbName] = dbObject
+			lsm, vlog, err := s.measureDb(dbName, dbObject)
+			if err != nil {
+				fail("size of "+dbName, err)
+				continue
+			}
+			bundle.Stats.LsmBytes += lsm
+			bundle.Stats.VlogBytes += vlog
+		}
+		bundle.Stats.Databases = len(dbs)
+	}
+	if bundle.Events, err = s.ListEvents(0, DiagnosticEvents); err != nil {
+		fail("events", err)
+	}
+	if bundle.KeyringEntries, err = s.ListKeyringEntries(); err != nil {
+		fail("keyring", err)
+	}
+	sort.Strings(bundle.KeyringEntries)
+	bundle.Stats.OpenDatabases = s.OpenDatabaseCount()
+	bundle.Stats.RotationRunning = s.rotationInProgress()
+	if bundle.Stats.CacheEntries, bundle.Stats.CacheExpiringSoon, err = s.CacheStats(); err != nil {
+		fail("cache", err)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(bundle)
+}
+
+// DiagnosticDump calls Store.DiagnosticDump on the default store.
+func DiagnosticDump(w io.Writer) error {
+	return defaultStore.DiagnosticDump(w)
+}
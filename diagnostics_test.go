@@ -0,0 +1,42 @@
+package cachekv
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnosticDump(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, CreateDatabase("plaindb", false))
+	secret := []byte("a value that must not leak")
+	assert.Nil(t, InsertEntry("testdb", "key", secret))
+	assert.Nil(t, WriteToKeyring("app-secret", secret))
+
+	var buf bytes.Buffer
+	assert.Nil(t, DiagnosticDump(&buf))
+	var bundle DiagnosticBundle
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &bundle))
+	assert.Empty(t, bundle.Errors)
+	assert.NotNil(t, bundle.Config)
+	assert.Equal(t, StorePath, bundle.Config.StorePath)
+	assert.Len(t, bundle.Databases, 2)
+	assert.True(t, bundle.Databases["testdb"].Secure)
+	assert.False(t, bundle.Databases["plaindb"].Secure)
+	assert.Equal(t, 2, bundle.Stats.Databases)
+	assert.NotEmpty(t, bundle.Events)
+	assert.Contains(t, bundle.KeyringEntries, prefixMetaDb+"testdb")
+	assert.Contains(t, bundle.KeyringEntries, prefixMetaKey)
+	assert.Contains(t, bundle.KeyringEntries, "app-secret")
+
+	dbKey, err := defaultStore.getFromKeyring(prefixMetaDb + "testdb")
+	assert.Nil(t, err)
+	for _, material := range [][]byte{secret, dbKey, defaultStore.meta.key, defaultStore.key.key} {
+		assert.False(t, bytes.Contains(buf.Bytes(), material))
+		assert.False(t, bytes.Contains(buf.Bytes(), []byte(base64.StdEncoding.EncodeToString(material))))
+	}
+}
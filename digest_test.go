@@ -0,0 +1,45 @@
+package cachekv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabaseDigest(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb1", true))
+	assert.Nil(t, CreateDatabase("testdb2", false))
+	empty, err := DatabaseDigest("testdb1")
+	assert.Nil(t, err)
+
+	assert.Nil(t, BatchInsert("testdb1", map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")}))
+	assert.Nil(t, InsertEntry("testdb2", "c", []byte("3")))
+	assert.Nil(t, InsertEntry("testdb2", "a", []byte("1")))
+	assert.Nil(t, InsertEntry("testdb2", "b", []byte("2")))
+	digest1, err := DatabaseDigest("testdb1")
+	assert.Nil(t, err)
+	digest2, err := DatabaseDigest("testdb2")
+	assert.Nil(t, err)
+	assert.Len(t, digest1, 32)
+	assert.Equal(t, digest1, digest2)
+	assert.NotEqual(t, empty, digest1)
+
+	assert.Nil(t, InsertEntry("testdb2", "b", []byte("x")))
+	digest2, err = DatabaseDigest("testdb2")
+	assert.Nil(t, err)
+	assert.NotEqual(t, digest1, digest2)
+
+	// bytes can't be shifted between a key and its value
+	assert.Nil(t, CreateDatabase("testdb3", false))
+	assert.Nil(t, CreateDatabase("testdb4", false))
+	assert.Nil(t, InsertEntry("testdb3", "ab", []byte("c")))
+	assert.Nil(t, InsertEntry("testdb4", "a", []byte("bc")))
+	digest3, err := DatabaseDigest("testdb3")
+	assert.Nil(t, err)
+	digest4, err := DatabaseDigest("testdb4")
+	assert.Nil(t, err)
+	assert.NotEqual(t, digest3, digest4)
+	_, err = DatabaseDigest("missing")
+	assert.NotNil(t, err)
+}
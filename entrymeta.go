@@ -0,0 +1,174 @@
+package cachekv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// reservedKeyPrefix starts the keys the store keeps for itself inside a user
+// database. Writing a user key that starts with it fails with ErrReservedKey,
+// and scans, counts, listings and streams skip such keys.
+const reservedKeyPrefix = "\x00"
+
+// prefixEntryMeta is where InsertEntryWithMeta keeps the metadata of a key,
+// next to the key itself in the same database.
+const prefixEntryMeta = reservedKeyPrefix + "meta:"
+
+// isReservedKey reports whether key is one the store keeps for itself.
+func isReservedKey(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(reservedKeyPrefix))
+}
+
+// checkKey fails with ErrReservedKey if key is not one a caller may write.
+func checkKey(key string) error {
+	if strings.HasPrefix(key, reservedKeyPrefix) {
+		return fmt.Errorf("%w: %q", ErrReservedKey, key)
+	}
+	return nil
+}
+
+// checkKeys is checkKey over every key of a batch.
+func checkKeys(dbName string, entries map[string][]byte) error {
+	for key := range entries {
+		if err := checkKey(key); err != nil {
+			return fmt.Errorf("%s - %w", dbName, err)
+		}
+	}
+	return nil
+}
+
+// deleteEntryMeta removes the metadata stored with key, if any. Keys stored
+// without metadata get no second tombstone.
+func deleteEntryMeta(txn *badger.Txn, key string) error {
+	metaKey := []byte(prefixEntryMeta + key)
+	_, err := txn.Get(metaKey)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return txn.Delete(metaKey)
+}
+
+// InsertEntryWithMeta stores value under key, as InsertEntry does, together
+// with meta under a reserved key of its own. Both are written in one transaction; a nil or
+// empty meta removes metadata stored earlier.
+func (s *Store) InsertEntryWithMeta(dbName string, key string, value []byte, meta map[string]string) error {
+	defer s.observeOp(dbName, "InsertEntryWithMeta", time.Now())
+	db, dbObject, err := s.openWritableDbByName(dbName)
+	if err != nil {
+		return err
+	}
+	if err = checkValueSize(dbName, dbObject.MaxValueSize, value); err != nil {
+		_ = s.releaseDb(dbName, db)
+		return err
+	}
+	var expiresAt uint64
+	err = db.Update(func(txn *badger.Txn) error {
+		entry, err := valueEntry([]byte(key), value, s.writeEncoding(dbObject))
+		if err != nil {
+			return err
+		}
+		if dbObject.DefaultTTL > 0 {
+			entry = entry.WithTTL(dbObject.DefaultTTL)
+		}
+		if err = txn.SetEntry(entry); err != nil {
+			return err
+		}
+		expiresAt = entry.ExpiresAt
+		metaKey := []byte(prefixEntryMeta + key)
+		if len(meta) == 0 {
+			return txn.Delete(metaKey)
+		}
+		jsonMeta, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		metaEntry, err := encodedEntry(metaKey, jsonMeta, s.writeEncoding(dbObject))
+		if err != nil {
+			return err
+		}
+		// the metadata lives exactly as long as the value
+		metaEntry.ExpiresAt = entry.ExpiresAt
+		return txn.SetEntry(metaEntry)
+	})
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	if expiresAt > 0 {
+		return s.indexExpiry(dbName, key, expiresAt)
+	}
+	return nil
+}
+
+// InsertEntryWithMeta calls Store.InsertEntryWithMeta on the default store.
+func InsertEntryWithMeta(dbName string, key string, value []byte, meta map[string]string) error {
+	return defaultStore.InsertEntryWithMeta(dbName, key, value, meta)
+}
+
+// GetEntryWithMeta returns the value stored under key and its metadata, read
+// in one transaction. meta is empty if the key was stored without any.
+func (s *Store) GetEntryWithMeta(dbName string, key string) (value []byte, meta map[string]string, err error) {
+	defer s.observeOp(dbName, "GetEntryWithMeta", time.Now())
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta = make(map[string]string)
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		if value, err = itemValue(item); err != nil {
+			return err
+		}
+		item, err = txn.Get([]byte(prefixEntryMeta + key))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		jsonMeta, err := itemValue(item)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(jsonMeta, &meta)
+	})
+	closeErr := s.releaseDb(dbName, db)
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, meta, nil
+}
+
+// GetEntryWithMeta calls Store.GetEntryWithMeta on the default store.
+func GetEntryWithMeta(dbName string, key string) (value []byte, meta map[string]string, err error) {
+	return defaultStore.GetEntryWithMeta(dbName, key)
+}
+
+// RemoveEntryWithMeta removes key and its metadata in one transaction, as
+// RemoveEntry does.
+func (s *Store) RemoveEntryWithMeta(dbName string, key string) error {
+	return s.RemoveEntry(dbName, key)
+}
+
+// RemoveEntryWithMeta calls Store.RemoveEntryWithMeta on the default store.
+func RemoveEntryWithMeta(dbName string, key string) error {
+	return defaultStore.RemoveEntryWithMeta(dbName, key)
+}
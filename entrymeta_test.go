@@ -0,0 +1,156 @@
+package cachekv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntryWithMeta(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	meta := map[string]string{"content-type": "text/plain", "source": "test"}
+	assert.Nil(t, InsertEntryWithMeta(testDb, "key", []byte("value"), meta))
+	value, got, err := GetEntryWithMeta(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.Equal(t, meta, got)
+	// the value itself stays clean
+	value, err = GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	assert.Nil(t, InsertEntry(testDb, "plain", []byte("value")))
+	_, got, err = GetEntryWithMeta(testDb, "plain")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(got))
+
+	assert.Nil(t, InsertEntryWithMeta(testDb, "key", []byte("other"), nil))
+	_, got, err = GetEntryWithMeta(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(got))
+
+	assert.Nil(t, InsertEntryWithMeta(testDb, "key", []byte("value"), meta))
+	assert.Nil(t, RemoveEntryWithMeta(testDb, "key"))
+	_, _, err = GetEntryWithMeta(testDb, "key")
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+	found, err := Exists(testDb, prefixEntryMeta+"key")
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	// RemoveEntry doesn't leave the metadata behind either
+	assert.Nil(t, InsertEntryWithMeta(testDb, "key", []byte("value"), meta))
+	assert.Nil(t, RemoveEntry(testDb, "key"))
+	found, err = Exists(testDb, prefixEntryMeta+"key")
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	_, got, err = GetEntryWithMeta(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(got))
+}
+
+func TestEntryMetaReservedKeys(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	meta := map[string]string{"source": "test"}
+	// a user key that looks like the old metadata keys is left alone
+	assert.Nil(t, InsertEntry(testDb, "meta:foo", []byte("mine")))
+	assert.Nil(t, InsertEntryWithMeta(testDb, "foo", []byte("value"), meta))
+	assert.Nil(t, RemoveEntry(testDb, "foo"))
+	value, err := GetEntry(testDb, "meta:foo")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("mine"), value)
+
+	assert.ErrorIs(t, InsertEntry(testDb, prefixEntryMeta+"foo", []byte("value")), ErrReservedKey)
+	assert.ErrorIs(t, BatchInsert(testDb, map[string][]byte{reservedKeyPrefix + "x": []byte("value")}), ErrReservedKey)
+	assert.ErrorIs(t, RemoveEntry(testDb, prefixEntryMeta+"foo"), ErrReservedKey)
+
+	// the metadata is kept out of every listing
+	assert.Nil(t, InsertEntryWithMeta(testDb, "foo", []byte("value"), meta))
+	count, err := CountEntries(testDb, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	keys, _, err := ListKeys(testDb, "", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"foo", "meta:foo"}, keys)
+	scanned := make([]string, 0)
+	assert.Nil(t, ScanPrefix(testDb, "", func(key string, value []byte) error {
+		scanned = append(scanned, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"foo", "meta:foo"}, scanned)
+	streamed := 0
+	kvs, errs := Stream(testDb)
+	for range kvs {
+		streamed++
+	}
+	assert.Nil(t, <-errs)
+	assert.Equal(t, 2, streamed)
+	profile, err := DatabaseProfile(testDb)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, profile.KeyCount)
+}
+
+func TestEntryMetaRemovedWithKey(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	meta := map[string]string{"source": "test"}
+	hasMeta := func(key string) bool {
+		found, err := Exists(testDb, prefixEntryMeta+key)
+		assert.Nil(t, err)
+		return found
+	}
+
+	storage, err := OpenStorage(testDb)
+	assert.Nil(t, err)
+	assert.Nil(t, InsertEntryWithMeta(testDb, "storage", []byte("value"), meta))
+	assert.Nil(t, storage.RemoveEntry("storage"))
+	assert.False(t, hasMeta("storage"))
+	assert.Nil(t, storage.Close())
+
+	assert.Nil(t, InsertEntryWithMeta(testDb, "batch:1", []byte("value"), meta))
+	assert.Nil(t, InsertEntryWithMeta(testDb, "batch:2", []byte("value"), meta))
+	assert.Nil(t, BatchDelete(testDb, []string{"batch:1", "batch:2"}))
+	assert.False(t, hasMeta("batch:1"))
+	assert.False(t, hasMeta("batch:2"))
+
+	assert.Nil(t, InsertEntryWithMeta(testDb, "range:1", []byte("value"), meta))
+	assert.Nil(t, InsertEntry(testDb, "range:2", []byte("value")))
+	deleted, err := DeleteRange(testDb, "range:", "range;")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, deleted)
+	assert.False(t, hasMeta("range:1"))
+
+	assert.Nil(t, InsertEntryWithMeta(testDb, "drop:1", []byte("value"), meta))
+	assert.Nil(t, DropPrefix(testDb, "drop:"))
+	assert.False(t, hasMeta("drop:1"))
+
+	assert.Nil(t, InsertEntryWithMeta(testDb, "cas", []byte("value"), meta))
+	ok, err := DeleteIfEquals(testDb, "cas", []byte("value"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.False(t, hasMeta("cas"))
+
+	ttl := 2 * time.Second
+	assert.Nil(t, ApplyTemplate([]string{testDb}, DbTemplate{DefaultTTL: &ttl}))
+	assert.Nil(t, InsertEntryWithMeta(testDb, "expiring", []byte("value"), meta))
+	time.Sleep(3 * time.Second)
+	purged, err := PurgeExpired(testDb)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+	db, _, err := defaultStore.openDbByName(testDb)
+	assert.Nil(t, err)
+	assert.Nil(t, db.View(func(txn *badger.Txn) error {
+		item := latestVersion(txn, []byte(prefixEntryMeta+"expiring"))
+		assert.NotNil(t, item)
+		assert.Equal(t, uint64(0), item.ExpiresAt())
+		return nil
+	}))
+	assert.Nil(t, defaultStore.releaseDb(testDb, db))
+}
@@ -0,0 +1,122 @@
+package cachekv
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Values can be stored in an envelope that says how they were encoded:
+//
+//	[version byte][flags byte][payload]
+//
+// Enveloped values are marked with userMetaEnvelope in badger's per-entry
+// user meta, so plain values written before the envelope existed, or with no
+// encoding, stay raw and are read back unchanged. Each flag bit names one
+// valueCodec; a database's DbObject.Encoding picks the bits its writes use,
+// and Config.CompressValues adds compression to them.
+const (
+	userMetaEnvelope     byte = 1 << 0
+	envelopeVersion      byte = 1
+	envelopeHeaderLength      = 2
+)
+
+// valueCodec is one encoding an envelope can apply, such as compression.
+type valueCodec struct {
+	flag   byte
+	encode func([]byte) ([]byte, error)
+	decode func([]byte) ([]byte, error)
+}
+
+// valueCodecs are applied in order on write and in reverse on read.
+var valueCodecs = []valueCodec{
+	{flag: encodingCompressed, encode: compressValue, decode: decompressValue},
+}
+
+var ErrUnknownEncoding = errors.New("value uses an unknown encoding")
+
+// encodeValue wraps value for the flags given. With no flags the value is left
+// raw and userMeta is 0.
+func encodeValue(value []byte, flags byte) (data []byte, userMeta byte, err error) {
+	if flags == 0 {
+		return value, 0, nil
+	}
+	payload := value
+	remaining := flags
+	for _, codec := range valueCodecs {
+		if flags&codec.flag == 0 {
+			continue
+		}
+		payload, err = codec.encode(payload)
+		if err != nil {
+			return nil, 0, err
+		}
+		remaining &^= codec.flag
+	}
+	if remaining != 0 {
+		return nil, 0, fmt.Errorf("%w: flags %#02x", ErrUnknownEncoding, remaining)
+	}
+	data = make([]byte, 0, envelopeHeaderLength+len(payload))
+	data = append(data, envelopeVersion, flags)
+	return append(data, payload...), userMetaEnvelope, nil
+}
+
+// decodeValue reverses encodeValue. data is not modified.
+func decodeValue(data []byte, userMeta byte) ([]byte, error) {
+	if userMeta&userMetaEnvelope == 0 {
+		return data, nil
+	}
+	if len(data) < envelopeHeaderLength {
+		return nil, errors.New("truncated value envelope")
+	}
+	if data[0] != envelopeVersion {
+		return nil, fmt.Errorf("%w: envelope version %d", ErrUnknownEncoding, data[0])
+	}
+	flags := data[1]
+	payload := data[envelopeHeaderLength:]
+	remaining := flags
+	var err error
+	for i := len(valueCodecs) - 1; i >= 0; i-- {
+		codec := valueCodecs[i]
+		if flags&codec.flag == 0 {
+			continue
+		}
+		payload, err = codec.decode(payload)
+		if err != nil {
+			return nil, err
+		}
+		remaining &^= codec.flag
+	}
+	if remaining != 0 {
+		return nil, fmt.Errorf("%w: flags %#02x", ErrUnknownEncoding, remaining)
+	}
+	return payload, nil
+}
+
+// valueEntry builds the badger entry storing value under key, encoded as enc
+// says. A reserved key fails with ErrReservedKey.
+func valueEntry(key []byte, value []byte, enc valueEncoding) (*badger.Entry, error) {
+	if err := checkKey(string(key)); err != nil {
+		return nil, err
+	}
+	return encodedEntry(key, value, enc)
+}
+
+// encodedEntry is valueEntry for any key, reserved ones included.
+func encodedEntry(key []byte, value []byte, enc valueEncoding) (*badger.Entry, error) {
+	data, userMeta, err := encodeValue(value, enc.flagsFor(value))
+	if err != nil {
+		return nil, err
+	}
+	return badger.NewEntry(key, data).WithMeta(userMeta), nil
+}
+
+// itemValue returns a copy of item's value with any envelope removed.
+func itemValue(item *badger.Item) ([]byte, error) {
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeValue(data, item.UserMeta())
+}
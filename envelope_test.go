@@ -0,0 +1,103 @@
+package cachekv
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const testCodecFlag byte = 1 << 7
+
+// withTestCodec registers a codec that flips every bit of the payload.
+func withTestCodec() func() {
+	flip := func(in []byte) ([]byte, error) {
+		out := make([]byte, len(in))
+		for i, b := range in {
+			out[i] = ^b
+		}
+		return out, nil
+	}
+	saved := valueCodecs
+	valueCodecs = append(valueCodecs, valueCodec{flag: testCodecFlag, encode: flip, decode: flip})
+	return func() {
+		valueCodecs = saved
+	}
+}
+
+func TestEncodeDecodeValue(t *testing.T) {
+	defer withTestCodec()()
+	data, userMeta, err := encodeValue([]byte("plain"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0), userMeta)
+	assert.Equal(t, []byte("plain"), data)
+
+	data, userMeta, err = encodeValue([]byte("value"), testCodecFlag)
+	assert.Nil(t, err)
+	assert.Equal(t, userMetaEnvelope, userMeta)
+	assert.Equal(t, []byte{envelopeVersion, testCodecFlag}, data[:envelopeHeaderLength])
+	value, err := decodeValue(data, userMeta)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	// raw values pass through
+	value, err = decodeValue([]byte{envelopeVersion, testCodecFlag}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{envelopeVersion, testCodecFlag}, value)
+
+	_, _, err = encodeValue([]byte("value"), 1<<6)
+	assert.ErrorIs(t, err, ErrUnknownEncoding)
+	_, err = decodeValue([]byte{envelopeVersion, 1 << 6}, userMetaEnvelope)
+	assert.ErrorIs(t, err, ErrUnknownEncoding)
+	_, err = decodeValue([]byte{9, 0}, userMetaEnvelope)
+	assert.ErrorIs(t, err, ErrUnknownEncoding)
+	_, err = decodeValue([]byte{envelopeVersion}, userMetaEnvelope)
+	assert.NotNil(t, err)
+}
+
+func TestEnvelopedEntries(t *testing.T) {
+	defer setup()()
+	defer withTestCodec()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	// written before the database switched encoding
+	assert.Nil(t, InsertEntry(testDb, "old", []byte("raw")))
+	dbObject, err := defaultStore.getMetaDbObject(testDb)
+	assert.Nil(t, err)
+	dbObject.Encoding = testCodecFlag
+	assert.Nil(t, defaultStore.writeMetaDbObject(testDb, dbObject, true))
+
+	assert.Nil(t, InsertEntry(testDb, "new", []byte("encoded")))
+	assert.Nil(t, BatchInsert(testDb, map[string][]byte{"batch": []byte("encoded too")}))
+	for key, expected := range map[string]string{"old": "raw", "new": "encoded", "batch": "encoded too"} {
+		value, err := GetEntry(testDb, key)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(expected), value)
+	}
+	assert.Nil(t, ViewEntry(testDb, "new", func(val []byte) error {
+		assert.Equal(t, []byte("encoded"), val)
+		return nil
+	}))
+	kvs, errs := Stream(testDb)
+	streamed := make(map[string]string)
+	for kv := range kvs {
+		streamed[string(kv.Key)] = string(kv.Value)
+	}
+	assert.Nil(t, <-errs)
+	assert.Equal(t, "encoded", streamed["new"])
+	assert.Equal(t, "raw", streamed["old"])
+
+	storage, err := GetStorageObject(testDb)
+	assert.Nil(t, err)
+	err = storage.db.View(func(txn *badger.Txn) error {
+		item, e := txn.Get([]byte("new"))
+		if e != nil {
+			return e
+		}
+		assert.Equal(t, userMetaEnvelope, item.UserMeta())
+		raw, e := item.ValueCopy(nil)
+		assert.NotEqual(t, []byte("encoded"), raw)
+		return e
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, CloseDatabase(storage.db))
+}
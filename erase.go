@@ -0,0 +1,169 @@
+package cachekv
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+const eraseChunk = 1 << 20
+
+// SecureErase destroys the whole store for decommissioning: every registered
+// database, the meta db, the keyring and the keypair, archived copies
+// included, whether the keypair lives in files or in the OS keyring. The keyring is emptied first, then every file is overwritten with
+// random data and synced before it's removed. Storage handles still held by
+// the caller must be closed beforehand.
+//
+// This is best effort. Overwriting a file in place doesn't guarantee the old
+// blocks are gone on SSDs (wear levelling, TRIM), on copy-on-write
+// filesystems such as btrfs or ZFS, or where a journal keeps data blocks. Use
+// full-disk encryption or a device-level erase when that guarantee matters.
+func (s *Store) SecureErase() error {
+	var errs []error
+	s.stopIntegrityChecks()
+	// open handles would keep writing to files being overwritten
+	if err := s.closeAllDbs(); err != nil {
+		logger().Errorf("error closing databases for erase: %v", err)
+		errs = append(errs, err)
+	}
+	dirs := make([]string, 0)
+	dbs, err := s.listDatabases()
+	if err != nil {
+		logger().Errorf("error listing databases for erase: %v", err)
+		errs = append(errs, err)
+	}
+	for _, dbObject := range dbs {
+		dirs = append(dirs, path.Join(dbObject.DbPath, dbObject.DbFile))
+	}
+	err = s.clearKeyring()
+	if err != nil {
+		logger().Errorf("error clearing keyring: %v", err)
+		errs = append(errs, err)
+	}
+	if err = s.closeInternalDbs(); err != nil {
+		errs = append(errs, err)
+	}
+	// the store path holds the meta and key dbs, and usually the databases too
+	dirs = append(dirs, s.storeDir())
+	for _, dir := range dirs {
+		err = eraseTree(dir)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	err = eraseKeypairFiles(s.keyDir())
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if KeypairInKeyring {
+		// the service only holds the keypair and its archived copies; a
+		// keypair from before stores had their own service is left in the
+		// shared one, which other stores may still read theirs from
+		if err = keyring.DeleteAll(s.keyringService()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.meta = Storage{store: s}
+	s.key = Storage{store: s}
+	s.startupMu.Lock()
+	s.started = false
+	s.startupMu.Unlock()
+	s.config = nil
+	return errors.Join(errs...)
+}
+
+// SecureErase calls Store.SecureErase on the default store.
+func SecureErase() error {
+	return defaultStore.SecureErase()
+}
+
+func (s *Store) clearKeyring() error {
+	db, err := s.openKeyring()
+	if err != nil {
+		return err
+	}
+	defer s.releaseKeyring()
+	return db.DropAll()
+}
+
+// eraseTree overwrites every regular file below root and removes the tree.
+func eraseTree(root string) error {
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil
+	}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			return overwriteFile(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(root)
+}
+
+// eraseKeypairFiles wipes the current and archived keypair files in dir, then
+// removes dir itself if nothing else is left in it.
+func eraseKeypairFiles(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, privateFile) && !strings.HasPrefix(name, publicFile) {
+			continue
+		}
+		p := path.Join(dir, name)
+		if err = overwriteFile(p); err != nil {
+			return err
+		}
+		if err = os.Remove(p); err != nil {
+			return err
+		}
+	}
+	if remaining, e := os.ReadDir(dir); e == nil && len(remaining) == 0 {
+		return os.Remove(dir)
+	}
+	return nil
+}
+
+func overwriteFile(p string) error {
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(p, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			logger().Errorf("Error closing file: %v", err)
+		}
+	}(file)
+	remaining := info.Size()
+	for remaining > 0 {
+		n := min(remaining, eraseChunk)
+		if _, err = io.CopyN(file, rand.Reader, n); err != nil {
+			return err
+		}
+		remaining -= n
+	}
+	return file.Sync()
+}
@@ -0,0 +1,38 @@
+package cachekv
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecureErase(t *testing.T) {
+	defer setup()()
+	cfg, err := ListConfigurations()
+	assert.Nil(t, err)
+	cfg.StorePath = alternateTestStorePath
+	assert.Nil(t, UpdateConfigurations(cfg))
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, InsertEntry("testdb", "key", []byte("secret")))
+	dbObject, err := defaultStore.getMetaDbObject("testdb")
+	assert.Nil(t, err)
+	dbPath := path.Join(dbObject.DbPath, dbObject.DbFile)
+	// unrelated files next to the keypair must survive
+	otherFile := path.Join(KeyPath, "unrelated.txt")
+	assert.Nil(t, os.WriteFile(otherFile, []byte("keep"), 0600))
+
+	assert.Nil(t, SecureErase())
+	_, err = os.Stat(dbPath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(StorePath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(KeyPath, privateFile))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(KeyPath, publicFile))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(otherFile)
+	assert.Nil(t, err)
+	assert.False(t, defaultStore.checkMetaFile())
+}
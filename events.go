@@ -0,0 +1,206 @@
+package cachekv
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// SetEventBuffering collects events in memory and writes them to meta in
+// batches, which takes most of the audit log's write load off busy stores.
+// Events still in the buffer are lost if the process dies, so call Shutdown
+// or FlushEvents before exiting; a Size of 1 turns buffering off for users who
+// put durability first. Buffered events show up in ExportEvents once flushed.
+// Events are keyed by millisecond just as when written directly, so a later
+// event in the same millisecond replaces an earlier one either way. Whatever
+// was buffered under the previous options is flushed first.
+func (s *Store) SetEventBuffering(opts EventBufferOptions) error {
+	err := s.FlushEvents()
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+	s.eventOptions = opts
+	return err
+}
+
+// SetEventBuffering calls Store.SetEventBuffering on the default store.
+func SetEventBuffering(opts EventBufferOptions) error {
+	return defaultStore.SetEventBuffering(opts)
+}
+
+// FlushEvents writes the buffered events to meta in one batch.
+func (s *Store) FlushEvents() error {
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+	return s.flushEventsLocked()
+}
+
+// FlushEvents calls Store.FlushEvents on the default store.
+func FlushEvents() error {
+	return defaultStore.FlushEvents()
+}
+
+func (s *Store) flushEventsLocked() error {
+	if len(s.eventBuffer) == 0 {
+		return nil
+	}
+	err := s.metaBatchInsert(&s.eventBuffer)
+	if err != nil {
+		// keep them for the next flush
+		return err
+	}
+	s.eventBuffer = make(map[string][]byte)
+	return nil
+}
+
+// bufferEvent holds an event when buffering is on, flushing once the buffer
+// is full or due. buffered is false when the caller must write it itself.
+func (s *Store) bufferEvent(key string, value []byte) (buffered bool, err error) {
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+	if s.eventOptions.Size <= 1 {
+		return false, nil
+	}
+	if len(s.eventBuffer) == 0 {
+		s.eventBuffered = clock()
+	}
+	s.eventBuffer[key] = value
+	due := s.eventOptions.FlushInterval > 0 && clock().Sub(s.eventBuffered) >= s.eventOptions.FlushInterval
+	if len(s.eventBuffer) >= s.eventOptions.Size || due {
+		return true, s.flushEventsLocked()
+	}
+	return true, nil
+}
+
+// eventKey is the meta key of an event recorded at tstamp (UnixMilli). The
+// timestamp is encoded fixed-width, so that key order is time order, and is
+// followed by seq, so that events recorded in the same millisecond don't
+// overwrite each other.
+func eventKey(tstamp int64, seq uint64) string {
+	return prefixMetaEvent + EncodeSortableInt(tstamp) + ":" + EncodeSortableInt(int64(seq))
+}
+
+// iterateEvents calls fn for every event with from <= TSTamp <= to, oldest
+// first. Event keys sort by time, so seeking to the encoded lower bound skips
+// everything older without reading it.
+func (s *Store) iterateEvents(from, to int64, fn func(event Event) error) error {
+	db, err := s.openMeta()
+	if err != nil {
+		return err
+	}
+	defer s.releaseMeta()
+	return db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		emit := func(item *badger.Item) error {
+			var event Event
+			e := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &event)
+			})
+			if e != nil {
+				return e
+			}
+			return fn(event)
+		}
+		prefix := []byte(prefixMetaEvent)
+		// stores from before event keys were fixed-width still hold events
+		// keyed by decimal timestamps; those sort before the fixed-width
+		// keys and are filtered rather than sought, as their width varies
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			encoded := strings.TrimPrefix(string(item.Key()), prefixMetaEvent)
+			if len(encoded) >= sortableIntLength {
+				break
+			}
+			tstamp, e := strconv.ParseInt(encoded, 10, 64)
+			if e != nil || tstamp < from || tstamp > to {
+				continue
+			}
+			if e = emit(item); e != nil {
+				return e
+			}
+		}
+		// events from before the sequence number was added are keyed by
+		// the timestamp alone
+		for it.Seek([]byte(prefixMetaEvent + EncodeSortableInt(from))); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			encoded := strings.TrimPrefix(string(item.Key()), prefixMetaEvent)
+			if len(encoded) < sortableIntLength {
+				continue
+			}
+			tstamp, e := DecodeSortableInt(encoded[:sortableIntLength])
+			if e != nil {
+				continue
+			}
+			if tstamp > to {
+				break
+			}
+			if e = emit(item); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+}
+
+// ExportEvents writes the events recorded between from and to (inclusive,
+// UnixMilli) to w as newline-delimited JSON, one Event per line, oldest first.
+// Events are written as they are read, so the whole log is never held in
+// memory.
+func (s *Store) ExportEvents(from, to int64, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	return s.iterateEvents(from, to, func(event Event) error {
+		return encoder.Encode(event)
+	})
+}
+
+// ExportEvents calls Store.ExportEvents on the default store.
+func ExportEvents(from, to int64, w io.Writer) error {
+	return defaultStore.ExportEvents(from, to, w)
+}
+
+// ListEventsForDatabase returns the events recorded about dbName, oldest
+// first. Events recorded before they carried a database name aren't included.
+func (s *Store) ListEventsForDatabase(dbName string) ([]Event, error) {
+	events := make([]Event, 0)
+	err := s.iterateEvents(0, math.MaxInt64, func(event Event) error {
+		if event.DbName == dbName {
+			events = append(events, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ListEventsForDatabase calls Store.ListEventsForDatabase on the default store.
+func ListEventsForDatabase(dbName string) ([]Event, error) {
+	return defaultStore.ListEventsForDatabase(dbName)
+}
+
+// ListEvents returns the most recent limit events recorded at or after since
+// (UnixMilli), oldest first. A limit of 0 or less returns all of them.
+func (s *Store) ListEvents(since int64, limit int) ([]Event, error) {
+	events := make([]Event, 0)
+	err := s.iterateEvents(since, math.MaxInt64, func(event Event) error {
+		events = append(events, event)
+		if limit > 0 && len(events) > limit {
+			events = events[1:]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ListEvents calls Store.ListEvents on the default store.
+func ListEvents(since int64, limit int) ([]Event, error) {
+	return defaultStore.ListEvents(since, limit)
+}
@@ -0,0 +1,234 @@
+package cachekv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportEvents(t *testing.T) {
+	defer setup()()
+	start := time.Now().UnixMilli()
+	advance, restore := fixClock(time.UnixMilli(start))
+	defer restore()
+	assert.Nil(t, CreateDatabase("testdb1", true))
+	advance(time.Millisecond)
+	assert.Nil(t, CreateDatabase("testdb2", false))
+
+	var buffer bytes.Buffer
+	assert.Nil(t, ExportEvents(start, math.MaxInt64, &buffer))
+	var events []Event
+	scanner := bufio.NewScanner(&buffer)
+	for scanner.Scan() {
+		var event Event
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	assert.Greater(t, len(events), 0)
+	created := 0
+	for i, event := range events {
+		assert.GreaterOrEqual(t, event.TSTamp, start)
+		if i > 0 {
+			assert.GreaterOrEqual(t, event.TSTamp, events[i-1].TSTamp)
+		}
+		if event.Type == EventTypeCreate {
+			created++
+		}
+	}
+	assert.Equal(t, 2, created)
+
+	// nothing lies before the store was initialised
+	buffer.Reset()
+	assert.Nil(t, ExportEvents(0, 1, &buffer))
+	assert.Equal(t, 0, buffer.Len())
+}
+
+func countEvents(t *testing.T) int {
+	count := 0
+	assert.Nil(t, defaultStore.iterateEvents(0, math.MaxInt64, func(event Event) error {
+		count++
+		return nil
+	}))
+	return count
+}
+
+func TestEventBuffering(t *testing.T) {
+	defer setup()()
+	defer func() { assert.Nil(t, SetEventBuffering(EventBufferOptions{})) }()
+	advance, restore := fixClock(time.UnixMilli(1700000000000))
+	defer restore()
+	before := countEvents(t)
+	assert.Nil(t, SetEventBuffering(EventBufferOptions{Size: 3}))
+
+	assert.Nil(t, defaultStore.writeMetaEvent(EventTypeWrite, "one"))
+	advance(time.Millisecond)
+	assert.Nil(t, defaultStore.writeMetaEvent(EventTypeWrite, "two"))
+	advance(time.Millisecond)
+	assert.Equal(t, before, countEvents(t))
+	// the third fills the buffer
+	assert.Nil(t, defaultStore.writeMetaEvent(EventTypeWrite, "three"))
+	advance(time.Millisecond)
+	assert.Equal(t, before+3, countEvents(t))
+
+	assert.Nil(t, defaultStore.writeMetaEvent(EventTypeWrite, "four"))
+	advance(time.Millisecond)
+	assert.Equal(t, before+3, countEvents(t))
+	assert.Nil(t, Shutdown())
+	assert.Equal(t, before+4, countEvents(t))
+
+	// a due buffer is flushed by the next event
+	assert.Nil(t, SetEventBuffering(EventBufferOptions{Size: 100, FlushInterval: time.Second}))
+	assert.Nil(t, defaultStore.writeMetaEvent(EventTypeWrite, "five"))
+	advance(2 * time.Second)
+	assert.Nil(t, defaultStore.writeMetaEvent(EventTypeWrite, "six"))
+	assert.Equal(t, before+6, countEvents(t))
+}
+
+func TestListEventsForDatabase(t *testing.T) {
+	defer setup()()
+	advance, restore := fixClock(time.Now())
+	defer restore()
+	// events recorded in the same millisecond are all kept
+	assert.Nil(t, CreateDatabase("testdb", true))
+	advance(time.Millisecond)
+	assert.Nil(t, CreateDatabase("testdb2", true))
+	advance(time.Millisecond)
+	assert.Nil(t, UpdateEntry("testdb", "key", []byte("value")))
+	advance(time.Millisecond)
+	assert.Nil(t, DeleteDatabase("testdb"))
+
+	events, err := ListEventsForDatabase("testdb")
+	assert.Nil(t, err)
+	types := make([]EventType, 0, len(events))
+	for _, event := range events {
+		assert.Equal(t, "testdb", event.DbName)
+		types = append(types, event.Type)
+	}
+	expected := []EventType{EventTypeCreate, EventTypeRead, EventTypeUpdate, EventTypeRead, EventTypeDelete}
+	assert.Equal(t, expected, types)
+
+	events, err = ListEventsForDatabase("testdb2")
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, EventTypeCreate, events[0].Type)
+}
+
+func TestListEvents(t *testing.T) {
+	defer setup()()
+	start := time.Now()
+	advance, restore := fixClock(start)
+	defer restore()
+	names := []string{"testdb1", "testdb2", "testdb3", "testdb4"}
+	for _, name := range names {
+		assert.Nil(t, CreateDatabase(name, true))
+		advance(time.Millisecond)
+	}
+
+	events, err := ListEvents(start.UnixMilli(), 0)
+	assert.Nil(t, err)
+	created := make([]string, 0, len(events))
+	for i, event := range events {
+		if i > 0 {
+			assert.LessOrEqual(t, events[i-1].TSTamp, event.TSTamp)
+		}
+		if event.Type == EventTypeCreate {
+			created = append(created, event.DbName)
+		}
+	}
+	assert.Equal(t, names, created)
+
+	events, err = ListEvents(start.UnixMilli(), 2)
+	assert.Nil(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "testdb3", events[0].DbName)
+	assert.Equal(t, "testdb4", events[1].DbName)
+
+	events, err = ListEvents(start.Add(2*time.Millisecond).UnixMilli(), 0)
+	assert.Nil(t, err)
+	assert.Len(t, events, 2)
+}
+
+func TestListEventsSmallSince(t *testing.T) {
+	defer setup()()
+	start := time.Now().UnixMilli()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	// a decimal key as stores wrote them before keys were fixed-width
+	legacy := Event{Type: EventTypeWrite, Comment: "legacy", TSTamp: start - 1000}
+	value, err := json.Marshal(legacy)
+	assert.Nil(t, err)
+	assert.Nil(t, defaultStore.writeMetaEntry(prefixMetaEvent+strconv.FormatInt(legacy.TSTamp, 10), value))
+
+	for _, since := range []int64{200, 5, 1} {
+		events, err := ListEvents(since, 0)
+		assert.Nil(t, err)
+		assert.Greater(t, len(events), 1)
+		assert.Equal(t, "legacy", events[0].Comment)
+		created := false
+		for i, event := range events {
+			if i > 0 {
+				assert.LessOrEqual(t, events[i-1].TSTamp, event.TSTamp)
+			}
+			created = created || event.Type == EventTypeCreate && event.DbName == "testdb"
+		}
+		assert.True(t, created)
+	}
+
+	var buffer bytes.Buffer
+	assert.Nil(t, ExportEvents(5, start-1, &buffer))
+	assert.Contains(t, buffer.String(), `"legacy"`)
+	assert.NotContains(t, buffer.String(), `"testdb"`)
+	buffer.Reset()
+	assert.Nil(t, ExportEvents(start, math.MaxInt64, &buffer))
+	assert.NotContains(t, buffer.String(), `"legacy"`)
+	assert.Contains(t, buffer.String(), `"testdb"`)
+}
+
+func TestDataEvents(t *testing.T) {
+	defer setup()()
+	start := time.Now()
+	advance, restore := fixClock(start)
+	defer restore()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	advance(time.Millisecond)
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	advance(time.Millisecond)
+	_, err := GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	advance(time.Millisecond)
+
+	cfg, err := ListConfigurations()
+	assert.Nil(t, err)
+	cfg.AuditReads = true
+	assert.Nil(t, UpdateConfigurations(cfg))
+	advance(time.Millisecond)
+	_, err = GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	advance(time.Millisecond)
+	// a miss isn't a read
+	_, err = GetEntry(testDb, "missing")
+	assert.NotNil(t, err)
+
+	events, err := ListEventsForDatabase(testDb)
+	assert.Nil(t, err)
+	// looking the database up records reads of its own
+	data := make([]Event, 0)
+	for _, event := range events {
+		if strings.HasSuffix(event.Comment, "entry: testdb:key") {
+			data = append(data, event)
+		}
+	}
+	if assert.Len(t, data, 2) {
+		assert.Equal(t, EventTypeWrite, data[0].Type)
+		assert.Equal(t, "Wrote entry: testdb:key", data[0].Comment)
+		assert.Equal(t, EventTypeRead, data[1].Type)
+		assert.Equal(t, "Read entry: testdb:key", data[1].Comment)
+	}
+}
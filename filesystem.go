@@ -0,0 +1,42 @@
+package cachekv
+
+import (
+	"errors"
+	"fmt"
+)
+
+// FailOnUnsupportedFilesystem makes Startup fail with ErrUnsupportedFilesystem,
+// instead of only logging a warning, when StorePath is on a filesystem badger
+// is known to misbehave on, see CheckFilesystem.
+var FailOnUnsupportedFilesystem = false
+
+var ErrUnsupportedFilesystem = errors.New("filesystem is not supported by badger")
+
+// CheckFilesystem reports, with ErrUnsupportedFilesystem, when dir is on a
+// network or FUSE filesystem. badger relies on mmap and directory locks that
+// such filesystems don't honour reliably, and the corruption that follows
+// tends to surface long after the fact. Detection uses statfs and is only
+// available on Linux; elsewhere it always passes.
+func CheckFilesystem(dir string) error {
+	fsName, err := unsupportedFilesystem(dir)
+	if err != nil {
+		return err
+	}
+	if fsName != "" {
+		return fmt.Errorf("%s is on %s: %w", dir, fsName, ErrUnsupportedFilesystem)
+	}
+	return nil
+}
+
+// checkStoreFilesystem runs CheckFilesystem on the store path for Startup.
+func (s *Store) checkStoreFilesystem() error {
+	err := CheckFilesystem(s.storeDir())
+	if err == nil {
+		return nil
+	}
+	if FailOnUnsupportedFilesystem {
+		return fmt.Errorf("error checking store dir: %w", err)
+	}
+	logger().Errorf("warning: %v", err)
+	return nil
+}
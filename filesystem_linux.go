@@ -0,0 +1,32 @@
+//go:build linux
+
+package cachekv
+
+import "syscall"
+
+// networkFilesystems maps statfs magic numbers to names for the filesystems
+// CheckFilesystem rejects. The magic numbers are 32 bits wide whatever the
+// width of Statfs_t.Type. Overlay filesystems aren't listed: container
+// storage commonly uses them, and badger works on them when the upper layer
+// is a local disk.
+var networkFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x5346414f: "afs",
+	0x01021997: "9p",
+	0x00c36400: "ceph",
+	0x013111a8: "ibrix",
+	0x47504653: "gpfs",
+	0x0bd00bd0: "lustre",
+}
+
+func unsupportedFilesystem(dir string) (string, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return "", err
+	}
+	return networkFilesystems[uint32(stat.Type)], nil
+}
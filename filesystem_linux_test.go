@@ -0,0 +1,15 @@
+//go:build linux
+
+package cachekv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFilesystemMissingDir(t *testing.T) {
+	err := CheckFilesystem("./does-not-exist")
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, ErrUnsupportedFilesystem)
+}
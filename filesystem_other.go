@@ -0,0 +1,7 @@
+//go:build !linux
+
+package cachekv
+
+func unsupportedFilesystem(dir string) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,14 @@
+package cachekv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFilesystem(t *testing.T) {
+	defer setup()()
+	// the test store lives on a local disk
+	assert.Nil(t, CheckFilesystem(StorePath))
+	assert.Nil(t, CheckFilesystem(t.TempDir()))
+}
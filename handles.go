@@ -0,0 +1,388 @@
+package cachekv
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// DrainTimeout is how long closing a database's shared handle, for
+// CloseDatabaseByName, a key rotation, Shutdown and the like, waits for the
+// operations using it before failing with ErrDbBusy. Operations that start
+// meanwhile wait for the close. A Storage, Reader, MultiSnapshot or Counters
+// uses the handle until it is closed, so this also bounds the wait for one
+// that is still open, or whose holder started another operation on the same
+// database and is waiting for it.
+var DrainTimeout = 10 * time.Second
+
+// Opening a badger database replays its manifest and value log, so instead
+// of paying that per operation openDbByName keeps one handle per database
+// open and hands it to every operation. Each operation holds the database's
+// gate for reading until releaseDb; taking the gate for writing drains them,
+// after which the handle can be closed. Anything that opens a database's
+// directory itself, or moves it, has to evict the shared handle first,
+// since badger holds an exclusive lock on the directory while it is open.
+type dbHandle struct {
+	gate handleGate
+	// mu guards db and path. The first open happens under it, so concurrent
+	// first uses don't race for the directory lock.
+	mu    sync.Mutex
+	db    *badger.DB
+	path  string
+	name  string
+	store *Store
+	// internal is set for the meta db's and the key db's handles, which
+	// don't take open slots and are only closed by Shutdown or a change of
+	// directory or key.
+	internal bool
+}
+
+var errStaleHandle = errors.New("database handle is for another directory")
+
+func (s *Store) dbHandleFor(dbName string) *dbHandle {
+	s.handlesMu.Lock()
+	defer s.handlesMu.Unlock()
+	handle, ok := s.handles[dbName]
+	if !ok {
+		handle = &dbHandle{store: s, name: dbName}
+		s.handles[dbName] = handle
+	}
+	return handle
+}
+
+func (s *Store) dbGate(dbName string) *handleGate {
+	return &s.dbHandleFor(dbName).gate
+}
+
+// handleGate is a read-write lock whose writers give up: Lock waits at most
+// DrainTimeout for the readers to leave, holding back the ones that arrive
+// meanwhile, and fails with ErrDbBusy if they don't. A reader that the
+// writer is waiting for can therefore start another operation on the same
+// database without deadlocking; it waits until the writer gives up.
+type handleGate struct {
+	mu      sync.Mutex
+	readers int
+	writing bool
+	waiting int
+	// changed is closed, and replaced, whenever the fields above change in
+	// a way a waiter cares about.
+	changed chan struct{}
+}
+
+// wait returns the channel closed at the next change; the caller holds mu.
+func (g *handleGate) wait() <-chan struct{} {
+	if g.changed == nil {
+		g.changed = make(chan struct{})
+	}
+	return g.changed
+}
+
+// notify wakes the waiters; the caller holds mu.
+func (g *handleGate) notify() {
+	if g.changed != nil {
+		close(g.changed)
+		g.changed = nil
+	}
+}
+
+func (g *handleGate) RLock() {
+	g.mu.Lock()
+	for g.writing || g.waiting > 0 {
+		changed := g.wait()
+		g.mu.Unlock()
+		<-changed
+		g.mu.Lock()
+	}
+	g.readers++
+	g.mu.Unlock()
+}
+
+func (g *handleGate) RUnlock() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.readers--
+	if g.readers == 0 {
+		g.notify()
+	}
+}
+
+// Lock waits up to DrainTimeout for the gate's readers and its writer to
+// leave, and fails with ErrDbBusy if they don't.
+func (g *handleGate) Lock() error {
+	timeout := time.NewTimer(DrainTimeout)
+	defer timeout.Stop()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.waiting++
+	defer func() {
+		g.waiting--
+		g.notify()
+	}()
+	for g.writing || g.readers > 0 {
+		changed := g.wait()
+		g.mu.Unlock()
+		select {
+		case <-changed:
+		case <-timeout.C:
+			g.mu.Lock()
+			return ErrDbBusy
+		}
+		g.mu.Lock()
+	}
+	g.writing = true
+	return nil
+}
+
+// TryLock takes the gate for writing if nobody has it or is waiting for it.
+func (g *handleGate) TryLock() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.writing || g.readers > 0 || g.waiting > 0 {
+		return false
+	}
+	g.writing = true
+	return true
+}
+
+func (g *handleGate) Unlock() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.writing = false
+	g.notify()
+}
+
+// lockDb takes dbName's gate for writing, see handleGate.Lock, and closes its
+// shared handle; the caller unlocks the gate when done with the directory.
+func (s *Store) lockDb(dbName string) (*handleGate, error) {
+	handle := s.dbHandleFor(dbName)
+	if err := handle.gate.Lock(); err != nil {
+		return nil, fmt.Errorf("%s - %w", dbName, err)
+	}
+	if err := handle.close(); err != nil {
+		handle.gate.Unlock()
+		return nil, err
+	}
+	return &handle.gate, nil
+}
+
+// acquire returns the open handle for dbPath, opening it with open if there
+// is none yet. It fails with errStaleHandle if the open handle is for a
+// different directory. The caller holds the gate for reading.
+func (h *dbHandle) acquire(dbPath string, open func() (*badger.DB, error)) (*badger.DB, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.db != nil {
+		if h.path != dbPath {
+			return nil, errStaleHandle
+		}
+		return h.db, nil
+	}
+	if !h.internal {
+		if err := h.store.acquireOpenSlot(h.name); err != nil {
+			return nil, err
+		}
+	}
+	db, err := open()
+	if err != nil {
+		if !h.internal {
+			h.store.releaseOpenSlot()
+		}
+		return nil, err
+	}
+	h.db = db
+	h.path = dbPath
+	return db, nil
+}
+
+// close closes the handle if one is open; the caller holds the gate for
+// writing.
+func (h *dbHandle) close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.db == nil {
+		return nil
+	}
+	err := CloseDatabase(h.db)
+	h.db = nil
+	h.path = ""
+	if !h.internal {
+		h.store.releaseOpenSlot()
+	}
+	return err
+}
+
+// releaseDb hands back a handle obtained from openDbByName. The handle
+// itself stays open for the next operation.
+func (s *Store) releaseDb(dbName string, db *badger.DB) error {
+	s.dbGate(dbName).RUnlock()
+	return nil
+}
+
+func (h *dbHandle) isOpen() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.db != nil
+}
+
+func (s *Store) hasOpenHandle(dbName string) bool {
+	return s.dbHandleFor(dbName).isOpen()
+}
+
+// evictDb waits for the operations running against dbName and closes its
+// shared handle, failing with ErrDbBusy if they don't finish within
+// DrainTimeout.
+func (s *Store) evictDb(dbName string) error {
+	gate, err := s.lockDb(dbName)
+	if err != nil {
+		return err
+	}
+	gate.Unlock()
+	return nil
+}
+
+// closeAllDbs evicts every shared handle, for Shutdown and SecureErase.
+func (s *Store) closeAllDbs() error {
+	s.handlesMu.Lock()
+	names := make([]string, 0, len(s.handles))
+	for dbName := range s.handles {
+		names = append(names, dbName)
+	}
+	s.handlesMu.Unlock()
+	var errs []error
+	for _, dbName := range names {
+		if err := s.evictDb(dbName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// openMeta returns the meta db's shared handle, opening it on first use. The
+// caller hands it back with releaseMeta, and must not close it.
+func (s *Store) openMeta() (*badger.DB, error) {
+	if s.meta.rotatingKey {
+		return nil, errors.New(errDbRotating)
+	}
+	return s.acquireMeta()
+}
+
+// acquireMeta is openMeta for the meta rotation, which raises the rotating
+// flag itself.
+func (s *Store) acquireMeta() (*badger.DB, error) {
+	return s.acquireInternalDb(&s.metaHandle, path.Join(s.meta.path, s.meta.file), s.meta.key)
+}
+
+func (s *Store) releaseMeta() {
+	s.metaHandle.gate.RUnlock()
+}
+
+// openKeyring returns the key db's shared handle, as openMeta does the meta
+// db's; releaseKeyring hands it back.
+func (s *Store) openKeyring() (*badger.DB, error) {
+	if s.key.rotatingKey {
+		return nil, errors.New(errDbRotating)
+	}
+	return s.acquireInternalDb(&s.keyHandle, path.Join(s.key.path, s.key.file), s.key.key)
+}
+
+func (s *Store) releaseKeyring() {
+	s.keyHandle.gate.RUnlock()
+}
+
+// acquireInternalDb takes handle for reading and returns its db, opened at
+// dbPath with key. A handle left open on another directory is closed first.
+func (s *Store) acquireInternalDb(handle *dbHandle, dbPath string, key []byte) (*badger.DB, error) {
+	open := func() (*badger.DB, error) {
+		return s.OpenDatabase(dbPath, key)
+	}
+	handle.gate.RLock()
+	db, err := handle.acquire(dbPath, open)
+	if errors.Is(err, errStaleHandle) {
+		handle.gate.RUnlock()
+		if err = s.closeInternalDb(handle); err != nil {
+			return nil, err
+		}
+		handle.gate.RLock()
+		db, err = handle.acquire(dbPath, open)
+	}
+	if err != nil {
+		handle.gate.RUnlock()
+		return nil, err
+	}
+	return db, nil
+}
+
+// closeInternalDb waits for the operations using handle, up to DrainTimeout,
+// and closes it.
+func (s *Store) closeInternalDb(handle *dbHandle) error {
+	if err := handle.gate.Lock(); err != nil {
+		return fmt.Errorf("%s - %w", handle.name, err)
+	}
+	defer handle.gate.Unlock()
+	return handle.close()
+}
+
+// closeInternalDbs closes the meta db's and the key db's handles, for
+// Shutdown and SecureErase; the meta db goes first, as writing to it may need
+// the keyring.
+func (s *Store) closeInternalDbs() error {
+	return errors.Join(s.closeInternalDb(&s.metaHandle), s.closeInternalDb(&s.keyHandle))
+}
+
+// CloseDatabaseByName waits for the operations running against dbName to
+// finish and closes the handle they share, e.g. before taking it offline for
+// maintenance. New operations on dbName wait until it returns, and the next
+// one opens the database again; other databases aren't affected. Closing a
+// badger handle flushes its pending writes, so on return everything written
+// to dbName is on disk. If the running operations don't finish within
+// DrainTimeout it fails with ErrDbBusy and leaves the handle open.
+func (s *Store) CloseDatabaseByName(dbName string) error {
+	if _, err := s.getMetaDbObject(dbName); err != nil {
+		return err
+	}
+	return s.evictDb(dbName)
+}
+
+// CloseDatabaseByName calls Store.CloseDatabaseByName on the default store.
+func CloseDatabaseByName(dbName string) error {
+	return defaultStore.CloseDatabaseByName(dbName)
+}
+
+// OpenStorage returns a Storage on dbName's shared handle, the one the
+// store's own operations use, so it costs no open of its own once the
+// database has been used. Until Close it counts as a running operation:
+// CloseDatabaseByName, key rotation, Shutdown and the like wait for it, up
+// to DrainTimeout, and fail with ErrDbBusy if it is still open by then.
+// Operations on dbName started while they wait, from the goroutine holding
+// the Storage too, wait with them, so prefer the Storage's own methods.
+func (s *Store) OpenStorage(dbName string) (*Storage, error) {
+	db, dbObject, err := s.openDbByName(dbName)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{
+		store:      s,
+		db:         db,
+		path:       dbObject.DbPath,
+		file:       dbObject.DbFile,
+		name:       dbName,
+		encoding:   s.writeEncoding(dbObject),
+		maxValue:   dbObject.MaxValueSize,
+		defaultTTL: dbObject.DefaultTTL,
+		active:     dbObject.Active,
+		secure:     dbObject.Secure,
+		readOnly:   dbObject.ReadOnly,
+		release: func() error {
+			return s.releaseDb(dbName, db)
+		},
+	}, nil
+}
+
+// OpenStorage calls Store.OpenStorage on the default store.
+func OpenStorage(dbName string) (*Storage, error) {
+	return defaultStore.OpenStorage(dbName)
+}
@@ -0,0 +1,232 @@
+package cachekv
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloseDatabaseByName(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, CreateDatabase("other", true))
+	entries := make(map[string][]byte)
+	for i := 0; i < 2*streamBuffer; i++ {
+		entries["key"+strconv.Itoa(i)] = []byte("value")
+	}
+	assert.Nil(t, BatchInsert(testDb, entries))
+
+	// a stream nobody reads from keeps its handle busy
+	kvs, errs := Stream(testDb)
+	<-kvs
+	closed := make(chan error)
+	go func() {
+		closed <- CloseDatabaseByName(testDb)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("CloseDatabaseByName returned while a stream was in flight")
+	case <-time.After(200 * time.Millisecond):
+	}
+	// other databases stay usable meanwhile
+	assert.Nil(t, InsertEntry("other", "key", []byte("value")))
+	count := 1
+	for range kvs {
+		count++
+	}
+	assert.Nil(t, <-errs)
+	assert.Equal(t, len(entries), count)
+	assert.Nil(t, <-closed)
+
+	value, err := GetEntry(testDb, "key0")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.NotNil(t, CloseDatabaseByName("missing"))
+}
+
+func TestSharedHandle(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	first, _, err := defaultStore.openDbByName(testDb)
+	assert.Nil(t, err)
+	assert.Nil(t, defaultStore.releaseDb(testDb, first))
+	again, _, err := defaultStore.openDbByName(testDb)
+	assert.Nil(t, err)
+	assert.Nil(t, defaultStore.releaseDb(testDb, again))
+	assert.Same(t, first, again)
+	assert.False(t, first.IsClosed())
+
+	// OpenStorage shares it too
+	storage, err := OpenStorage(testDb)
+	assert.Nil(t, err)
+	assert.Same(t, first, storage.db)
+	value, err := storage.GetEntry("key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.Nil(t, storage.Close())
+
+	assert.Nil(t, CloseDatabaseByName(testDb))
+	assert.True(t, first.IsClosed())
+	value, err = GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	// a Storage of its own takes over the directory
+	storage, err = GetStorageObject(testDb)
+	assert.Nil(t, err)
+	assert.False(t, defaultStore.hasOpenHandle(testDb))
+	assert.Nil(t, storage.Close())
+
+	assert.Nil(t, InsertEntry(testDb, "other", []byte("value")))
+	assert.Nil(t, Shutdown())
+	assert.False(t, defaultStore.hasOpenHandle(testDb))
+}
+
+func benchmarkGetEntry(b *testing.B, reopen bool) {
+	defer setup()()
+	testDb := "testdb"
+	if err := CreateDatabase(testDb, true); err != nil {
+		b.Fatal(err)
+	}
+	if err := InsertEntry(testDb, "key", []byte("value")); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if reopen {
+			// what every operation paid before handles were shared
+			if err := CloseDatabaseByName(testDb); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if _, err := GetEntry(testDb, "key"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetEntrySharedHandle(b *testing.B) {
+	benchmarkGetEntry(b, false)
+}
+
+func BenchmarkGetEntryReopen(b *testing.B) {
+	benchmarkGetEntry(b, true)
+}
+
+func TestOpenStorageHoldsHandle(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+
+	storage, err := OpenStorage(testDb)
+	assert.Nil(t, err)
+	closed := make(chan error)
+	go func() {
+		closed <- CloseDatabaseByName(testDb)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("CloseDatabaseByName returned while a Storage was open")
+	case <-time.After(200 * time.Millisecond):
+	}
+	// the Storage's own methods keep working meanwhile
+	value, err := storage.GetEntry("key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.Nil(t, storage.Close())
+	assert.Nil(t, <-closed)
+
+	// as does a scan's callback
+	release := make(chan struct{})
+	scanned := make(chan error)
+	go func() {
+		scanned <- ScanPrefix(testDb, "", func(key string, value []byte) error {
+			<-release
+			return nil
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	go func() {
+		closed <- CloseDatabaseByName(testDb)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("CloseDatabaseByName returned while a scan was in flight")
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(release)
+	assert.Nil(t, <-scanned)
+	assert.Nil(t, <-closed)
+}
+
+func TestDrainTimeout(t *testing.T) {
+	defer setup()()
+	defer func(timeout time.Duration) { DrainTimeout = timeout }(DrainTimeout)
+	DrainTimeout = 500 * time.Millisecond
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+
+	// an operation from the Storage's holder, made while a close waits for
+	// the Storage, waits for the close to give up rather than forever
+	storage, err := OpenStorage(testDb)
+	assert.Nil(t, err)
+	closed := make(chan error)
+	go func() {
+		closed <- CloseDatabaseByName(testDb)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	value, err := GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.ErrorIs(t, <-closed, ErrDbBusy)
+	assert.True(t, defaultStore.hasOpenHandle(testDb))
+
+	// as does a scan's callback
+	err = ScanPrefix(testDb, "", func(key string, value []byte) error {
+		return SetDatabaseActive(testDb, false)
+	})
+	assert.ErrorIs(t, err, ErrDbBusy)
+
+	// nor does Shutdown wait forever for a Reader left open
+	reader, err := NewReader(testDb)
+	assert.Nil(t, err)
+	assert.ErrorIs(t, Shutdown(), ErrDbBusy)
+	assert.Nil(t, reader.Close())
+	assert.Nil(t, storage.Close())
+	assert.Nil(t, CloseDatabaseByName(testDb))
+	assert.False(t, defaultStore.hasOpenHandle(testDb))
+}
+
+func TestConcurrentInsertEntry(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+
+	// the meta db and the key db are shared the same way the user's database is
+	n := 80
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- InsertEntry(testDb, "key"+strconv.Itoa(i), []byte("value"))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.Nil(t, err)
+	}
+	count, err := CountEntries(testDb, "")
+	assert.Nil(t, err)
+	assert.Equal(t, n, count)
+}
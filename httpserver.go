@@ -0,0 +1,196 @@
+package cachekv
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxHTTPValueSize bounds the body of a PUT to a database without a
+// MaxValueSize of its own.
+const maxHTTPValueSize = 32 << 20
+
+// NewHTTPServer returns a server for addr exposing the store over REST, for
+// services that can't link the package:
+//
+//	GET    /dbs                   the databases, as a JSON array of names
+//	POST   /db/{name}             create a database; ?secure=true|false,
+//	                              Config.SecureNewDb when left out
+//	PUT    /db/{name}/keys/{key}  store the request body under key
+//	GET    /db/{name}/keys/{key}  the value under key, as the response body
+//	DELETE /db/{name}/keys/{key}  remove key
+//
+// Keys may contain '/'. Missing databases and keys are 404s, creating a
+// database that exists or using an inactive one is a 409, and a value over
+// the database's MaxValueSize, or maxHTTPValueSize if it has none, is a 413.
+// The package's internal databases, those named with a leading '_', aren't
+// served. Errors are answered with a generic message; the details are logged.
+// The server has no authentication of its own; the caller starts it and
+// decides where it listens.
+func (s *Store) NewHTTPServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /dbs", s.httpListDatabases)
+	mux.HandleFunc("POST /db/{name}", s.httpCreateDatabase)
+	mux.HandleFunc("PUT /db/{name}/keys/{key...}", s.httpPutEntry)
+	mux.HandleFunc("GET /db/{name}/keys/{key...}", s.httpGetEntry)
+	mux.HandleFunc("DELETE /db/{name}/keys/{key...}", s.httpDeleteEntry)
+	return &http.Server{Addr: addr, Handler: mux}
+}
+
+// NewHTTPServer calls Store.NewHTTPServer on the default store.
+func NewHTTPServer(addr string) *http.Server {
+	return defaultStore.NewHTTPServer(addr)
+}
+
+func (s *Store) httpListDatabases(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.ListDatabasesContext(r.Context())
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if name := strings.TrimPrefix(key, prefixMetaDb); !isInternalDbName(name) {
+			names = append(names, name)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(names)
+}
+
+func (s *Store) httpCreateDatabase(w http.ResponseWriter, r *http.Request) {
+	dbName, ok := httpDbName(w, r)
+	if !ok {
+		return
+	}
+	exist, err := s.databaseExist(dbName)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if exist {
+		http.Error(w, "database already exists", http.StatusConflict)
+		return
+	}
+	if secure := r.URL.Query().Get("secure"); secure != "" {
+		var b bool
+		if b, err = strconv.ParseBool(secure); err != nil {
+			http.Error(w, "secure must be true or false", http.StatusBadRequest)
+			return
+		}
+		err = s.CreateDatabase(dbName, b)
+	} else {
+		err = s.CreateDatabaseDefault(dbName)
+	}
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Store) httpPutEntry(w http.ResponseWriter, r *http.Request) {
+	dbName, ok := httpDbName(w, r)
+	if !ok {
+		return
+	}
+	dbObject, err := s.getMetaDbObject(dbName)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	limit := int64(maxHTTPValueSize)
+	if dbObject.MaxValueSize > 0 {
+		limit = dbObject.MaxValueSize
+	}
+	value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "value too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "error reading request body", http.StatusBadRequest)
+		return
+	}
+	if err = s.InsertEntryContext(r.Context(), dbName, r.PathValue("key"), value); err != nil {
+		httpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Store) httpGetEntry(w http.ResponseWriter, r *http.Request) {
+	dbName, ok := httpDbName(w, r)
+	if !ok {
+		return
+	}
+	value, err := s.GetEntryContext(r.Context(), dbName, r.PathValue("key"))
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(value)
+}
+
+func (s *Store) httpDeleteEntry(w http.ResponseWriter, r *http.Request) {
+	dbName, ok := httpDbName(w, r)
+	if !ok {
+		return
+	}
+	if err := s.RemoveEntryContext(r.Context(), dbName, r.PathValue("key")); err != nil {
+		httpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// httpDbName returns the request's database name, or answers the request
+// itself if the name isn't one the server serves.
+func httpDbName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	dbName := r.PathValue("name")
+	if isInternalDbName(dbName) {
+		http.Error(w, "database not found", http.StatusNotFound)
+		return "", false
+	}
+	if err := ValidateDatabaseName(dbName); err != nil {
+		http.Error(w, "invalid database name", http.StatusBadRequest)
+		return "", false
+	}
+	return dbName, true
+}
+
+// isInternalDbName reports whether dbName is reserved for the package's own
+// databases, such as the locks and cache databases.
+func isInternalDbName(dbName string) bool {
+	return strings.HasPrefix(dbName, "_")
+}
+
+// httpError answers with the status that fits err and a message that doesn't
+// give its details away; errors the client can't fix are logged.
+func httpError(w http.ResponseWriter, err error) {
+	var metaErr *EMetaKeyNotFound
+	switch {
+	case errors.As(err, &metaErr):
+		http.Error(w, "database not found", http.StatusNotFound)
+	case isEntryNotFound(err):
+		http.Error(w, "key not found", http.StatusNotFound)
+	case errors.Is(err, ErrInvalidDatabaseName):
+		http.Error(w, "invalid database name", http.StatusBadRequest)
+	case errors.Is(err, ErrDbReadOnly):
+		http.Error(w, "database is read-only", http.StatusForbidden)
+	case errors.Is(err, ErrValueTooLarge):
+		http.Error(w, "value too large", http.StatusRequestEntityTooLarge)
+	case strings.Contains(err.Error(), errDbInactive):
+		http.Error(w, "database is inactive", http.StatusConflict)
+	case strings.Contains(err.Error(), errDbRotating):
+		http.Error(w, "database is under maintenance", http.StatusServiceUnavailable)
+	default:
+		logger().Errorf("http: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
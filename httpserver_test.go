@@ -0,0 +1,103 @@
+package cachekv
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPServer(t *testing.T) {
+	defer setup()()
+	server := httptest.NewServer(NewHTTPServer("").Handler)
+	defer server.Close()
+	do := func(method, path string, body []byte) (int, []byte) {
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(body))
+		assert.Nil(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return resp.StatusCode, data
+	}
+
+	status, _ := do("POST", "/db/testdb?secure=true", nil)
+	assert.Equal(t, http.StatusCreated, status)
+	status, _ = do("POST", "/db/testdb", nil)
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = do("POST", "/db/bad%20name", nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	_, acquired, err := TryAcquireLock("job", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+
+	status, body := do("GET", "/dbs", nil)
+	assert.Equal(t, http.StatusOK, status)
+	var names []string
+	assert.Nil(t, json.Unmarshal(body, &names))
+	assert.Equal(t, []string{"testdb"}, names)
+
+	value := []byte{0x00, 0xff, 'b', 'i', 'n'}
+	status, _ = do("PUT", "/db/testdb/keys/users/1", value)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, body = do("GET", "/db/testdb/keys/users/1", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, value, body)
+	stored, err := GetEntry("testdb", "users/1")
+	assert.Nil(t, err)
+	assert.Equal(t, value, stored)
+
+	status, _ = do("DELETE", "/db/testdb/keys/users/1", nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = do("GET", "/db/testdb/keys/users/1", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = do("GET", "/db/missing/keys/key", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = do("PUT", "/db/missing/keys/key", value)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// internal databases aren't served
+	status, _ = do("GET", "/db/"+locksDbName+"/keys/job", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = do("PUT", "/db/"+locksDbName+"/keys/job", value)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	assert.Nil(t, CreateDatabase("smalldb", false, WithMaxValueSize(4)))
+	status, _ = do("PUT", "/db/smalldb/keys/key", []byte("1234"))
+	assert.Equal(t, http.StatusNoContent, status)
+	status, body = do("PUT", "/db/smalldb/keys/key", []byte("12345"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	assert.Equal(t, "value too large", strings.TrimSpace(string(body)))
+
+	assert.Nil(t, SetDatabaseActive("smalldb", false))
+	status, body = do("GET", "/db/smalldb/keys/key", nil)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.NotContains(t, string(body), "smalldb")
+}
+
+func TestHTTPCreateExistingDatabase(t *testing.T) {
+	defer setup()()
+	server := httptest.NewServer(NewHTTPServer("").Handler)
+	defer server.Close()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, CloseDatabaseByName("testdb"))
+
+	// the existence check only reads meta, so a handle holding the directory
+	// is neither needed nor disturbed
+	storage, err := GetStorageObject("testdb")
+	assert.Nil(t, err)
+	defer func() { assert.Nil(t, storage.Close()) }()
+	resp, err := http.Post(server.URL+"/db/testdb", "", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Body.Close())
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Nil(t, storage.InsertEntry("key", []byte("value")))
+}
@@ -0,0 +1,192 @@
+package cachekv
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// IntegrityProblem is one inconsistency CheckIntegrity found between meta,
+// the filesystem and the keyring. DbName is empty for orphaned directories.
+type IntegrityProblem struct {
+	DbName  string `json:"db_name,omitempty"`
+	Problem string `json:"problem"`
+}
+
+// CheckIntegrity looks for registered databases whose directory is gone, or
+// whose key is missing from the keyring or can't be derived, and for badger
+// directories meta doesn't know about. It only reads meta and the keyring and
+// lists directories, without opening any database, so it is cheap enough to
+// run regularly, see Config.IntegrityCheckInterval.
+// Soft-deleted databases are skipped, and so are orphans during a key
+// rotation, which creates directories before meta knows about them. The
+// databases of a WithInMemory store have no directory to check.
+func (s *Store) CheckIntegrity() ([]IntegrityProblem, error) {
+	dbs, err := s.listDatabases()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.keyringDbKeys()
+	if err != nil {
+		return nil, err
+	}
+	problems := make([]IntegrityProblem, 0)
+	for key, dbObject := range dbs {
+		if dbObject.Deleted != 0 {
+			continue
+		}
+		dbName := strings.TrimPrefix(key, prefixMetaDb)
+		dir := path.Join(dbObject.DbPath, dbObject.DbFile)
+		if !s.inMemory && !isBadgerDir(dir) {
+			problems = append(problems, IntegrityProblem{DbName: dbName, Problem: "database directory is missing: " + dir})
+		}
+		switch {
+		case !dbObject.Secure:
+		case dbObject.KeyDerived:
+			if s.masterKey == nil {
+				problems = append(problems, IntegrityProblem{DbName: dbName, Problem: "key is derived from a master key, and none is set"})
+			}
+		default:
+			stored, ok := keys[dbName]
+			if !ok {
+				problems = append(problems, IntegrityProblem{DbName: dbName, Problem: "key is missing from the keyring"})
+			} else if _, err = decodeDbKey(dbName, stored); err != nil {
+				problems = append(problems, IntegrityProblem{DbName: dbName, Problem: err.Error()})
+			}
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool {
+		return problems[i].DbName < problems[j].DbName
+	})
+	if !s.rotationInProgress() {
+		orphans, err := s.ListOrphanedDirectories()
+		if err != nil {
+			return problems, err
+		}
+		for _, dir := range orphans {
+			problems = append(problems, IntegrityProblem{Problem: "orphaned database directory: " + dir})
+		}
+	}
+	return problems, nil
+}
+
+// CheckIntegrity calls Store.CheckIntegrity on the default store.
+func CheckIntegrity() ([]IntegrityProblem, error) {
+	return defaultStore.CheckIntegrity()
+}
+
+// keyringDbKeys reads every database key in the keyring in one pass.
+func (s *Store) keyringDbKeys() (map[string][]byte, error) {
+	db, err := s.openKeyring()
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseKeyring()
+	keys := make(map[string][]byte)
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(prefixMetaDb)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			value, e := it.Item().ValueCopy(nil)
+			if e != nil {
+				return e
+			}
+			keys[strings.TrimPrefix(string(it.Item().Key()), prefixMetaDb)] = value
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// integrityCheckState is the background integrity check of a Store.
+type integrityCheckState struct {
+	mu    sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+	alert func(problems []IntegrityProblem)
+}
+
+// SetIntegrityAlert has the background integrity check call fn with the
+// problems of every run that finds some, besides logging them and recording
+// them in the event log. nil removes it.
+func (s *Store) SetIntegrityAlert(fn func(problems []IntegrityProblem)) {
+	s.integrityChecks.mu.Lock()
+	defer s.integrityChecks.mu.Unlock()
+	s.integrityChecks.alert = fn
+}
+
+// SetIntegrityAlert calls Store.SetIntegrityAlert on the default store.
+func SetIntegrityAlert(fn func(problems []IntegrityProblem)) {
+	defaultStore.SetIntegrityAlert(fn)
+}
+
+// startIntegrityChecks replaces the background integrity check with one
+// running every interval, or none for zero.
+func (s *Store) startIntegrityChecks(interval time.Duration) {
+	s.stopIntegrityChecks()
+	if interval <= 0 {
+		return
+	}
+	s.integrityChecks.mu.Lock()
+	defer s.integrityChecks.mu.Unlock()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	s.integrityChecks.stop = stop
+	s.integrityChecks.done = done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.runIntegrityCheck()
+			}
+		}
+	}()
+}
+
+// stopIntegrityChecks stops the background integrity check and waits for a
+// run in progress to finish.
+func (s *Store) stopIntegrityChecks() {
+	s.integrityChecks.mu.Lock()
+	stop, done := s.integrityChecks.stop, s.integrityChecks.done
+	s.integrityChecks.stop, s.integrityChecks.done = nil, nil
+	s.integrityChecks.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (s *Store) runIntegrityCheck() {
+	problems, err := s.CheckIntegrity()
+	if err != nil {
+		logger().Errorf("integrity check: %v", err)
+		return
+	}
+	if len(problems) == 0 {
+		return
+	}
+	for _, problem := range problems {
+		if problem.DbName != "" {
+			logger().Errorf("integrity check: %s - %s", problem.DbName, problem.Problem)
+		} else {
+			logger().Errorf("integrity check: %s", problem.Problem)
+		}
+		_ = s.writeDbEvent(EventTypeIntegrityProblem, problem.DbName, problem.Problem)
+	}
+	s.integrityChecks.mu.Lock()
+	alert := s.integrityChecks.alert
+	s.integrityChecks.mu.Unlock()
+	if alert != nil {
+		alert(problems)
+	}
+}
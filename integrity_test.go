@@ -0,0 +1,84 @@
+package cachekv
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb1", true))
+	assert.Nil(t, CreateDatabase("testdb2", true))
+	assert.Nil(t, CreateDatabase("testdb3", false))
+	problems, err := CheckIntegrity()
+	assert.Nil(t, err)
+	assert.Empty(t, problems)
+
+	assert.Nil(t, defaultStore.removeFromKeyring(prefixMetaDb+"testdb1"))
+	dbObject, err := defaultStore.getMetaDbObject("testdb3")
+	assert.Nil(t, err)
+	dir := path.Join(dbObject.DbPath, dbObject.DbFile)
+	assert.Nil(t, os.Rename(dir, dir+"-moved"))
+	problems, err = CheckIntegrity()
+	assert.Nil(t, err)
+	assert.Equal(t, []IntegrityProblem{
+		{DbName: "testdb1", Problem: "key is missing from the keyring"},
+		{DbName: "testdb3", Problem: "database directory is missing: " + dir},
+		{Problem: "orphaned database directory: " + dir + "-moved"},
+	}, problems)
+}
+
+func TestIntegrityCheckInterval(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, defaultStore.removeFromKeyring(prefixMetaDb+"testdb"))
+	alerts := make(chan []IntegrityProblem, 1)
+	SetIntegrityAlert(func(problems []IntegrityProblem) {
+		select {
+		case alerts <- problems:
+		default:
+		}
+	})
+	defer SetIntegrityAlert(nil)
+
+	cfg, err := ListConfigurations()
+	assert.Nil(t, err)
+	cfg.IntegrityCheckInterval = 50 * time.Millisecond
+	assert.Nil(t, UpdateConfigurations(cfg))
+	select {
+	case problems := <-alerts:
+		assert.Equal(t, []IntegrityProblem{{DbName: "testdb", Problem: "key is missing from the keyring"}}, problems)
+	case <-time.After(10 * time.Second):
+		t.Fatal("no integrity alert")
+	}
+	defaultStore.stopIntegrityChecks()
+	events, err := ListEventsForDatabase("testdb")
+	assert.Nil(t, err)
+	found := false
+	for _, event := range events {
+		found = found || event.Type == EventTypeIntegrityProblem
+	}
+	assert.True(t, found)
+}
+
+func TestCheckIntegrityInMemory(t *testing.T) {
+	defer setup()()
+	dirs := []string{"./test-store-memory/", "./.test-private-memory/"}
+	defer func() {
+		for _, dir := range dirs {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+	store, err := NewStore(WithStorePath(dirs[0]), WithKeyPath(dirs[1]), WithInMemory())
+	assert.Nil(t, err)
+	defer store.Shutdown()
+	assert.Nil(t, store.CreateDatabase("testdb1", true))
+	assert.Nil(t, store.CreateDatabase("testdb2", false))
+	problems, err := store.CheckIntegrity()
+	assert.Nil(t, err)
+	assert.Empty(t, problems)
+}
@@ -0,0 +1,96 @@
+package cachekv
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// jsonEntry is one entry of ExportJSON's output. Values are arbitrary bytes,
+// which encoding/json writes as base64.
+type jsonEntry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// importJSONChunk is how many entries ImportJSON reads before writing them.
+var importJSONChunk = 10000
+
+// ExportJSON writes every entry of dbName to w as a JSON array of
+// {"key": ..., "value": <base64>} objects, in key order. Entries are written
+// as they are read, so the database is never held in memory. Keys are written
+// as JSON strings, so keys that aren't valid UTF-8 don't survive the trip.
+func (s *Store) ExportJSON(dbName string, w io.Writer) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	// one entry per line
+	separator := "\n"
+	err := s.ScanPrefix(dbName, "", func(key string, value []byte) error {
+		line, err := json.Marshal(jsonEntry{Key: key, Value: value})
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, separator); err != nil {
+			return err
+		}
+		separator = ",\n"
+		_, err = w.Write(line)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	end := "]\n"
+	if separator != "\n" {
+		end = "\n]\n"
+	}
+	_, err = io.WriteString(w, end)
+	return err
+}
+
+// ExportJSON calls Store.ExportJSON on the default store.
+func ExportJSON(dbName string, w io.Writer) error {
+	return defaultStore.ExportJSON(dbName, w)
+}
+
+// ImportJSON reads entries written by ExportJSON from r into dbName with
+// BatchInsert, a chunk at a time, so large exports don't have to fit in
+// memory. Keys already in dbName are overwritten. If r turns out to be
+// malformed part way, the chunks before it stay written.
+func (s *Store) ImportJSON(dbName string, r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.New("json import: expected an array of entries")
+	}
+	chunk := make(map[string][]byte, importJSONChunk)
+	for decoder.More() {
+		var entry jsonEntry
+		if err = decoder.Decode(&entry); err != nil {
+			return err
+		}
+		chunk[entry.Key] = entry.Value
+		if len(chunk) >= importJSONChunk {
+			if err = s.BatchInsert(dbName, chunk); err != nil {
+				return err
+			}
+			chunk = make(map[string][]byte, importJSONChunk)
+		}
+	}
+	if _, err = decoder.Token(); err != nil {
+		return err
+	}
+	if len(chunk) > 0 {
+		return s.BatchInsert(dbName, chunk)
+	}
+	return nil
+}
+
+// ImportJSON calls Store.ImportJSON on the default store.
+func ImportJSON(dbName string, r io.Reader) error {
+	return defaultStore.ImportJSON(dbName, r)
+}
@@ -0,0 +1,46 @@
+package cachekv
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImportJSON(t *testing.T) {
+	defer setup()()
+	defer func(chunk int) { importJSONChunk = chunk }(importJSONChunk)
+	importJSONChunk = 7
+	entries := make(map[string][]byte)
+	keys := make([]string, 0)
+	for i := range 30 {
+		key := "key" + strconv.Itoa(i)
+		entries[key] = []byte{0, byte(i), 0, 0xff, 'x'}
+		keys = append(keys, key)
+	}
+	assert.Nil(t, CreateDatabase("testdb1", true))
+	assert.Nil(t, BatchInsert("testdb1", entries))
+
+	var buffer bytes.Buffer
+	assert.Nil(t, ExportJSON("testdb1", &buffer))
+	var exported []jsonEntry
+	assert.Nil(t, json.Unmarshal(buffer.Bytes(), &exported))
+	assert.Len(t, exported, 30)
+
+	assert.Nil(t, CreateDatabase("testdb2", false))
+	assert.Nil(t, ImportJSON("testdb2", &buffer))
+	values, err := BatchGet("testdb2", keys)
+	assert.Nil(t, err)
+	assert.Equal(t, entries, values)
+
+	// an empty database round-trips too
+	assert.Nil(t, CreateDatabase("empty", false))
+	buffer.Reset()
+	assert.Nil(t, ExportJSON("empty", &buffer))
+	assert.Equal(t, "[]\n", buffer.String())
+	assert.Nil(t, ImportJSON("empty", &buffer))
+	assert.NotNil(t, ImportJSON("empty", strings.NewReader(`{"key":"a"}`)))
+}
@@ -0,0 +1,376 @@
+package cachekv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// sortableIntLength is the width of an encoded int64: 16 hex digits.
+const sortableIntLength = 16
+
+// EncodeSortableInt encodes n as fixed-width hex with the sign bit flipped, so
+// that badger's byte-wise key order matches numeric order, negatives included.
+// Use it for the numeric part of keys that need range queries, for example
+//
+//	key := "item:" + EncodeSortableInt(id)
+//
+// and read them back in order with ScanNumericRange(dbName, "item:", from, to).
+func EncodeSortableInt(n int64) string {
+	return fmt.Sprintf("%016x", uint64(n)^(1<<63))
+}
+
+// DecodeSortableInt reverses EncodeSortableInt.
+func DecodeSortableInt(s string) (int64, error) {
+	if len(s) != sortableIntLength {
+		return 0, errors.New("invalid sortable int: " + s)
+	}
+	u, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(u ^ (1 << 63)), nil
+}
+
+// MakeKey joins parts into one key with ':' between them, escaping ':' and
+// '\' inside the parts so that SplitKey gets the same parts back and no two
+// sets of parts make the same key. Every key for parts starting with some
+// parts p begins with MakeKey(p...) + ":", which makes that a prefix for
+// ScanPrefix. MakeKey() and MakeKey("") are both the empty key.
+func MakeKey(parts ...string) string {
+	var b strings.Builder
+	for i, part := range parts {
+		if i > 0 {
+			b.WriteByte(':')
+		}
+		for j := 0; j < len(part); j++ {
+			if part[j] == ':' || part[j] == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(part[j])
+		}
+	}
+	return b.String()
+}
+
+// SplitKey splits a key made by MakeKey back into its parts. A key that
+// wasn't made by MakeKey is split at its unescaped ':'s.
+func SplitKey(key string) []string {
+	parts := make([]string, 0, strings.Count(key, ":")+1)
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch {
+		case key[i] == '\\' && i+1 < len(key):
+			i++
+			b.WriteByte(key[i])
+		case key[i] == ':':
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(key[i])
+		}
+	}
+	return append(parts, b.String())
+}
+
+// ScanNumericRange returns the entries whose key is prefix followed by an
+// EncodeSortableInt value in the inclusive range [from, to], in numeric order.
+// Keys under prefix that aren't encoded that way are skipped.
+func (s *Store) ScanNumericRange(dbName, prefix string, from, to int64) ([]KV, error) {
+	if from > to {
+		return nil, errors.New("invalid range: from is after to")
+	}
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]KV, 0)
+	start := []byte(prefix + EncodeSortableInt(from))
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(start); it.ValidForPrefix([]byte(prefix)); it.Next() {
+			item := it.Item()
+			n, e := DecodeSortableInt(string(item.Key()[len(prefix):]))
+			if e != nil {
+				continue
+			}
+			if n > to {
+				break
+			}
+			value, e := itemValue(item)
+			if e != nil {
+				return e
+			}
+			result = append(result, KV{Key: item.KeyCopy(nil), Value: value})
+		}
+		return nil
+	})
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return nil, err
+	}
+	return result, closeErr
+}
+
+// ScanNumericRange calls Store.ScanNumericRange on the default store.
+func ScanNumericRange(dbName, prefix string, from, to int64) ([]KV, error) {
+	return defaultStore.ScanNumericRange(dbName, prefix, from, to)
+}
+
+// ScanPrefix calls fn with every entry whose key starts with prefix, in key
+// order; an empty prefix visits the whole database. The value passed to fn is
+// a copy fn may keep. It stops at the first error fn returns and returns it.
+// fn runs inside the read transaction, and while the scan counts as a running
+// operation on dbName: a CloseDatabaseByName, DeleteDatabase or key rotation
+// made meanwhile waits for it, up to DrainTimeout, and operations fn starts
+// on dbName wait with them, see OpenStorage.
+func (s *Store) ScanPrefix(dbName string, prefix string, fn func(key string, value []byte) error) error {
+	return s.ScanPrefixContext(context.Background(), dbName, prefix, fn)
+}
+
+// ScanPrefix calls Store.ScanPrefix on the default store.
+func ScanPrefix(dbName string, prefix string, fn func(key string, value []byte) error) error {
+	return defaultStore.ScanPrefix(dbName, prefix, fn)
+}
+
+// ScanPrefixContext is ScanPrefix stopping with ctx's error once ctx is
+// done, checked before each entry.
+func (s *Store) ScanPrefixContext(ctx context.Context, dbName string, prefix string, fn func(key string, value []byte) error) error {
+	defer s.observeOp(dbName, "ScanPrefix", time.Now())
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		return err
+	}
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(opts.Prefix); it.ValidForPrefix(opts.Prefix); it.Next() {
+			if e := ctx.Err(); e != nil {
+				return e
+			}
+			item := it.Item()
+			if isReservedKey(item.Key()) {
+				continue
+			}
+			value, e := itemValue(item)
+			if e != nil {
+				return e
+			}
+			if e = fn(string(item.Key()), value); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// ScanPrefixContext calls Store.ScanPrefixContext on the default store.
+func ScanPrefixContext(ctx context.Context, dbName string, prefix string, fn func(key string, value []byte) error) error {
+	return defaultStore.ScanPrefixContext(ctx, dbName, prefix, fn)
+}
+
+// deleteRangeChunk is how many keys DeleteRange collects before deleting them.
+var deleteRangeChunk = 10000
+
+// DeleteRange removes every key k with startKey <= k < endKey in byte order,
+// e.g. everything in a time-bucketed database before a cutoff key. An empty
+// endKey deletes through to the last key. Keys are collected and deleted in
+// chunks, so a large range never builds a huge transaction. deleted counts the
+// keys removed, also when an error stops it partway; their metadata goes with
+// them without being counted.
+func (s *Store) DeleteRange(dbName, startKey, endKey string) (deleted int, err error) {
+	defer s.observeOp(dbName, "DeleteRange", time.Now())
+	if endKey != "" && endKey <= startKey {
+		return 0, errors.New("invalid range: endKey must be after startKey")
+	}
+	db, _, err := s.openWritableDbByName(dbName)
+	if err != nil {
+		return 0, err
+	}
+	seek := []byte(startKey)
+	for {
+		keys := make([]string, 0, deleteRangeChunk)
+		var metaKeys []string
+		err = db.View(func(txn *badger.Txn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = false
+			it := txn.NewIterator(opts)
+			defer it.Close()
+			for it.Seek(seek); it.Valid() && len(keys) < deleteRangeChunk; it.Next() {
+				if isReservedKey(it.Item().Key()) {
+					continue
+				}
+				key := string(it.Item().Key())
+				if endKey != "" && key >= endKey {
+					break
+				}
+				keys = append(keys, key)
+				if _, e := txn.Get([]byte(prefixEntryMeta + key)); e == nil {
+					metaKeys = append(metaKeys, prefixEntryMeta+key)
+				} else if !errors.Is(e, badger.ErrKeyNotFound) {
+					return e
+				}
+			}
+			return nil
+		})
+		if err == nil && len(keys) > 0 {
+			err = deleteKeys(db, append(metaKeys, keys...))
+		}
+		if err != nil {
+			break
+		}
+		deleted += len(keys)
+		if len(keys) < deleteRangeChunk {
+			break
+		}
+		// continue right after the last key deleted
+		seek = append([]byte(keys[len(keys)-1]), 0)
+	}
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return deleted, err
+	}
+	_ = s.writeDbEvent(EventTypeDelete, dbName, "Deleted range: "+dbName+":["+startKey+", "+endKey+")")
+	return deleted, closeErr
+}
+
+// DeleteRange calls Store.DeleteRange on the default store.
+func DeleteRange(dbName, startKey, endKey string) (deleted int, err error) {
+	return defaultStore.DeleteRange(dbName, startKey, endKey)
+}
+
+// DropPrefix removes every key of dbName that starts with prefix, and its
+// metadata. badger drops them in bulk, holding back writes to dbName while it
+// does, which is much cheaper than deleting them one by one for a large share
+// of the keys.
+// An empty prefix is refused; DeleteDatabase removes everything.
+func (s *Store) DropPrefix(dbName string, prefix string) error {
+	defer s.observeOp(dbName, "DropPrefix", time.Now())
+	if prefix == "" {
+		return errors.New("prefix must not be empty")
+	}
+	db, _, err := s.openWritableDbByName(dbName)
+	if err != nil {
+		return err
+	}
+	err = db.DropPrefix([]byte(prefix), []byte(prefixEntryMeta+prefix))
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return err
+	}
+	_ = s.writeDbEvent(EventTypeDelete, dbName, "Dropped prefix: "+dbName+":"+prefix)
+	return closeErr
+}
+
+// DropPrefix calls Store.DropPrefix on the default store.
+func DropPrefix(dbName string, prefix string) error {
+	return defaultStore.DropPrefix(dbName, prefix)
+}
+
+// DropPrefixAll applies DropPrefix to every registered database, e.g. to
+// remove a tenant whose keys share a prefix across several databases. It
+// keeps going past failures and returns the error of each database that
+// failed, inactive ones included, under its name; the map is empty when all
+// of them succeeded. If the databases can't be listed at all, that error is
+// returned under the empty name.
+func (s *Store) DropPrefixAll(prefix string) map[string]error {
+	failed := make(map[string]error)
+	dbs, err := s.listDatabases()
+	if err != nil {
+		failed[""] = err
+		return failed
+	}
+	for key := range dbs {
+		dbName := strings.TrimPrefix(key, prefixMetaDb)
+		if err = s.DropPrefix(dbName, prefix); err != nil {
+			failed[dbName] = err
+		}
+	}
+	return failed
+}
+
+// DropPrefixAll calls Store.DropPrefixAll on the default store.
+func DropPrefixAll(prefix string) map[string]error {
+	return defaultStore.DropPrefixAll(prefix)
+}
+
+// CountEntries returns the number of keys of dbName starting with prefix, or
+// of all its keys if prefix is empty. Only keys are read, so counting a
+// database of large values costs no more than one of small ones. Expired
+// keys are not counted.
+func (s *Store) CountEntries(dbName string, prefix string) (int, error) {
+	defer s.observeOp(dbName, "CountEntries", time.Now())
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		return 0, err
+	}
+	count, err := countRecords(prefix, db, false)
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return 0, err
+	}
+	return count, closeErr
+}
+
+// CountEntries calls Store.CountEntries on the default store.
+func CountEntries(dbName string, prefix string) (int, error) {
+	return defaultStore.CountEntries(dbName, prefix)
+}
+
+// ListKeys returns up to limit keys of dbName in key order, starting after
+// startAfter; an empty startAfter starts at the first key. nextCursor is the
+// startAfter for the next page, and is empty once the last key was returned.
+// Only keys are read, so paging through a database doesn't load its values.
+func (s *Store) ListKeys(dbName string, startAfter string, limit int) (keys []string, nextCursor string, err error) {
+	defer s.observeOp(dbName, "ListKeys", time.Now())
+	if limit <= 0 {
+		return nil, "", errors.New("invalid limit: must be positive")
+	}
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		return nil, "", err
+	}
+	keys = make([]string, 0, limit)
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: false})
+		defer it.Close()
+		// no key sorts between startAfter and startAfter+"\x00"
+		start := []byte(startAfter)
+		if startAfter != "" {
+			start = append(start, 0)
+		}
+		for it.Seek(start); it.Valid() && len(keys) < limit; it.Next() {
+			if isReservedKey(it.Item().Key()) {
+				continue
+			}
+			keys = append(keys, string(it.Item().Key()))
+		}
+		if it.Valid() {
+			nextCursor = keys[len(keys)-1]
+		}
+		return nil
+	})
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return nil, "", err
+	}
+	return keys, nextCursor, closeErr
+}
+
+// ListKeys calls Store.ListKeys on the default store.
+func ListKeys(dbName string, startAfter string, limit int) (keys []string, nextCursor string, err error) {
+	return defaultStore.ListKeys(dbName, startAfter, limit)
+}
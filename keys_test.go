@@ -0,0 +1,239 @@
+package cachekv
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeSortableInt(t *testing.T) {
+	values := []int64{math.MinInt64, -100, -10, -2, -1, 0, 1, 2, 10, 100, math.MaxInt64}
+	encoded := make([]string, len(values))
+	for i, v := range values {
+		encoded[i] = EncodeSortableInt(v)
+		assert.Equal(t, sortableIntLength, len(encoded[i]))
+		decoded, err := DecodeSortableInt(encoded[i])
+		assert.Nil(t, err)
+		assert.Equal(t, v, decoded)
+	}
+	assert.True(t, sort.StringsAreSorted(encoded))
+	_, err := DecodeSortableInt("xyz")
+	assert.NotNil(t, err)
+}
+
+func TestScanNumericRange(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	entries := make(map[string][]byte)
+	for i := int64(-20); i <= 20; i++ {
+		entries["item:"+EncodeSortableInt(i)] = []byte(EncodeSortableInt(i))
+	}
+	entries["item:unrelated"] = []byte("skip me")
+	entries["other:"+EncodeSortableInt(5)] = []byte("skip me too")
+	assert.Nil(t, BatchInsert(testDb, entries))
+
+	kvs, err := ScanNumericRange(testDb, "item:", -3, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 14, len(kvs))
+	expected := int64(-3)
+	for _, kv := range kvs {
+		n, e := DecodeSortableInt(string(kv.Value))
+		assert.Nil(t, e)
+		assert.Equal(t, expected, n)
+		expected++
+	}
+	_, err = ScanNumericRange(testDb, "item:", 10, -3)
+	assert.NotNil(t, err)
+}
+
+func TestScanPrefix(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, BatchInsert(testDb, map[string][]byte{
+		"user:1":  []byte("ann"),
+		"user:2":  []byte("bob"),
+		"user:3":  []byte("cid"),
+		"users":   []byte("not under user:"),
+		"order:1": []byte("skip me"),
+		"session": []byte("skip me too"),
+	}))
+
+	seen := make(map[string][]byte)
+	visited := make([]string, 0)
+	err := ScanPrefix(testDb, "user:", func(key string, value []byte) error {
+		seen[key] = value
+		visited = append(visited, key)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1", "user:2", "user:3"}, visited)
+	assert.Equal(t, []byte("bob"), seen["user:2"])
+
+	// an error from fn stops the scan
+	stop := errors.New("stop")
+	count := 0
+	err = ScanPrefix(testDb, "user:", func(key string, value []byte) error {
+		count++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, count)
+}
+
+func TestDeleteRange(t *testing.T) {
+	defer setup()()
+	defer func(chunk int) { deleteRangeChunk = chunk }(deleteRangeChunk)
+	deleteRangeChunk = 7
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	entries := make(map[string][]byte)
+	for i := int64(0); i < 50; i++ {
+		entries["bucket:"+EncodeSortableInt(i)] = []byte("value")
+	}
+	entries["zzz"] = []byte("value")
+	assert.Nil(t, BatchInsert(testDb, entries))
+
+	deleted, err := DeleteRange(testDb, "bucket:"+EncodeSortableInt(10), "bucket:"+EncodeSortableInt(31))
+	assert.Nil(t, err)
+	assert.Equal(t, 21, deleted)
+	kvs, err := ScanNumericRange(testDb, "bucket:", 0, 49)
+	assert.Nil(t, err)
+	assert.Equal(t, 29, len(kvs))
+	_, err = GetEntry(testDb, "bucket:"+EncodeSortableInt(9))
+	assert.Nil(t, err)
+	_, err = GetEntry(testDb, "bucket:"+EncodeSortableInt(31))
+	assert.Nil(t, err)
+
+	// an empty end runs to the last key
+	deleted, err = DeleteRange(testDb, "bucket:"+EncodeSortableInt(40), "")
+	assert.Nil(t, err)
+	assert.Equal(t, 11, deleted)
+	_, err = GetEntry(testDb, "zzz")
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+
+	_, err = DeleteRange(testDb, "b", "a")
+	assert.NotNil(t, err)
+}
+
+func TestDropPrefixAll(t *testing.T) {
+	defer setup()()
+	for _, name := range []string{"shard1", "shard2", "shard3"} {
+		assert.Nil(t, CreateDatabase(name, true))
+		assert.Nil(t, BatchInsert(name, map[string][]byte{
+			"tenant:a:1": []byte("value"),
+			"tenant:a:2": []byte("value"),
+			"tenant:b:1": []byte("value"),
+		}))
+	}
+	assert.Nil(t, SetDatabaseActive("shard3", false))
+
+	failed := DropPrefixAll("tenant:a:")
+	assert.Len(t, failed, 1)
+	assert.ErrorContains(t, failed["shard3"], errDbInactive)
+	for _, name := range []string{"shard1", "shard2"} {
+		found, err := Exists(name, "tenant:a:1")
+		assert.Nil(t, err)
+		assert.False(t, found)
+		found, err = Exists(name, "tenant:b:1")
+		assert.Nil(t, err)
+		assert.True(t, found)
+	}
+	assert.NotNil(t, DropPrefix("shard1", ""))
+}
+
+func TestMakeKey(t *testing.T) {
+	assert.Equal(t, "tenant:user:field", MakeKey("tenant", "user", "field"))
+	assert.Equal(t, []string{"tenant", "user", "field"}, SplitKey("tenant:user:field"))
+	// parts holding the separator don't collide
+	assert.NotEqual(t, MakeKey("a:b", "c"), MakeKey("a", "b:c"))
+	for _, parts := range [][]string{
+		{"a:b", "c"},
+		{"a", "b:c"},
+		{`back\slash`, `trailing\`, ":"},
+		{"", "empty", ""},
+	} {
+		assert.Equal(t, parts, SplitKey(MakeKey(parts...)))
+	}
+	assert.Equal(t, "", MakeKey())
+	assert.Equal(t, []string{""}, SplitKey(""))
+}
+
+func TestCountEntries(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	entries := make(map[string][]byte)
+	for i := 0; i < 30; i++ {
+		entries[MakeKey("user", EncodeSortableInt(int64(i)))] = []byte("value")
+	}
+	for i := 0; i < 12; i++ {
+		entries[MakeKey("order", EncodeSortableInt(int64(i)))] = []byte("value")
+	}
+	assert.Nil(t, BatchInsert("testdb", entries))
+
+	count, err := CountEntries("testdb", "user:")
+	assert.Nil(t, err)
+	assert.Equal(t, 30, count)
+	count, err = CountEntries("testdb", "order:")
+	assert.Nil(t, err)
+	assert.Equal(t, 12, count)
+	count, err = CountEntries("testdb", "")
+	assert.Nil(t, err)
+	assert.Equal(t, 42, count)
+	count, err = CountEntries("testdb", "missing:")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	var metaErr *EMetaKeyNotFound
+	_, err = CountEntries("missing", "")
+	assert.True(t, errors.As(err, &metaErr))
+}
+
+func TestListKeys(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	const total = 10000
+	entries := make(map[string][]byte, total)
+	for i := 0; i < total; i++ {
+		entries["key:"+EncodeSortableInt(int64(i))] = []byte("value")
+	}
+	assert.Nil(t, BatchInsert("testdb", entries))
+
+	seen := make(map[string]int, total)
+	all := make([]string, 0, total)
+	cursor, pages := "", 0
+	for {
+		keys, next, err := ListKeys("testdb", cursor, 100)
+		assert.Nil(t, err)
+		assert.LessOrEqual(t, len(keys), 100)
+		for _, key := range keys {
+			seen[key]++
+		}
+		all = append(all, keys...)
+		pages++
+		if next == "" {
+			break
+		}
+		assert.Equal(t, keys[len(keys)-1], next)
+		cursor = next
+	}
+	assert.Equal(t, total/100, pages)
+	assert.Len(t, seen, total)
+	for key := range entries {
+		assert.Equal(t, 1, seen[key], key)
+	}
+	assert.True(t, sort.StringsAreSorted(all))
+
+	// a cursor that isn't a key still resumes after it
+	keys, next, err := ListKeys("testdb", "key:"+EncodeSortableInt(total-2)+"0", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"key:" + EncodeSortableInt(total-1)}, keys)
+	assert.Equal(t, "", next)
+	_, _, err = ListKeys("testdb", "", 0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,107 @@
+package cachekv
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// loader fills misses of one database, see SetLoader.
+type loader struct {
+	load func(key string) ([]byte, error)
+	ttl  time.Duration
+}
+
+// SetLoader makes dbName a read-through cache: when GetEntry misses, load is
+// called, its value stored and returned. Concurrent misses on the same key
+// share a single load call. A nil load removes the loader, after which misses
+// return not-found again.
+func (s *Store) SetLoader(dbName string, load func(key string) ([]byte, error)) {
+	s.SetLoaderWithTTL(dbName, load, 0)
+}
+
+// SetLoader calls Store.SetLoader on the default store.
+func SetLoader(dbName string, load func(key string) ([]byte, error)) {
+	defaultStore.SetLoader(dbName, load)
+}
+
+// SetLoaderWithTTL is SetLoader with loaded values stored with a ttl, so they
+// are fetched afresh once it runs out. A zero ttl stores them permanently.
+func (s *Store) SetLoaderWithTTL(dbName string, load func(key string) ([]byte, error), ttl time.Duration) {
+	s.loadersMu.Lock()
+	defer s.loadersMu.Unlock()
+	if load == nil {
+		delete(s.loaders, dbName)
+		return
+	}
+	s.loaders[dbName] = loader{load: load, ttl: ttl}
+}
+
+// SetLoaderWithTTL calls Store.SetLoaderWithTTL on the default store.
+func SetLoaderWithTTL(dbName string, load func(key string) ([]byte, error), ttl time.Duration) {
+	defaultStore.SetLoaderWithTTL(dbName, load, ttl)
+}
+
+func (s *Store) getLoader(dbName string) (loader, bool) {
+	s.loadersMu.RLock()
+	defer s.loadersMu.RUnlock()
+	l, ok := s.loaders[dbName]
+	return l, ok
+}
+
+// loadThrough runs the loader for a missed key and stores its result. Failing
+// to store is logged rather than returned: the caller still gets its value.
+func (s *Store) loadThrough(dbName string, key string, l loader) ([]byte, error) {
+	value, err := s.loads.do(dbName+"\x00"+key, func() ([]byte, error) {
+		value, err := l.load(key)
+		if err != nil {
+			return nil, err
+		}
+		if l.ttl > 0 {
+			err = s.InsertEntryWithTTL(dbName, key, value, l.ttl)
+		} else {
+			err = s.InsertEntry(dbName, key, value)
+		}
+		if err != nil {
+			logger().Errorf("error storing loaded value: %v", err)
+		}
+		return value, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// every waiter gets its own copy
+	return bytes.Clone(value), nil
+}
+
+// flightGroup collapses concurrent calls for the same key into one.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg    sync.WaitGroup
+	value []byte
+	err   error
+}
+
+func (g *flightGroup) do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.value, call.err = fn()
+	call.wg.Done()
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return call.value, call.err
+}
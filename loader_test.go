@@ -0,0 +1,86 @@
+package cachekv
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetLoader(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	defer SetLoader(testDb, nil)
+	assert.Nil(t, CreateDatabase(testDb, true))
+	_, err := GetEntry(testDb, "key")
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+
+	calls := 0
+	SetLoader(testDb, func(key string) ([]byte, error) {
+		calls++
+		if key == "broken" {
+			return nil, errors.New("backing store down")
+		}
+		return []byte("loaded:" + key), nil
+	})
+	value, err := GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("loaded:key"), value)
+	// the second read is served from the store
+	value, err = GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("loaded:key"), value)
+	assert.Equal(t, 1, calls)
+	_, err = GetEntry(testDb, "broken")
+	assert.EqualError(t, err, "backing store down")
+
+	SetLoader(testDb, nil)
+	_, err = GetEntry(testDb, "other")
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+}
+
+func TestSetLoaderWithTTL(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	defer SetLoader(testDb, nil)
+	assert.Nil(t, CreateDatabase(testDb, true))
+	calls := 0
+	SetLoaderWithTTL(testDb, func(key string) ([]byte, error) {
+		calls++
+		return []byte("loaded"), nil
+	}, time.Second)
+	_, err := GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	time.Sleep(2 * time.Second)
+	_, err = GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestFlightGroupSharesCalls(t *testing.T) {
+	group := &flightGroup{calls: make(map[string]*flightCall)}
+	var calls atomic.Int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := group.do("key", func() ([]byte, error) {
+				calls.Add(1)
+				<-release
+				return []byte("value"), nil
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("value"), value)
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+}
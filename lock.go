@@ -0,0 +1,130 @@
+package cachekv
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	locksDbName = "_locks"
+	prefixLock  = "lock:"
+	tokenLength = 32
+)
+
+// ensureDatabase creates dbName unless it is already registered. It backs the
+// package's own databases, such as the locks database.
+func (s *Store) ensureDatabase(dbName string, secure bool) error {
+	s.ensureMu.Lock()
+	defer s.ensureMu.Unlock()
+	exist, err := s.databaseExist(dbName)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return nil
+	}
+	// internal names are reserved, so skip the public name check
+	return s.createDatabase(dbName, secure, s.defaultOpener)
+}
+
+// TryAcquireLock takes the named lock for ttl if nobody else holds it. The
+// returned token must be handed to ReleaseLock; until then, or until ttl runs
+// out, every other caller sees acquired == false. The check and the write
+// happen in one transaction, retried if a concurrent one wrote the lock
+// first, and expiry relies on badger's TTL, which has a resolution of one
+// second. Locks only coordinate callers within one process: badger keeps an
+// exclusive lock on every database directory, so no two processes can have
+// the same store open, and instances in separate processes need separate
+// stores and some other lock.
+func (s *Store) TryAcquireLock(name string, ttl time.Duration) (token string, acquired bool, err error) {
+	if ttl <= 0 {
+		return "", false, errors.New("lock ttl must be positive")
+	}
+	err = s.ensureDatabase(locksDbName, true)
+	if err != nil {
+		return "", false, err
+	}
+	db, _, err := s.openDbByName(locksDbName)
+	if err != nil {
+		return "", false, err
+	}
+	newToken, err := randomValues(tokenLength)
+	if err != nil {
+		_ = s.releaseDb(locksDbName, db)
+		return "", false, err
+	}
+	acquired, err = acquireLockEntry(db, name, newToken, ttl)
+	closeErr := s.releaseDb(locksDbName, db)
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil || !acquired {
+		return "", false, err
+	}
+	return string(newToken), true, nil
+}
+
+// acquireLockEntry writes token as the named lock unless the lock is held.
+func acquireLockEntry(db *badger.DB, name string, token []byte, ttl time.Duration) (acquired bool, err error) {
+	err = updateRetrying(db, func(txn *badger.Txn) error {
+		acquired = false
+		_, e := txn.Get([]byte(prefixLock + name))
+		if e == nil {
+			return nil
+		}
+		if !errors.Is(e, badger.ErrKeyNotFound) {
+			return e
+		}
+		acquired = true
+		return txn.SetEntry(badger.NewEntry([]byte(prefixLock+name), token).WithTTL(ttl))
+	})
+	return acquired, err
+}
+
+// TryAcquireLock calls Store.TryAcquireLock on the default store.
+func TryAcquireLock(name string, ttl time.Duration) (token string, acquired bool, err error) {
+	return defaultStore.TryAcquireLock(name, ttl)
+}
+
+// ReleaseLock frees the named lock if token still owns it, and returns
+// ErrLockNotHeld if the lock has expired or belongs to someone else.
+func (s *Store) ReleaseLock(name, token string) error {
+	db, _, err := s.openDbByName(locksDbName)
+	var metaErr *EMetaKeyNotFound
+	if errors.As(err, &metaErr) {
+		// no lock was ever taken
+		return ErrLockNotHeld
+	}
+	if err != nil {
+		return err
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		item, e := txn.Get([]byte(prefixLock + name))
+		if errors.Is(e, badger.ErrKeyNotFound) {
+			return ErrLockNotHeld
+		}
+		if e != nil {
+			return e
+		}
+		current, e := item.ValueCopy(nil)
+		if e != nil {
+			return e
+		}
+		if string(current) != token {
+			return ErrLockNotHeld
+		}
+		return txn.Delete([]byte(prefixLock + name))
+	})
+	closeErr := s.releaseDb(locksDbName, db)
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// ReleaseLock calls Store.ReleaseLock on the default store.
+func ReleaseLock(name, token string) error {
+	return defaultStore.ReleaseLock(name, token)
+}
@@ -0,0 +1,80 @@
+package cachekv
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTryAcquireAndReleaseLock(t *testing.T) {
+	defer setup()()
+	token, acquired, err := TryAcquireLock("job", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	assert.NotEmpty(t, token)
+	// held by someone else now
+	other, acquired, err := TryAcquireLock("job", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, acquired)
+	assert.Empty(t, other)
+	// a different lock name is independent
+	_, acquired, err = TryAcquireLock("other-job", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	assert.ErrorIs(t, ReleaseLock("job", "not-the-token"), ErrLockNotHeld)
+	assert.Nil(t, ReleaseLock("job", token))
+	assert.ErrorIs(t, ReleaseLock("job", token), ErrLockNotHeld)
+	_, acquired, err = TryAcquireLock("job", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+}
+
+func TestLockExpires(t *testing.T) {
+	defer setup()()
+	token, acquired, err := TryAcquireLock("job", time.Second)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	time.Sleep(2 * time.Second)
+	_, acquired, err = TryAcquireLock("job", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	assert.ErrorIs(t, ReleaseLock("job", token), ErrLockNotHeld)
+	_, _, err = TryAcquireLock("job", 0)
+	assert.NotNil(t, err)
+}
+
+func TestConcurrentAcquireLock(t *testing.T) {
+	defer setup()()
+	// before any lock was taken there is no locks database yet
+	assert.ErrorIs(t, ReleaseLock("job", "token"), ErrLockNotHeld)
+
+	// callers that read the lock as free before another took it commit into
+	// a conflict, and have to come back with acquired == false; the first of
+	// them also race to create the locks database
+	const callers = 16
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	start := make(chan struct{})
+	tokens := make([]string, 0, 1)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			token, acquired, err := TryAcquireLock("job", time.Minute)
+			assert.Nil(t, err)
+			if acquired {
+				mu.Lock()
+				tokens = append(tokens, token)
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	assert.Len(t, tokens, 1)
+	assert.Nil(t, ReleaseLock("job", tokens[0]))
+	assert.ErrorIs(t, ReleaseLock("job", tokens[0]), ErrLockNotHeld)
+}
@@ -0,0 +1,60 @@
+package cachekv
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// Logger receives the package's log messages: Errorf for failures the
+// package worked around or gave up on, such as a database that wouldn't
+// close, Infof for things worth knowing, such as slow operations, and Debugf
+// for detail only useful when tracking down a problem.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// StdLogger is the default Logger. It writes info and error messages to the
+// standard library's log package, and drops debug messages.
+type StdLogger struct{}
+
+func (StdLogger) Debugf(format string, args ...any) {}
+
+func (StdLogger) Infof(format string, args ...any) {
+	log.Printf(format, args...)
+}
+
+func (StdLogger) Errorf(format string, args ...any) {
+	log.Printf(format, args...)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...any) {}
+func (nopLogger) Infof(format string, args ...any)  {}
+func (nopLogger) Errorf(format string, args ...any) {}
+
+// loggerBox lets a Logger of any type be kept in an atomic.Value.
+type loggerBox struct {
+	Logger
+}
+
+var currentLogger atomic.Value
+
+// SetLogger sends the log messages of every store to l, instead of the
+// standard library's log package; nil discards them.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	currentLogger.Store(loggerBox{l})
+}
+
+// logger returns the Logger set with SetLogger, or StdLogger.
+func logger() Logger {
+	if box, ok := currentLogger.Load().(loggerBox); ok {
+		return box.Logger
+	}
+	return StdLogger{}
+}
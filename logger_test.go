@@ -0,0 +1,63 @@
+package cachekv
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type capturingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *capturingLogger) add(level string, format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, level+": "+fmt.Sprintf(format, args...))
+}
+
+func (l *capturingLogger) Debugf(format string, args ...any) { l.add("debug", format, args...) }
+func (l *capturingLogger) Infof(format string, args ...any)  { l.add("info", format, args...) }
+func (l *capturingLogger) Errorf(format string, args ...any) { l.add("error", format, args...) }
+
+func TestSetLogger(t *testing.T) {
+	defer setup()()
+	logs := &capturingLogger{}
+	SetLogger(logs)
+	defer SetLogger(StdLogger{})
+
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, InsertEntry("testdb", "key1", []byte("value1")))
+	assert.Nil(t, InsertEntry("testdb", "key2", []byte("value2")))
+	storage, err := OpenStorage("testdb")
+	assert.Nil(t, err)
+	count, err := countRecords("", storage.db, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Nil(t, storage.Close())
+
+	assert.Nil(t, defaultStore.removeFromKeyring(prefixMetaDb+"testdb"))
+	defaultStore.runIntegrityCheck()
+
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+	assert.Subset(t, logs.messages, []string{
+		"debug: key: key1",
+		"debug: key: key2",
+		"error: integrity check: testdb - key is missing from the keyring",
+	})
+}
+
+func TestStartupBadStorePath(t *testing.T) {
+	defer setup()()
+	notADir := "./test-not-a-dir"
+	assert.Nil(t, os.WriteFile(notADir, []byte("file"), 0644))
+	defer os.Remove(notADir)
+	store, err := NewStore(WithStorePath(notADir+"/store/"), WithKeyPath(notADir+"/private/"))
+	assert.NotNil(t, err)
+	assert.Nil(t, store)
+}
@@ -0,0 +1,209 @@
+package cachekv
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const gcDiscardRatio = 0.5
+
+// CompactMeta flattens the meta db's LSM tree and runs value-log GC until
+// there's nothing left to reclaim. The meta db is read by nearly every
+// operation, so keeping it small keeps those reads fast.
+func (s *Store) CompactMeta() error {
+	db, err := s.openMeta()
+	if err != nil {
+		return err
+	}
+	defer s.releaseMeta()
+	err = db.Flatten(1)
+	if err != nil {
+		return err
+	}
+	return runValueLogGC(db)
+}
+
+// CompactMeta calls Store.CompactMeta on the default store.
+func CompactMeta() error {
+	return defaultStore.CompactMeta()
+}
+
+// DropMetaEvents removes the whole event log from the meta db. Run
+// CompactMeta afterwards to reclaim the space.
+func (s *Store) DropMetaEvents() error {
+	db, err := s.openMeta()
+	if err != nil {
+		return err
+	}
+	defer s.releaseMeta()
+	return db.DropPrefix([]byte(prefixMetaEvent))
+}
+
+// DropMetaEvents calls Store.DropMetaEvents on the default store.
+func DropMetaEvents() error {
+	return defaultStore.DropMetaEvents()
+}
+
+// Warmup reads every entry of dbName under prefix, values included, so the
+// first real queries find its blocks already in badger's cache and the
+// value-log pages in the operating system's. badger's cache lives as long as
+// the database's shared handle, so it goes cold again after
+// CloseDatabaseByName or Shutdown. An empty prefix warms the whole database.
+func (s *Store) Warmup(dbName string, prefix string) error {
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		return err
+	}
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			// reading the value is what pulls it in, so it's done even
+			// though nothing is kept
+			if err := it.Item().Value(func([]byte) error { return nil }); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	closeErr := s.releaseDb(dbName, db)
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Warmup calls Store.Warmup on the default store.
+func Warmup(dbName string, prefix string) error {
+	return defaultStore.Warmup(dbName, prefix)
+}
+
+// runValueLogGC rewrites value-log files until badger reports nothing more
+// to collect.
+func runValueLogGC(db *badger.DB) error {
+	for {
+		err := db.RunValueLogGC(gcDiscardRatio)
+		if errors.Is(err, badger.ErrNoRewrite) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// MetaStatus reports which meta db is in use, whether the keyring holds its
+// key and how many databases it has registered, for diagnosing a store whose
+// meta db can't be read or was picked up from the wrong directory.
+func (s *Store) MetaStatus() (file string, keyPresent bool, recordCount int, err error) {
+	file = s.meta.file
+	key, err := s.getFromKeyring(prefixMetaKey)
+	switch {
+	case err == nil:
+		keyPresent = len(key) > 0
+	case errors.Is(err, badger.ErrKeyNotFound):
+	default:
+		return file, false, 0, err
+	}
+	db, err := s.openMeta()
+	if err != nil {
+		return file, keyPresent, 0, err
+	}
+	recordCount, err = countRecords(prefixMetaDb, db, false)
+	s.releaseMeta()
+	if err != nil {
+		return file, keyPresent, 0, err
+	}
+	return file, keyPresent, recordCount, nil
+}
+
+// MetaStatus calls Store.MetaStatus on the default store.
+func MetaStatus() (file string, keyPresent bool, recordCount int, err error) {
+	return defaultStore.MetaStatus()
+}
+
+// StorageUsage returns the on-disk size of dbName's LSM tree and of its value
+// log, as badger estimates them; the estimate is refreshed when the database
+// is opened and about once a minute after. A value log well beyond what the
+// live data accounts for is space updates and deletes left behind for GC to
+// reclaim.
+func (s *Store) StorageUsage(dbName string) (lsm, vlog int64, err error) {
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		return 0, 0, err
+	}
+	lsm, vlog = db.Size()
+	return lsm, vlog, s.releaseDb(dbName, db)
+}
+
+// StorageUsage calls Store.StorageUsage on the default store.
+func StorageUsage(dbName string) (lsm, vlog int64, err error) {
+	return defaultStore.StorageUsage(dbName)
+}
+
+// TotalUsage adds up StorageUsage over every registered database. Databases
+// that are inactive or soft-deleted can't be opened, so their files are
+// measured instead.
+func (s *Store) TotalUsage() (lsm, vlog int64, err error) {
+	dbs, err := s.listDatabases()
+	if err != nil {
+		return 0, 0, err
+	}
+	for key, dbObject := range dbs {
+		var dbLsm, dbVlog int64
+		if dbObject.Active {
+			dbLsm, dbVlog, err = s.StorageUsage(strings.TrimPrefix(key, prefixMetaDb))
+		} else {
+			dbLsm, dbVlog, err = dirUsage(path.Join(dbObject.DbPath, dbObject.DbFile))
+		}
+		if err != nil {
+			return lsm, vlog, err
+		}
+		lsm += dbLsm
+		vlog += dbVlog
+	}
+	return lsm, vlog, nil
+}
+
+// TotalUsage calls Store.TotalUsage on the default store.
+func TotalUsage() (lsm, vlog int64, err error) {
+	return defaultStore.TotalUsage()
+}
+
+// measureDb sizes dbName without opening it: through its shared handle if
+// one is open, on disk otherwise.
+func (s *Store) measureDb(dbName string, dbObject *DbObject) (lsm, vlog int64, err error) {
+	if s.hasOpenHandle(dbName) {
+		return s.StorageUsage(dbName)
+	}
+	return dirUsage(path.Join(dbObject.DbPath, dbObject.DbFile))
+}
+
+// dirUsage sizes a badger directory the way badger does: table files count
+// towards the LSM tree, value-log files towards the value log.
+func dirUsage(dir string) (lsm, vlog int64, err error) {
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch filepath.Ext(p) {
+		case ".sst":
+			lsm += info.Size()
+		case ".vlog":
+			vlog += info.Size()
+		}
+		return nil
+	})
+	return lsm, vlog, err
+}
@@ -0,0 +1,103 @@
+package cachekv
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompactMeta(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, CompactMeta())
+	// compaction keeps everything live
+	dbObject, err := defaultStore.getMetaDbObject("testdb")
+	assert.Nil(t, err)
+	assert.NotNil(t, dbObject)
+	var buffer bytes.Buffer
+	assert.Nil(t, ExportEvents(0, math.MaxInt64, &buffer))
+	assert.Greater(t, buffer.Len(), 0)
+
+	assert.Nil(t, DropMetaEvents())
+	assert.Nil(t, CompactMeta())
+	buffer.Reset()
+	assert.Nil(t, ExportEvents(0, math.MaxInt64, &buffer))
+	assert.Equal(t, 0, buffer.Len())
+	cfg, err := ListConfigurations()
+	assert.Nil(t, err)
+	assert.NotNil(t, cfg)
+}
+
+func TestMetaStatus(t *testing.T) {
+	defer setup()()
+	file, keyPresent, count, err := MetaStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, defaultStore.meta.file, file)
+	assert.True(t, strings.HasPrefix(file, "meta-"))
+	assert.True(t, keyPresent)
+	assert.Equal(t, 0, count)
+
+	assert.Nil(t, CreateDatabase("testdb1", true))
+	assert.Nil(t, CreateDatabase("testdb2", false))
+	_, _, count, err = MetaStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestWarmup(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, BatchInsert(testDb, map[string][]byte{
+		"user:1": bytes.Repeat([]byte("a"), 2048),
+		"user:2": []byte("b"),
+		"other":  []byte("c"),
+	}))
+	assert.Nil(t, Warmup(testDb, "user:"))
+	assert.Nil(t, Warmup(testDb, ""))
+	assert.NotNil(t, Warmup("missing", ""))
+	// the database is released afterwards
+	assert.Nil(t, CloseDatabaseByName(testDb))
+	value, err := GetEntry(testDb, "other")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), value)
+}
+
+func TestStorageUsage(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb1", true))
+	assert.Nil(t, CreateDatabase("testdb2", false))
+	assert.Nil(t, InsertEntry("testdb1", "small", []byte("value")))
+	// large enough for badger to keep it in the value log
+	assert.Nil(t, InsertEntry("testdb1", "large", bytes.Repeat([]byte("a"), 2<<20)))
+	assert.Nil(t, InsertEntry("testdb2", "small", []byte("value")))
+	// the estimate is taken as the databases open, after their writes are
+	// flushed to disk
+	assert.Nil(t, CloseDatabaseByName("testdb1"))
+	assert.Nil(t, CloseDatabaseByName("testdb2"))
+
+	lsm1, vlog1, err := StorageUsage("testdb1")
+	assert.Nil(t, err)
+	assert.Greater(t, lsm1, int64(0))
+	assert.Greater(t, vlog1, int64(2<<20))
+	lsm2, vlog2, err := StorageUsage("testdb2")
+	assert.Nil(t, err)
+	assert.Greater(t, lsm2, int64(0))
+
+	lsm, vlog, err := TotalUsage()
+	assert.Nil(t, err)
+	assert.Equal(t, lsm1+lsm2, lsm)
+	assert.Equal(t, vlog1+vlog2, vlog)
+
+	// an inactive database is measured from its files
+	assert.Nil(t, SetDatabaseActive("testdb2", false))
+	lsm, vlog, err = TotalUsage()
+	assert.Nil(t, err)
+	assert.Equal(t, lsm1+lsm2, lsm)
+	assert.Equal(t, vlog1+vlog2, vlog)
+	_, _, err = StorageUsage("missing")
+	assert.NotNil(t, err)
+}
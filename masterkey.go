@@ -0,0 +1,46 @@
+package cachekv
+
+import (
+	"bytes"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// DeriveDbKey derives dbName's 32-byte encryption key from master with
+// HKDF-SHA256, the database name as the context, so every database gets a
+// distinct key and none of them needs to be stored.
+func DeriveDbKey(master []byte, dbName string) []byte {
+	// HKDF-SHA256 only fails for keys longer than 255 hashes
+	key, _ := hkdf.Key(sha256.New, master, nil, "cachekv db key: "+dbName, keyLength)
+	return key
+}
+
+// SetMasterKey makes CreateDatabase derive the keys of new secure databases
+// from master with DeriveDbKey rather than generating and storing a random
+// one per database. The master key itself is never stored: set it before
+// using the store, with the same key, every time the process starts, or the
+// databases created under it can't be opened. nil goes back to random keys
+// for new databases. Key rotation leaves databases created under a master
+// key alone, since their keys aren't theirs to replace.
+func (s *Store) SetMasterKey(master []byte) error {
+	if master != nil && len(master) < 16 {
+		return errors.New("master key must be at least 16 bytes")
+	}
+	s.masterKey = bytes.Clone(master)
+	return nil
+}
+
+// SetMasterKey calls Store.SetMasterKey on the default store.
+func SetMasterKey(master []byte) error {
+	return defaultStore.SetMasterKey(master)
+}
+
+// masterDbKey derives dbName's key from the master key set with SetMasterKey.
+func (s *Store) masterDbKey(dbName string) ([]byte, error) {
+	if s.masterKey == nil {
+		return nil, fmt.Errorf("%s - %w: its key is derived from a master key, and none is set", dbName, ErrMissingDbKey)
+	}
+	return DeriveDbKey(s.masterKey, dbName), nil
+}
@@ -0,0 +1,57 @@
+package cachekv
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeriveDbKey(t *testing.T) {
+	master := bytes.Repeat([]byte("m"), 32)
+	key := DeriveDbKey(master, "testdb")
+	assert.Len(t, key, keyLength)
+	assert.Equal(t, key, DeriveDbKey(master, "testdb"))
+	assert.NotEqual(t, key, DeriveDbKey(master, "testdb2"))
+	assert.NotEqual(t, key, DeriveDbKey(bytes.Repeat([]byte("n"), 32), "testdb"))
+	assert.NotNil(t, SetMasterKey([]byte("short")))
+}
+
+func TestMasterKeyDatabase(t *testing.T) {
+	defer setup()()
+	defer func() { defaultStore.masterKey = nil }()
+	master := bytes.Repeat([]byte("m"), 32)
+	assert.Nil(t, SetMasterKey(master))
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	dbObject, err := defaultStore.getMetaDbObject(testDb)
+	assert.Nil(t, err)
+	assert.True(t, dbObject.KeyDerived)
+	_, err = defaultStore.getFromKeyring(prefixMetaDb + testDb)
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+
+	// the key isn't stored anywhere, so the master key is needed to open it
+	assert.Nil(t, CloseDatabaseByName(testDb))
+	assert.Nil(t, SetMasterKey(nil))
+	_, err = GetEntry(testDb, "key")
+	assert.ErrorIs(t, err, ErrMissingDbKey)
+	assert.Nil(t, SetMasterKey(master))
+	value, err := GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	storage, err := GetStorageObject(testDb)
+	assert.Nil(t, err)
+	value, err = storage.GetEntry("key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.Nil(t, storage.Close())
+	assert.NotNil(t, RotateDatabaseKey(testDb))
+
+	// a wrong master key doesn't open it
+	assert.Nil(t, CloseDatabaseByName(testDb))
+	assert.Nil(t, SetMasterKey(bytes.Repeat([]byte("n"), 32)))
+	_, err = GetEntry(testDb, "key")
+	assert.NotNil(t, err)
+}
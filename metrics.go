@@ -0,0 +1,179 @@
+package cachekv
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// otherDbLabel is the db label of operations on names the store never served,
+// which would otherwise let callers grow the label set without bound.
+const otherDbLabel = "_other"
+
+// A store's Prometheus collectors, made and registered with RegisterMetrics.
+// Operations report to them through observeOp; this file is the only one
+// that knows about Prometheus.
+type storeMetrics struct {
+	inserts *prometheus.CounterVec
+	gets    *prometheus.CounterVec
+	deletes *prometheus.CounterVec
+	errors  *prometheus.CounterVec
+	latency *prometheus.HistogramVec
+	sizes   sizeCollector
+
+	// known holds the databases operations succeeded on, the only names
+	// used as labels.
+	known sync.Map
+}
+
+var metricSizeDesc = prometheus.NewDesc("cachekv_database_size_bytes",
+	"On-disk size of each database, by the part of badger it is in: lsm or vlog.",
+	[]string{"db", "part"}, nil)
+
+func (s *Store) newStoreMetrics() *storeMetrics {
+	return &storeMetrics{
+		inserts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cachekv",
+			Name:      "inserts_total",
+			Help:      "Insert and update operations, by database.",
+		}, []string{"db"}),
+		gets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cachekv",
+			Name:      "gets_total",
+			Help:      "Read operations, by database.",
+		}, []string{"db"}),
+		deletes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cachekv",
+			Name:      "deletes_total",
+			Help:      "Delete operations, by database.",
+		}, []string{"db"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cachekv",
+			Name:      "errors_total",
+			Help:      "Operations that failed, by database and operation. Reads of missing keys don't count.",
+		}, []string{"db", "op"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "cachekv",
+			Name:      "operation_duration_seconds",
+			Help:      "How long operations took, by operation.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{"op"}),
+		sizes: sizeCollector{store: s},
+	}
+}
+
+// opCounter is which counter an operation goes to; operations not listed
+// only show in the latency histogram.
+func (m *storeMetrics) opCounter(op string) *prometheus.CounterVec {
+	switch op {
+	case "InsertEntry", "InsertEntryWithTTL", "InsertEntryWithMeta", "UpdateEntry", "BatchInsert", "BatchInsertDetailed":
+		return m.inserts
+	case "GetEntry", "GetEntryWithMeta", "ViewEntry":
+		return m.gets
+	case "RemoveEntry", "BatchDelete", "DeleteIfEquals", "DeleteRange", "DropPrefix":
+		return m.deletes
+	}
+	return nil
+}
+
+// RegisterMetrics registers the store's operation counters, latencies and
+// database sizes with reg, e.g. prometheus.DefaultRegisterer, and starts
+// counting. Nothing is collected until it is called. Sizes are read when reg
+// is scraped, from the meta db and the database directories. Calling it again
+// moves the store to new collectors; a registry refuses a second set, so
+// register each store of a process with a registry of its own.
+func (s *Store) RegisterMetrics(reg prometheus.Registerer) error {
+	m := s.newStoreMetrics()
+	collectors := []prometheus.Collector{m.inserts, m.gets, m.deletes, m.errors, m.latency, m.sizes}
+	for i, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			for _, registered := range collectors[:i] {
+				reg.Unregister(registered)
+			}
+			return err
+		}
+	}
+	s.metrics.Store(m)
+	return nil
+}
+
+// RegisterMetrics calls Store.RegisterMetrics on the default store.
+func RegisterMetrics(reg prometheus.Registerer) error {
+	return defaultStore.RegisterMetrics(reg)
+}
+
+// MetricsHandler serves the metrics of the default Prometheus registry, for
+// mounting on the caller's HTTP server; register cachekv's with
+// RegisterMetrics(prometheus.DefaultRegisterer) first.
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// recordOpMetrics counts one finished operation, if metrics are registered.
+func (s *Store) recordOpMetrics(dbName string, op string, elapsed time.Duration, err error) {
+	m := s.metrics.Load()
+	if m == nil {
+		return
+	}
+	m.latency.WithLabelValues(op).Observe(elapsed.Seconds())
+	label := m.dbLabel(dbName, err)
+	if counter := m.opCounter(op); counter != nil {
+		counter.WithLabelValues(label).Inc()
+	}
+	if err != nil && !isEntryNotFound(err) {
+		m.errors.WithLabelValues(label, op).Inc()
+	}
+}
+
+// dbLabel is dbName as a label value: the name of a database an operation
+// found, otherDbLabel for names that never were one.
+func (m *storeMetrics) dbLabel(dbName string, err error) string {
+	var metaErr *EMetaKeyNotFound
+	if err == nil || isEntryNotFound(err) {
+		m.known.Store(dbName, true)
+		return dbName
+	}
+	if !errors.As(err, &metaErr) {
+		if _, ok := m.known.Load(dbName); ok {
+			return dbName
+		}
+	}
+	return otherDbLabel
+}
+
+// sizeCollector reports the size of every database when scraped, and nothing
+// while the store isn't loaded. Databases with a shared handle open are asked
+// for it; the others are measured on disk, so a scrape never has to open one.
+type sizeCollector struct {
+	store *Store
+}
+
+func (sizeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricSizeDesc
+}
+
+func (c sizeCollector) Collect(ch chan<- prometheus.Metric) {
+	if !c.store.isStarted() {
+		return
+	}
+	dbs, err := c.store.listDatabases()
+	if err != nil {
+		logger().Errorf("metrics: unable to list databases: %v", err)
+		return
+	}
+	for key, dbObject := range dbs {
+		dbName := strings.TrimPrefix(key, prefixMetaDb)
+		lsm, vlog, err := c.store.measureDb(dbName, dbObject)
+		if err != nil {
+			logger().Errorf("metrics: unable to size database: %v", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(metricSizeDesc, prometheus.GaugeValue, float64(lsm), dbName, "lsm")
+		ch <- prometheus.MustNewConstMetric(metricSizeDesc, prometheus.GaugeValue, float64(vlog), dbName, "vlog")
+	}
+}
@@ -0,0 +1,63 @@
+package cachekv
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	defer setup()()
+	// nothing is registered globally on import
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.Nil(t, err)
+	for _, family := range families {
+		assert.NotContains(t, family.GetName(), "cachekv")
+	}
+
+	testDb := "metricsdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	reg := prometheus.NewRegistry()
+	assert.Nil(t, RegisterMetrics(reg))
+	defer defaultStore.metrics.Store(nil)
+	m := defaultStore.metrics.Load()
+
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	assert.Nil(t, UpdateEntry(testDb, "key", []byte("value2")))
+	_, err = GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	// a miss is a read, not an error
+	_, err = GetEntry(testDb, "absent")
+	assert.NotNil(t, err)
+	assert.Nil(t, RemoveEntry(testDb, "key"))
+	_, err = GetEntry("missing", "key")
+	assert.NotNil(t, err)
+	_, err = GetEntry("missing2", "key")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.inserts.WithLabelValues(testDb)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.gets.WithLabelValues(testDb)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.deletes.WithLabelValues(testDb)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.errors.WithLabelValues(testDb, "GetEntry")))
+	// names that aren't databases share one label
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.errors.WithLabelValues(otherDbLabel, "GetEntry")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.gets))
+
+	recorder := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(recorder.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), `cachekv_inserts_total{db="metricsdb"}`)
+	assert.Contains(t, string(body), `cachekv_operation_duration_seconds_count{op="GetEntry"}`)
+	assert.Contains(t, string(body), `cachekv_database_size_bytes{db="metricsdb",part="lsm"}`)
+	assert.NotContains(t, string(body), `db="missing"`)
+
+	// a registry takes one set of a store's collectors
+	assert.NotNil(t, RegisterMetrics(reg))
+	assert.Same(t, m, defaultStore.metrics.Load())
+}
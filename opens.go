@@ -0,0 +1,113 @@
+package cachekv
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// OpenSlotTimeout is how long opening a database waits for a free slot when
+// Config.MaxConcurrentOpens databases are already open, before failing with
+// ErrTooManyOpenDbs.
+var OpenSlotTimeout = 30 * time.Second
+
+// ErrTooManyOpenDbs is returned by operations that needed to open a database
+// while Config.MaxConcurrentOpens others stayed in use for OpenSlotTimeout.
+var ErrTooManyOpenDbs = errors.New("too many databases open")
+
+// openSlotPoll is how often a wait for a slot looks again for a handle that
+// went idle, since releasing one doesn't signal.
+const openSlotPoll = 10 * time.Millisecond
+
+// openSlotState counts the shared handles a Store has open, for
+// Config.MaxConcurrentOpens. freed is closed, and replaced, whenever one of
+// them is closed.
+type openSlotState struct {
+	mu    sync.Mutex
+	open  int
+	freed chan struct{}
+}
+
+// OpenDatabaseCount returns how many databases have a shared handle open.
+func (s *Store) OpenDatabaseCount() int {
+	s.openSlots.mu.Lock()
+	defer s.openSlots.mu.Unlock()
+	return s.openSlots.open
+}
+
+// OpenDatabaseCount calls Store.OpenDatabaseCount on the default store.
+func OpenDatabaseCount() int {
+	return defaultStore.OpenDatabaseCount()
+}
+
+// acquireOpenSlot takes a slot for opening dbName's shared handle. With all
+// Config.MaxConcurrentOpens slots taken it closes the handle of a database no
+// operation is using, and failing that waits for one to be closed or to go
+// idle.
+func (s *Store) acquireOpenSlot(dbName string) error {
+	var deadline <-chan time.Time
+	for {
+		s.openSlots.mu.Lock()
+		limit := 0
+		if config := s.config; config != nil {
+			limit = config.MaxConcurrentOpens
+		}
+		if limit <= 0 || s.openSlots.open < limit {
+			s.openSlots.open++
+			s.openSlots.mu.Unlock()
+			return nil
+		}
+		freed := s.openSlots.freed
+		s.openSlots.mu.Unlock()
+
+		if s.evictIdleDb(dbName) {
+			continue
+		}
+		if deadline == nil {
+			deadline = time.After(OpenSlotTimeout)
+		}
+		select {
+		case <-freed:
+		case <-time.After(openSlotPoll):
+		case <-deadline:
+			return ErrTooManyOpenDbs
+		}
+	}
+}
+
+// releaseOpenSlot gives back the slot of a shared handle that was closed.
+func (s *Store) releaseOpenSlot() {
+	s.openSlots.mu.Lock()
+	defer s.openSlots.mu.Unlock()
+	s.openSlots.open--
+	close(s.openSlots.freed)
+	s.openSlots.freed = make(chan struct{})
+}
+
+// evictIdleDb closes the open handle of a database other than dbName that no
+// operation holds, reporting whether it found one.
+func (s *Store) evictIdleDb(dbName string) bool {
+	s.handlesMu.Lock()
+	idle := make([]*dbHandle, 0, len(s.handles))
+	for name, handle := range s.handles {
+		if name != dbName {
+			idle = append(idle, handle)
+		}
+	}
+	s.handlesMu.Unlock()
+	for _, handle := range idle {
+		// a handle in use has its gate held for reading
+		if !handle.gate.TryLock() {
+			continue
+		}
+		evicted := false
+		if handle.isOpen() {
+			evicted = handle.close() == nil
+		}
+		handle.gate.Unlock()
+		if evicted {
+			return true
+		}
+	}
+	return false
+}
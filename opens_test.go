@@ -0,0 +1,50 @@
+package cachekv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxConcurrentOpens(t *testing.T) {
+	defer setup()()
+	defer func(timeout time.Duration) { OpenSlotTimeout = timeout }(OpenSlotTimeout)
+	assert.Nil(t, CreateDatabase("testdb1", true))
+	assert.Nil(t, CreateDatabase("testdb2", true))
+	assert.Nil(t, InsertEntry("testdb1", "key", []byte("value1")))
+	assert.Nil(t, InsertEntry("testdb2", "key", []byte("value2")))
+	assert.Equal(t, 2, OpenDatabaseCount())
+
+	cfg, err := ListConfigurations()
+	assert.Nil(t, err)
+	cfg.MaxConcurrentOpens = 1
+	assert.Nil(t, UpdateConfigurations(cfg))
+	assert.Nil(t, CloseDatabaseByName("testdb2"))
+	assert.Equal(t, 1, OpenDatabaseCount())
+
+	// an idle handle makes room
+	value, err := GetEntry("testdb2", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value2"), value)
+	assert.Equal(t, 1, OpenDatabaseCount())
+	assert.False(t, defaultStore.hasOpenHandle("testdb1"))
+
+	// one in use doesn't
+	storage, err := OpenStorage("testdb1")
+	assert.Nil(t, err)
+	OpenSlotTimeout = 50 * time.Millisecond
+	_, err = GetEntry("testdb2", "key")
+	assert.ErrorIs(t, err, ErrTooManyOpenDbs)
+
+	// until it is released
+	OpenSlotTimeout = 5 * time.Second
+	go func() {
+		time.Sleep(time.Second)
+		assert.Nil(t, storage.Close())
+	}()
+	value, err = GetEntry("testdb2", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value2"), value)
+	assert.Equal(t, 1, OpenDatabaseCount())
+}
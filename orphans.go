@@ -0,0 +1,108 @@
+package cachekv
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+)
+
+// ListOrphanedDirectories returns the badger directories in the store that no
+// DbObject in meta refers to, typically left behind when a process died inside
+// CreateDatabase between creating the directory and registering it in meta.
+// It looks in the store path, the configured database path and any path a
+// registered database lives in. Soft-deleted databases are still in meta and
+// aren't orphans.
+func (s *Store) ListOrphanedDirectories() ([]string, error) {
+	// rotations create directories before meta knows about them
+	if s.rotationInProgress() {
+		return nil, errors.New(errDbRotating)
+	}
+	dbs, err := s.listDatabases()
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{
+		path.Join(s.meta.path, s.meta.file): true,
+		path.Join(s.key.path, s.key.file):   true,
+	}
+	roots := map[string]bool{s.storeDir(): true}
+	if s.config != nil && s.config.StorePath != "" {
+		roots[s.config.StorePath] = true
+	}
+	for _, dbObject := range dbs {
+		known[path.Join(dbObject.DbPath, dbObject.DbFile)] = true
+		roots[dbObject.DbPath] = true
+	}
+	seen := make(map[string]bool)
+	orphans := make([]string, 0)
+	for root := range roots {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			dir := path.Join(root, entry.Name())
+			if !entry.IsDir() || known[dir] || seen[dir] || !isBadgerDir(dir) {
+				continue
+			}
+			seen[dir] = true
+			orphans = append(orphans, dir)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+// ListOrphanedDirectories calls Store.ListOrphanedDirectories on the default store.
+func ListOrphanedDirectories() ([]string, error) {
+	return defaultStore.ListOrphanedDirectories()
+}
+
+// RemoveOrphanedDirectories deletes the given directories, normally a list
+// from ListOrphanedDirectories the operator has reviewed. Each one is checked
+// against a fresh listing first; directories that are no longer orphaned are
+// left alone and reported in the returned error.
+func (s *Store) RemoveOrphanedDirectories(dirs []string) error {
+	orphans, err := s.ListOrphanedDirectories()
+	if err != nil {
+		return err
+	}
+	confirmed := make(map[string]bool, len(orphans))
+	for _, dir := range orphans {
+		confirmed[dir] = true
+	}
+	var errs []error
+	for _, dir := range dirs {
+		dir = path.Clean(dir)
+		if !confirmed[dir] {
+			errs = append(errs, errors.New("not an orphaned directory: "+dir))
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RemoveOrphanedDirectories calls Store.RemoveOrphanedDirectories on the default store.
+func RemoveOrphanedDirectories(dirs []string) error {
+	return defaultStore.RemoveOrphanedDirectories(dirs)
+}
+
+// isBadgerDir reports whether dir looks like a badger database, so unrelated
+// directories sharing the store path are never listed.
+func isBadgerDir(dir string) bool {
+	_, err := os.Stat(path.Join(dir, "MANIFEST"))
+	return err == nil
+}
+
+func (s *Store) rotationInProgress() bool {
+	s.rotationMu.Lock()
+	defer s.rotationMu.Unlock()
+	return len(s.rotations) > 0
+}
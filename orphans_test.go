@@ -0,0 +1,42 @@
+package cachekv
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrphanedDirectories(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	orphans, err := ListOrphanedDirectories()
+	assert.Nil(t, err)
+	assert.Empty(t, orphans)
+
+	// a crash after the directory is created but before meta is written
+	orphan := path.Join(StorePath, "crashed-0123456789abcdef")
+	db, err := OpenDatabase(orphan, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, CloseDatabase(db))
+	// not a badger directory, never listed
+	assert.Nil(t, os.MkdirAll(path.Join(StorePath, "backups"), 0744))
+
+	orphans, err = ListOrphanedDirectories()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{orphan}, orphans)
+
+	dbObject, err := defaultStore.getMetaDbObject("testdb")
+	assert.Nil(t, err)
+	live := path.Join(dbObject.DbPath, dbObject.DbFile)
+	err = RemoveOrphanedDirectories([]string{orphan, live})
+	assert.ErrorContains(t, err, "not an orphaned directory")
+	_, err = os.Stat(orphan)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(live)
+	assert.Nil(t, err)
+	orphans, err = ListOrphanedDirectories()
+	assert.Nil(t, err)
+	assert.Empty(t, orphans)
+}
@@ -0,0 +1,88 @@
+package cachekv
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	// profileTopPrefixes is how many prefixes DatabaseProfile reports.
+	profileTopPrefixes = 10
+	// profileSeparators end a key's prefix, as in "user:42" or "logs/2024".
+	profileSeparators = ":/"
+)
+
+// DatabaseProfile walks dbName's keys, without reading their values, and
+// reports the key count, value sizes, key lengths and most common prefixes.
+// A key's prefix runs up to and including its first ':' or '/'; keys without
+// one are counted under "".
+func (s *Store) DatabaseProfile(dbName string) (*Profile, error) {
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		return nil, err
+	}
+	profile := &Profile{TopPrefixes: make([]PrefixCount, 0)}
+	prefixes := make(map[string]int)
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			key := item.Key()
+			if isReservedKey(key) {
+				continue
+			}
+			if profile.KeyCount == 0 || len(key) < profile.MinKeyLength {
+				profile.MinKeyLength = len(key)
+			}
+			if len(key) > profile.MaxKeyLength {
+				profile.MaxKeyLength = len(key)
+			}
+			profile.KeyCount++
+			profile.TotalValueSize += item.ValueSize()
+			prefixes[keyPrefix(key)]++
+		}
+		return nil
+	})
+	closeErr := s.releaseDb(dbName, db)
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if profile.KeyCount > 0 {
+		profile.AvgValueSize = float64(profile.TotalValueSize) / float64(profile.KeyCount)
+	}
+	for prefix, count := range prefixes {
+		profile.TopPrefixes = append(profile.TopPrefixes, PrefixCount{Prefix: prefix, Count: count})
+	}
+	sort.Slice(profile.TopPrefixes, func(i, j int) bool {
+		a, b := profile.TopPrefixes[i], profile.TopPrefixes[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Prefix < b.Prefix
+	})
+	if len(profile.TopPrefixes) > profileTopPrefixes {
+		profile.TopPrefixes = profile.TopPrefixes[:profileTopPrefixes]
+	}
+	return profile, nil
+}
+
+// DatabaseProfile calls Store.DatabaseProfile on the default store.
+func DatabaseProfile(dbName string) (*Profile, error) {
+	return defaultStore.DatabaseProfile(dbName)
+}
+
+func keyPrefix(key []byte) string {
+	i := strings.IndexAny(string(key), profileSeparators)
+	if i < 0 {
+		return ""
+	}
+	return string(key[:i+1])
+}
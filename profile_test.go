@@ -0,0 +1,44 @@
+package cachekv
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabaseProfile(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	profile, err := DatabaseProfile(testDb)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, profile.KeyCount)
+	assert.Equal(t, 0, len(profile.TopPrefixes))
+
+	entries := make(map[string][]byte)
+	for i := 0; i < 30; i++ {
+		entries["user:"+strconv.Itoa(i)] = []byte("abcd")
+	}
+	for i := 0; i < 10; i++ {
+		entries["logs/"+strconv.Itoa(i)] = []byte("abcdefgh")
+	}
+	entries["k"] = []byte("abcdefghijkl")
+	assert.Nil(t, BatchInsert(testDb, entries))
+
+	profile, err = DatabaseProfile(testDb)
+	assert.Nil(t, err)
+	assert.Equal(t, 41, profile.KeyCount)
+	assert.Equal(t, int64(30*4+10*8+12), profile.TotalValueSize)
+	assert.InDelta(t, float64(212)/41, profile.AvgValueSize, 0.001)
+	assert.Equal(t, 1, profile.MinKeyLength)
+	assert.Equal(t, len("user:10"), profile.MaxKeyLength)
+	assert.Equal(t, []PrefixCount{
+		{Prefix: "user:", Count: 30},
+		{Prefix: "logs/", Count: 10},
+		{Prefix: "", Count: 1},
+	}, profile.TopPrefixes)
+
+	_, err = DatabaseProfile("missing")
+	assert.NotNil(t, err)
+}
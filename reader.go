@@ -0,0 +1,56 @@
+package cachekv
+
+import (
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Reader serves many point reads from one database through a single read
+// transaction, instead of the meta lookup and transaction every GetEntry
+// pays. It reads the database as of NewReader; later writes aren't visible.
+// A Reader isn't safe for concurrent use, and the database stays open until
+// Close.
+type Reader struct {
+	dbName string
+	db     *badger.DB
+	txn    *badger.Txn
+	store  *Store
+}
+
+// NewReader opens dbName for reading with Get.
+func (s *Store) NewReader(dbName string) (*Reader, error) {
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{store: s, dbName: dbName, db: db, txn: db.NewTransaction(false)}, nil
+}
+
+// NewReader calls Store.NewReader on the default store.
+func NewReader(dbName string) (*Reader, error) {
+	return defaultStore.NewReader(dbName)
+}
+
+// Get returns the value of key, or badger.ErrKeyNotFound.
+func (r *Reader) Get(key string) ([]byte, error) {
+	if r.txn == nil {
+		return nil, errors.New(r.dbName + " - reader is closed")
+	}
+	item, err := r.txn.Get([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	return itemValue(item)
+}
+
+// Close ends the transaction and closes the database. It is safe to call
+// more than once.
+func (r *Reader) Close() error {
+	if r.txn == nil {
+		return nil
+	}
+	r.txn.Discard()
+	r.txn = nil
+	return r.store.releaseDb(r.dbName, r.db)
+}
@@ -0,0 +1,63 @@
+package cachekv
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReader(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	entries := make(map[string][]byte)
+	for i := 0; i < 1000; i++ {
+		entries["key"+strconv.Itoa(i)] = []byte("value" + strconv.Itoa(i))
+	}
+	assert.Nil(t, BatchInsert(testDb, entries))
+
+	reader, err := NewReader(testDb)
+	assert.Nil(t, err)
+	for key, value := range entries {
+		got, err := reader.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, value, got)
+	}
+	_, err = reader.Get("missing")
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+	assert.Nil(t, reader.Close())
+	assert.Nil(t, reader.Close())
+	_, err = reader.Get("key1")
+	assert.NotNil(t, err)
+
+	_, err = NewReader("missing")
+	assert.NotNil(t, err)
+}
+
+func BenchmarkReaderGet(b *testing.B) {
+	defer setup()()
+	testDb := "testdb"
+	entries := make(map[string][]byte)
+	for i := 0; i < 10000; i++ {
+		entries["key"+strconv.Itoa(i)] = []byte("value")
+	}
+	if err := CreateDatabase(testDb, true); err != nil {
+		b.Fatal(err)
+	}
+	if err := BatchInsert(testDb, entries); err != nil {
+		b.Fatal(err)
+	}
+	reader, err := NewReader(testDb)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer reader.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := reader.Get("key" + strconv.Itoa(i%len(entries))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
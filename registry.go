@@ -0,0 +1,106 @@
+package cachekv
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+// namedKeyDir is where a named store keeps its keypair, under its store path.
+const namedKeyDir = ".private"
+
+// namedStores keeps the stores opened with OpenNamedStore, by name.
+var namedStores = struct {
+	sync.Mutex
+	byName map[string]*Store
+}{byName: make(map[string]*Store)}
+
+// OpenNamedStore loads the store at storePath, creating it if there's none,
+// and registers it as name, e.g. one store per tenant. Each named store has
+// its own meta db, keyring and keypair, the keypair under storePath too, so
+// nothing is shared with the default store or other named ones. cfg, when
+// not nil, replaces the store's configuration, except its paths. A name or
+// a store path already registered, or used by the running default store, is
+// refused.
+func OpenNamedStore(name, storePath string, cfg *Config) (*Store, error) {
+	if name == "" {
+		return nil, errors.New("store name must not be empty")
+	}
+	if storePath == "" {
+		return nil, fmt.Errorf("%s - store path must not be empty", name)
+	}
+	namedStores.Lock()
+	defer namedStores.Unlock()
+	if _, ok := namedStores.byName[name]; ok {
+		return nil, fmt.Errorf("%s - store name already registered", name)
+	}
+	for other, s := range namedStores.byName {
+		if samePath(s.storeDir(), storePath) {
+			return nil, fmt.Errorf("%s - store path already used by %s", name, other)
+		}
+	}
+	if defaultStore.isStarted() && samePath(defaultStore.storeDir(), storePath) {
+		return nil, fmt.Errorf("%s - store path already used by the default store", name)
+	}
+	s, err := NewStore(WithStorePath(storePath), WithKeyPath(path.Join(storePath, namedKeyDir)))
+	if err != nil {
+		return nil, fmt.Errorf("%s - %w", name, err)
+	}
+	if cfg != nil {
+		if err = s.applyNamedConfig(cfg); err != nil {
+			_ = s.Shutdown()
+			return nil, fmt.Errorf("%s - %w", name, err)
+		}
+	}
+	namedStores.byName[name] = s
+	return s, nil
+}
+
+// GetNamedStore returns the store registered as name, or false if there's
+// none.
+func GetNamedStore(name string) (*Store, bool) {
+	namedStores.Lock()
+	defer namedStores.Unlock()
+	s, ok := namedStores.byName[name]
+	return s, ok
+}
+
+// CloseNamedStore shuts down the store registered as name and forgets it, so
+// name and its store path can be opened again.
+func CloseNamedStore(name string) error {
+	namedStores.Lock()
+	s, ok := namedStores.byName[name]
+	delete(namedStores.byName, name)
+	namedStores.Unlock()
+	if !ok {
+		return fmt.Errorf("%s - no store registered under that name", name)
+	}
+	return s.Shutdown()
+}
+
+// applyNamedConfig writes cfg as s's configuration, keeping the paths s
+// was loaded from.
+func (s *Store) applyNamedConfig(cfg *Config) error {
+	current, err := s.CurrentConfig()
+	if err != nil {
+		return err
+	}
+	config := *cfg
+	config.StorePath = current.StorePath
+	config.MetaStore = current.MetaStore
+	config.MetaFile = current.MetaFile
+	return s.UpdateConfigurations(&config)
+}
+
+// samePath reports whether a and b name the same directory, however they
+// are spelled.
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return path.Clean(a) == path.Clean(b)
+	}
+	return absA == absB
+}
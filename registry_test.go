@@ -0,0 +1,64 @@
+package cachekv
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenNamedStore(t *testing.T) {
+	defer setup()()
+	dirs := []string{"./test-store-tenant-a/", "./test-store-tenant-b/"}
+	defer func() {
+		for _, dir := range dirs {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+	cfg := &Config{SecureNewDb: true, SlowOpThreshold: time.Second, StorePath: "./elsewhere/"}
+	a, err := OpenNamedStore("tenant-a", dirs[0], cfg)
+	assert.Nil(t, err)
+	b, err := OpenNamedStore("tenant-b", dirs[1], nil)
+	assert.Nil(t, err)
+	found, ok := GetNamedStore("tenant-a")
+	assert.True(t, ok)
+	assert.Same(t, a, found)
+	_, ok = GetNamedStore("tenant-c")
+	assert.False(t, ok)
+
+	config, err := a.CurrentConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, config.SlowOpThreshold)
+	assert.Equal(t, dirs[0], config.StorePath)
+	assert.FileExists(t, dirs[0]+namedKeyDir+"/"+privateFile)
+	assert.FileExists(t, dirs[1]+namedKeyDir+"/"+privateFile)
+
+	assert.Nil(t, a.CreateDatabase("testdb", true))
+	assert.Nil(t, a.InsertEntry("testdb", "key", []byte("a")))
+	_, err = b.GetEntry("testdb", "key")
+	assert.NotNil(t, err)
+	_, err = GetEntry("testdb", "key")
+	assert.NotNil(t, err)
+
+	// names and paths are taken until the store is closed
+	_, err = OpenNamedStore("tenant-a", "./test-store-tenant-c/", nil)
+	assert.NotNil(t, err)
+	_, err = OpenNamedStore("tenant-c", "./test-store-tenant-b", nil)
+	assert.NotNil(t, err)
+	_, err = OpenNamedStore("tenant-c", StorePath, nil)
+	assert.NotNil(t, err)
+	assert.NoDirExists(t, "./test-store-tenant-c/")
+
+	assert.Nil(t, CloseNamedStore("tenant-a"))
+	assert.Nil(t, CloseNamedStore("tenant-b"))
+	assert.NotNil(t, CloseNamedStore("tenant-b"))
+	_, ok = GetNamedStore("tenant-a")
+	assert.False(t, ok)
+	a, err = OpenNamedStore("tenant-a", dirs[0], nil)
+	assert.Nil(t, err)
+	defer CloseNamedStore("tenant-a")
+	value, err := a.GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), value)
+}
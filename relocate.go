@@ -0,0 +1,100 @@
+package cachekv
+
+import (
+	"errors"
+	"os"
+	"path"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// RelocateDatabase moves dbName into newDir, typically on another volume, by
+// streaming its contents into a copy there. The database refuses operations
+// while it moves; the others carry on. The meta db is the pointer that makes
+// this crash-safe: until meta is updated the old directory stays the live one,
+// and afterwards the new one is. A crash before that leaves a partial copy in
+// newDir, one after it leaves the old directory behind; remove either once
+// confirmed with ListOrphanedDirectories and RemoveOrphanedDirectories.
+func (s *Store) RelocateDatabase(dbName, newDir string) error {
+	ctx, state, err := s.beginDbRotation(dbName)
+	if err != nil {
+		return err
+	}
+	defer s.endDbRotation(state)
+	// let operations that were already running finish first
+	gate, err := s.lockDb(dbName)
+	if err != nil {
+		return err
+	}
+	defer gate.Unlock()
+
+	dbObject, err := s.getMetaDbObject(dbName)
+	if err != nil {
+		return err
+	}
+	newDir = path.Clean(newDir)
+	if newDir == path.Clean(dbObject.DbPath) {
+		return errors.New(dbName + " - database is already in " + newDir)
+	}
+	key, err := s.getDbKey(dbName, dbObject)
+	if err != nil {
+		return err
+	}
+	oldPath := path.Join(dbObject.DbPath, dbObject.DbFile)
+	newPath := path.Join(newDir, dbObject.DbFile)
+	if _, err = os.Stat(newPath); err == nil {
+		return errors.New("database directory already exists: " + newPath)
+	}
+	if err = os.MkdirAll(newDir, 0744); err != nil {
+		return err
+	}
+
+	state.setTarget(newPath)
+	opts := s.dbOpenOptions(dbObject)
+	open := func(dbPath string) (*badger.DB, error) {
+		if dbObject.Secure {
+			return OpenDatabaseWithOptions(dbPath, key, opts)
+		}
+		return openUnsecuredDbWithOptions(dbPath, opts)
+	}
+	src, err := open(oldPath)
+	if err != nil {
+		return err
+	}
+	dst, err := open(newPath)
+	if err != nil {
+		_ = CloseDatabase(src)
+		_ = os.RemoveAll(newPath)
+		return err
+	}
+	err = streamCopy(ctx, src, dst)
+	srcErr := CloseDatabase(src)
+	dstErr := CloseDatabase(dst)
+	if err == nil {
+		err = errors.Join(srcErr, dstErr)
+	}
+	if err == nil {
+		err = state.commit()
+	}
+	if err != nil {
+		_ = os.RemoveAll(newPath)
+		return err
+	}
+
+	dbObject.DbPath = newDir
+	err = s.writeMetaDbObject(dbName, dbObject, true)
+	if err != nil {
+		_ = os.RemoveAll(newPath)
+		return err
+	}
+	err = os.RemoveAll(oldPath)
+	if err != nil {
+		logger().Errorf("error removing pre-relocation db dir: %v", err)
+	}
+	return nil
+}
+
+// RelocateDatabase calls Store.RelocateDatabase on the default store.
+func RelocateDatabase(dbName, newDir string) error {
+	return defaultStore.RelocateDatabase(dbName, newDir)
+}
@@ -0,0 +1,47 @@
+package cachekv
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelocateDatabase(t *testing.T) {
+	defer setup()()
+	newDir := "./test-relocated"
+	defer func() { _ = os.RemoveAll(newDir) }()
+	for _, secure := range []bool{true, false} {
+		testDb := "testdb-" + strconv.FormatBool(secure)
+		assert.Nil(t, CreateDatabase(testDb, secure))
+		entries := make(map[string][]byte)
+		for i := 0; i < 100; i++ {
+			entries["key"+strconv.Itoa(i)] = []byte("value" + strconv.Itoa(i))
+		}
+		assert.Nil(t, BatchInsert(testDb, entries))
+		before, err := defaultStore.getMetaDbObject(testDb)
+		assert.Nil(t, err)
+
+		assert.Nil(t, RelocateDatabase(testDb, newDir))
+		after, err := defaultStore.getMetaDbObject(testDb)
+		assert.Nil(t, err)
+		assert.Equal(t, path.Clean(newDir), after.DbPath)
+		assert.Equal(t, before.DbFile, after.DbFile)
+		_, err = os.Stat(path.Join(before.DbPath, before.DbFile))
+		assert.True(t, os.IsNotExist(err))
+		for k, v := range entries {
+			value, err := GetEntry(testDb, k)
+			assert.Nil(t, err)
+			assert.Equal(t, v, value)
+		}
+		assert.Nil(t, InsertEntry(testDb, "after", []byte("move")))
+		assert.NotNil(t, RelocateDatabase(testDb, newDir))
+		assert.False(t, defaultStore.isDbRotating(testDb))
+	}
+	orphans, err := ListOrphanedDirectories()
+	assert.Nil(t, err)
+	assert.Empty(t, orphans)
+	assert.NotNil(t, RelocateDatabase("missing", newDir))
+}
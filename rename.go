@@ -0,0 +1,128 @@
+package cachekv
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// RenameDatabase registers oldName's database under newName, without
+// touching its data: the directory keeps its name, which was only ever
+// derived from the database name at creation. Its meta entry, keyring entry
+// and expiry index move to the new name; its events stay recorded under the
+// old one. The database refuses operations while it is renamed. newName must
+// be a valid name that isn't taken.
+//
+// A database whose key is derived from the master key can't be renamed, as
+// the name is part of the derivation.
+func (s *Store) RenameDatabase(oldName, newName string) error {
+	if err := ValidateDatabaseName(newName); err != nil {
+		return err
+	}
+	if oldName == newName {
+		return errors.New(oldName + " - database already has that name")
+	}
+	_, state, err := s.beginDbRotation(oldName)
+	if err != nil {
+		return err
+	}
+	defer s.endDbRotation(state)
+	// let operations that were already running finish first
+	gate, err := s.lockDb(oldName)
+	if err != nil {
+		return err
+	}
+	defer gate.Unlock()
+
+	dbObject, err := s.getMetaDbObject(oldName)
+	if err != nil {
+		return err
+	}
+	if dbObject.KeyDerived {
+		return errors.New(oldName + " - database key is derived from its name, it can't be renamed")
+	}
+	exist, err := s.databaseExist(newName)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return fmt.Errorf("%s - database already exists", newName)
+	}
+	// the key goes first: until meta points at the new name, a crash leaves
+	// a spare keyring entry rather than a database without its key
+	moveKey := dbObject.Secure
+	if moveKey {
+		key, err := s.getDbKeyFromKeyring(oldName)
+		if err != nil {
+			return err
+		}
+		if err = s.WriteToKeyring(prefixMetaDb+newName, key); err != nil {
+			return err
+		}
+	}
+	if err = s.renameMetaEntries(oldName, newName); err != nil {
+		if moveKey {
+			_ = s.removeFromKeyring(prefixMetaDb + newName)
+		}
+		return err
+	}
+	if moveKey {
+		if err = s.removeFromKeyring(prefixMetaDb + oldName); err != nil {
+			logger().Errorf("error removing pre-rename db key: %v", err)
+		}
+	}
+	_ = s.writeDbEvent(EventTypeUpdate, newName, "Renamed database: "+oldName+" to "+newName)
+	return nil
+}
+
+// RenameDatabase calls Store.RenameDatabase on the default store.
+func RenameDatabase(oldName, newName string) error {
+	return defaultStore.RenameDatabase(oldName, newName)
+}
+
+// renameMetaEntries moves oldName's meta entry and expiry index to newName
+// in one meta transaction.
+func (s *Store) renameMetaEntries(oldName, newName string) error {
+	meta, err := s.openMeta()
+	if err != nil {
+		return err
+	}
+	err = meta.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(prefixMetaDb + oldName))
+		if err != nil {
+			return err
+		}
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if err = txn.Set([]byte(prefixMetaDb+newName), value); err != nil {
+			return err
+		}
+		if err = txn.Delete([]byte(prefixMetaDb + oldName)); err != nil {
+			return err
+		}
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		oldPrefix := []byte(expiryIndexPrefix(oldName))
+		newPrefix := expiryIndexPrefix(newName)
+		for it.Seek(oldPrefix); it.ValidForPrefix(oldPrefix); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			indexKey := []byte(newPrefix + string(key[len(oldPrefix):]))
+			if err = txn.Set(indexKey, value); err != nil {
+				return err
+			}
+			if err = txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	s.releaseMeta()
+	return err
+}
@@ -0,0 +1,90 @@
+package cachekv
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenameDatabase(t *testing.T) {
+	defer setup()()
+	for _, secure := range []bool{true, false} {
+		oldName, newName := "typo-db", "testdb"
+		assert.Nil(t, CreateDatabase(oldName, secure))
+		assert.Nil(t, InsertEntry(oldName, "key", []byte("value")))
+		assert.Nil(t, InsertEntryWithTTL(oldName, "ttl-key", []byte("value"), time.Hour))
+		before, err := defaultStore.getMetaDbObject(oldName)
+		assert.Nil(t, err)
+
+		assert.Nil(t, RenameDatabase(oldName, newName))
+		value, err := GetEntry(newName, "key")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value"), value)
+		var metaErr *EMetaKeyNotFound
+		_, err = GetEntry(oldName, "key")
+		assert.True(t, errors.As(err, &metaErr))
+
+		after, err := defaultStore.getMetaDbObject(newName)
+		assert.Nil(t, err)
+		assert.Equal(t, before.DbFile, after.DbFile)
+		assert.Equal(t, secure, after.Secure)
+		entries, err := ListKeyringEntries()
+		assert.Nil(t, err)
+		assert.NotContains(t, entries, prefixMetaDb+oldName)
+		if secure {
+			assert.Contains(t, entries, prefixMetaDb+newName)
+		} else {
+			assert.NotContains(t, entries, prefixMetaDb+newName)
+		}
+		assert.Len(t, metaKeysWithPrefix(t, expiryIndexPrefix(newName)), 1)
+		assert.Empty(t, metaKeysWithPrefix(t, expiryIndexPrefix(oldName)))
+
+		events, err := ListEventsForDatabase(newName)
+		assert.Nil(t, err)
+		renamed := false
+		for _, event := range events {
+			renamed = renamed || event.Type == EventTypeUpdate && event.Comment == "Renamed database: "+oldName+" to "+newName
+		}
+		assert.True(t, renamed)
+		assert.Nil(t, DeleteDatabase(newName))
+	}
+}
+
+func TestRenameDatabaseErrors(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb1", true))
+	assert.Nil(t, CreateDatabase("testdb2", false))
+	assert.NotNil(t, RenameDatabase("testdb1", "testdb2"))
+	assert.ErrorIs(t, RenameDatabase("testdb1", "bad name"), ErrInvalidDatabaseName)
+	var metaErr *EMetaKeyNotFound
+	assert.True(t, errors.As(RenameDatabase("missing", "testdb3"), &metaErr))
+	// nothing moved
+	_, err := defaultStore.getMetaDbObject("testdb1")
+	assert.Nil(t, err)
+	_, err = defaultStore.getFromKeyring(prefixMetaDb + "testdb1")
+	assert.Nil(t, err)
+
+	assert.Nil(t, SetMasterKey(make([]byte, 32)))
+	defer SetMasterKey(nil)
+	assert.Nil(t, CreateDatabase("derived", true))
+	assert.NotNil(t, RenameDatabase("derived", "testdb3"))
+}
+
+func metaKeysWithPrefix(t *testing.T, prefix string) []string {
+	meta, err := defaultStore.openMeta()
+	assert.Nil(t, err)
+	defer defaultStore.releaseMeta()
+	keys := make([]string, 0)
+	assert.Nil(t, meta.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+			keys = append(keys, string(it.Item().Key()))
+		}
+		return nil
+	}))
+	return keys
+}
@@ -0,0 +1,338 @@
+package cachekv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"github.com/dgraph-io/ristretto/v2/z"
+	"google.golang.org/protobuf/proto"
+)
+
+// metaRotationName identifies a meta db rotation in RotationStatus.
+const metaRotationName = "_meta"
+
+// rotationState tracks one key rotation so it can be reported and aborted.
+// Once a rotation starts switching meta and the keyring over to the new copy
+// it is committing and can no longer be aborted.
+type rotationState struct {
+	db         string
+	started    time.Time
+	newPath    string
+	cancel     context.CancelFunc
+	aborted    bool
+	committing bool
+	store      *Store
+	// done is closed when the rotation returns, and stops using newPath.
+	done chan struct{}
+}
+
+func (s *Store) beginDbRotation(dbName string) (context.Context, *rotationState, error) {
+	s.rotationMu.Lock()
+	defer s.rotationMu.Unlock()
+	if s.rotations[dbName] != nil {
+		return nil, nil, errors.New(dbName + " - " + errDbRotating)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	state := &rotationState{store: s, db: dbName, started: clock(), cancel: cancel, done: make(chan struct{})}
+	s.rotations[dbName] = state
+	return ctx, state, nil
+}
+
+// setTarget records the directory being written, for AbortRotation to clean up.
+func (r *rotationState) setTarget(newPath string) {
+	r.store.rotationMu.Lock()
+	defer r.store.rotationMu.Unlock()
+	r.newPath = newPath
+}
+
+// commit marks the point of no return; it fails if the rotation was aborted.
+func (r *rotationState) commit() error {
+	r.store.rotationMu.Lock()
+	defer r.store.rotationMu.Unlock()
+	if r.aborted {
+		return ErrRotationAborted
+	}
+	r.committing = true
+	return nil
+}
+
+func (s *Store) endDbRotation(state *rotationState) {
+	s.rotationMu.Lock()
+	defer s.rotationMu.Unlock()
+	state.cancel()
+	close(state.done)
+	if s.rotations[state.db] == state {
+		delete(s.rotations, state.db)
+	}
+}
+
+func (s *Store) isDbRotating(dbName string) bool {
+	s.rotationMu.Lock()
+	defer s.rotationMu.Unlock()
+	return s.rotations[dbName] != nil
+}
+
+// RotationStatus reports the longest running key rotation or relocation, if
+// any. db is the database name, or "_meta" for the meta db.
+func (s *Store) RotationStatus() (inProgress bool, db string, started time.Time) {
+	s.rotationMu.Lock()
+	defer s.rotationMu.Unlock()
+	var oldest *rotationState
+	for _, state := range s.rotations {
+		if oldest == nil || state.started.Before(oldest.started) {
+			oldest = state
+		}
+	}
+	if oldest == nil {
+		return false, "", time.Time{}
+	}
+	return true, oldest.db, oldest.started
+}
+
+// RotationStatus calls Store.RotationStatus on the default store.
+func RotationStatus() (inProgress bool, db string, started time.Time) {
+	return defaultStore.RotationStatus()
+}
+
+// AbortRotation cancels every rotation that hasn't started committing yet,
+// removes the partially-written copies and lifts the rotating flag, so the
+// affected databases serve requests again under their old keys. Rotations
+// already committing are left to finish and reported as an error. A copy is
+// only removed once its rotation has stopped writing to it, so AbortRotation
+// waits for the cancelled rotations to return.
+func (s *Store) AbortRotation() error {
+	s.rotationMu.Lock()
+	if len(s.rotations) == 0 {
+		s.rotationMu.Unlock()
+		return ErrNoRotation
+	}
+	var errs []error
+	cancelled := make([]*rotationState, 0, len(s.rotations))
+	targets := make([]string, 0, len(s.rotations))
+	for name, state := range s.rotations {
+		if state.committing {
+			errs = append(errs, fmt.Errorf("%s - %w", name, ErrRotationCommitting))
+			continue
+		}
+		state.aborted = true
+		state.cancel()
+		cancelled = append(cancelled, state)
+		targets = append(targets, state.newPath)
+		if name == metaRotationName {
+			s.meta.rotatingKey = false
+		}
+		delete(s.rotations, name)
+	}
+	s.rotationMu.Unlock()
+	for i, state := range cancelled {
+		<-state.done
+		if targets[i] == "" {
+			continue
+		}
+		if err := os.RemoveAll(targets[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AbortRotation calls Store.AbortRotation on the default store.
+func AbortRotation() error {
+	return defaultStore.AbortRotation()
+}
+
+// streamCopy copies every live entry of src into dst, keeping TTLs and user
+// meta, through a single WriteBatch fed straight from the stream.
+func streamCopy(ctx context.Context, src *badger.DB, dst *badger.DB) error {
+	wb := dst.NewWriteBatch()
+	defer wb.Cancel()
+	stream := src.NewStream()
+	stream.NumGo = 20
+	stream.LogPrefix = "copy -> "
+	stream.Send = func(buffer *z.Buffer) error {
+		return buffer.SliceIterate(func(slice []byte) error {
+			kv := new(pb.KV)
+			if err := proto.Unmarshal(slice, kv); err != nil {
+				return err
+			}
+			entry := badger.NewEntry(kv.Key, kv.Value)
+			if len(kv.UserMeta) > 0 {
+				entry = entry.WithMeta(kv.UserMeta[0])
+			}
+			entry.ExpiresAt = kv.ExpiresAt
+			return wb.SetEntry(entry)
+		})
+	}
+	err := stream.Orchestrate(ctx)
+	if err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+// RotateDatabaseKey re-encrypts a secure database under a fresh key by copying
+// it into a new directory; the old directory is removed once meta and the
+// keyring point at the new one. The database refuses other operations while
+// this runs, see RotationStatus and AbortRotation. Both directories are
+// opened with the database's own open options. A database that isn't secure
+// has no key to rotate and is refused, as is every database of a store made
+// WithInMemory, which has no directory to copy.
+func (s *Store) RotateDatabaseKey(dbName string) error {
+	if s.inMemory {
+		return errors.New(dbName + " - in-memory databases have no key to rotate")
+	}
+	ctx, state, err := s.beginDbRotation(dbName)
+	if err != nil {
+		return err
+	}
+	defer s.endDbRotation(state)
+	// let operations that were already running finish, then close the
+	// shared handle, which would keep the old directory locked
+	gate, err := s.lockDb(dbName)
+	if err != nil {
+		return err
+	}
+	defer gate.Unlock()
+	dbObject, err := s.getMetaDbObject(dbName)
+	if err != nil {
+		return err
+	}
+	if !dbObject.Secure {
+		return errors.New(dbName + " - database is not secure, no key to rotate")
+	}
+	if dbObject.KeyDerived {
+		return errors.New(dbName + " - database key is derived from the master key")
+	}
+	oldKey, err := s.getDbKey(dbName, dbObject)
+	if err != nil {
+		return err
+	}
+	oldB64Key, err := s.getFromKeyring(prefixMetaDb + dbName)
+	if err != nil {
+		return err
+	}
+	newKey, err := randomValues(keyLength)
+	if err != nil {
+		return err
+	}
+	dbId, _ := randomValues(fileIdLength)
+	newFile := dbName + "-" + string(dbId)
+	oldPath := path.Join(dbObject.DbPath, dbObject.DbFile)
+	newPath := path.Join(dbObject.DbPath, newFile)
+
+	state.setTarget(newPath)
+	opts := s.dbOpenOptions(dbObject)
+	src, err := OpenDatabaseWithOptions(oldPath, oldKey, opts)
+	if err != nil {
+		return err
+	}
+	dst, err := OpenDatabaseWithOptions(newPath, newKey, opts)
+	if err != nil {
+		_ = CloseDatabase(src)
+		return err
+	}
+	err = streamCopy(ctx, src, dst)
+	srcErr := CloseDatabase(src)
+	dstErr := CloseDatabase(dst)
+	if err == nil {
+		err = errors.Join(srcErr, dstErr)
+	}
+	if err == nil {
+		err = state.commit()
+	}
+	if err != nil {
+		_ = os.RemoveAll(newPath)
+		return err
+	}
+	// undo puts the filesystem back the way it was if the switch-over fails
+	undo := func() {
+		_ = os.RemoveAll(newPath)
+	}
+	if s.config != nil && s.config.DeterministicDirNames && dbObject.DbFile == DeterministicDirName(dbName) {
+		// keep the predictable name: swap the copy into the old directory's place
+		livePath := oldPath
+		retiredPath := oldPath + ".old"
+		if err = os.Rename(livePath, retiredPath); err != nil {
+			undo()
+			return err
+		}
+		if err = os.Rename(newPath, livePath); err != nil {
+			_ = os.Rename(retiredPath, livePath)
+			undo()
+			return err
+		}
+		undo = func() {
+			_ = os.RemoveAll(livePath)
+			_ = os.Rename(retiredPath, livePath)
+		}
+		newFile = dbObject.DbFile
+		oldPath = retiredPath
+	}
+
+	// the keyring and meta live in separate dbs, so put the old key back if
+	// meta can't be switched over
+	err = s.WriteToKeyring(prefixMetaDb+dbName, []byte(b64Encode(newKey)))
+	if err != nil {
+		undo()
+		return err
+	}
+	dbObject.DbFile = newFile
+	dbObject.LastRotated = clock().UnixMilli()
+	// the copy was written by this build
+	dbObject.BadgerVersion = badgerVersion()
+	err = s.writeMetaDbObject(dbName, dbObject, true)
+	if err != nil {
+		if e := s.WriteToKeyring(prefixMetaDb+dbName, oldB64Key); e != nil {
+			logger().Errorf("error restoring previous db key: %v", e)
+		}
+		undo()
+		return err
+	}
+	err = os.RemoveAll(oldPath)
+	if err != nil {
+		logger().Errorf("error removing pre-rotation db dir: %v", err)
+	}
+	return nil
+}
+
+// RotateDatabaseKey calls Store.RotateDatabaseKey on the default store.
+func RotateDatabaseKey(dbName string) error {
+	return defaultStore.RotateDatabaseKey(dbName)
+}
+
+// RotateAllKeys rotates the key of every active secure database. It keeps
+// going past individual failures, reporting the rotated databases and the
+// error for each one that failed; err is only set if the databases can't be
+// listed at all.
+func (s *Store) RotateAllKeys() (rotated []string, failed map[string]error, err error) {
+	dbs, err := s.listDatabases()
+	if err != nil {
+		return nil, nil, err
+	}
+	rotated = make([]string, 0)
+	failed = make(map[string]error)
+	for key, dbObject := range dbs {
+		if !dbObject.Secure || !dbObject.Active || dbObject.KeyDerived {
+			continue
+		}
+		dbName := strings.TrimPrefix(key, prefixMetaDb)
+		if e := s.RotateDatabaseKey(dbName); e != nil {
+			failed[dbName] = e
+			continue
+		}
+		rotated = append(rotated, dbName)
+	}
+	return rotated, failed, nil
+}
+
+// RotateAllKeys calls Store.RotateAllKeys on the default store.
+func RotateAllKeys() (rotated []string, failed map[string]error, err error) {
+	return defaultStore.RotateAllKeys()
+}
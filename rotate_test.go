@@ -0,0 +1,179 @@
+package cachekv
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateAllKeys(t *testing.T) {
+	defer setup()()
+	entries := map[string][]byte{"k1": []byte("v1"), "k2": []byte("v2"), "k3": []byte("v3")}
+	for _, name := range []string{"secure1", "secure2"} {
+		assert.Nil(t, CreateDatabase(name, true))
+		assert.Nil(t, BatchInsert(name, entries))
+	}
+	assert.Nil(t, CreateDatabase("plain", false))
+	assert.Nil(t, BatchInsert("plain", entries))
+	before, err := defaultStore.listDatabases()
+	assert.Nil(t, err)
+	oldKey, err := defaultStore.getFromKeyring(prefixMetaDb + "secure1")
+	assert.Nil(t, err)
+
+	rotated, failed, err := RotateAllKeys()
+	assert.Nil(t, err)
+	assert.Empty(t, failed)
+	sort.Strings(rotated)
+	assert.Equal(t, []string{"secure1", "secure2"}, rotated)
+
+	for _, name := range []string{"secure1", "secure2", "plain"} {
+		for k, v := range entries {
+			value, e := GetEntry(name, k)
+			assert.Nil(t, e)
+			assert.Equal(t, v, value)
+		}
+	}
+	after, err := defaultStore.listDatabases()
+	assert.Nil(t, err)
+	for _, name := range rotated {
+		oldObject := before[prefixMetaDb+name]
+		newObject := after[prefixMetaDb+name]
+		assert.NotEqual(t, oldObject.DbFile, newObject.DbFile)
+		assert.Greater(t, newObject.LastRotated, int64(0))
+		_, e := os.Stat(path.Join(oldObject.DbPath, oldObject.DbFile))
+		assert.True(t, os.IsNotExist(e))
+	}
+	assert.Equal(t, before[prefixMetaDb+"plain"].DbFile, after[prefixMetaDb+"plain"].DbFile)
+	newKey, err := defaultStore.getFromKeyring(prefixMetaDb + "secure1")
+	assert.Nil(t, err)
+	assert.NotEqual(t, oldKey, newKey)
+}
+
+func TestRotateDatabaseKey(t *testing.T) {
+	defer setup()()
+	entries := make(map[string][]byte)
+	for i := range 100 {
+		entries["key"+strconv.Itoa(i)] = []byte("value" + strconv.Itoa(i))
+	}
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, BatchInsert("testdb", entries))
+	before, err := defaultStore.getMetaDbObject("testdb")
+	assert.Nil(t, err)
+	oldKey, err := defaultStore.getDbKey("testdb", before)
+	assert.Nil(t, err)
+
+	assert.Nil(t, RotateDatabaseKey("testdb"))
+	after, err := defaultStore.getMetaDbObject("testdb")
+	assert.Nil(t, err)
+	assert.NotEqual(t, before.DbFile, after.DbFile)
+	assert.Greater(t, after.LastRotated, int64(0))
+	_, err = os.Stat(path.Join(before.DbPath, before.DbFile))
+	assert.True(t, os.IsNotExist(err))
+	newKey, err := defaultStore.getDbKey("testdb", after)
+	assert.Nil(t, err)
+	assert.NotEqual(t, oldKey, newKey)
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	values, err := BatchGet("testdb", keys)
+	assert.Nil(t, err)
+	assert.Equal(t, entries, values)
+
+	// the copy is only readable with the new key
+	assert.Nil(t, CloseDatabaseByName("testdb"))
+	db, err := OpenDatabase(path.Join(after.DbPath, after.DbFile), oldKey)
+	if err == nil {
+		_ = CloseDatabase(db)
+	}
+	assert.NotNil(t, err)
+
+	assert.Nil(t, CreateDatabase("plain", false))
+	assert.NotNil(t, RotateDatabaseKey("plain"))
+
+	// in-memory databases have no directory to copy, and keep their data
+	fast, _, cleanup := newTieredTestStores(t)
+	defer cleanup()
+	assert.Nil(t, fast.CreateDatabase("testdb", true))
+	assert.Nil(t, fast.InsertEntry("testdb", "key", []byte("value")))
+	assert.NotNil(t, fast.RotateDatabaseKey("testdb"))
+	value, err := fast.GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+}
+
+func TestRotateKeyKeepsDeterministicDir(t *testing.T) {
+	defer setup()()
+	cfg, err := ListConfigurations()
+	assert.Nil(t, err)
+	cfg.DeterministicDirNames = true
+	assert.Nil(t, UpdateConfigurations(cfg))
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, InsertEntry("testdb", "key", []byte("value")))
+	assert.Nil(t, RotateDatabaseKey("testdb"))
+	dbObject, err := defaultStore.getMetaDbObject("testdb")
+	assert.Nil(t, err)
+	assert.Equal(t, DeterministicDirName("testdb"), dbObject.DbFile)
+	_, err = os.Stat(path.Join(dbObject.DbPath, dbObject.DbFile+".old"))
+	assert.True(t, os.IsNotExist(err))
+	value, err := GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+}
+
+func TestRotationStatusAndAbort(t *testing.T) {
+	defer setup()()
+	inProgress, db, started := RotationStatus()
+	assert.False(t, inProgress)
+	assert.Equal(t, "", db)
+	assert.True(t, started.IsZero())
+	assert.ErrorIs(t, AbortRotation(), ErrNoRotation)
+
+	assert.Nil(t, CreateDatabase("testdb", true))
+	// simulate a rotation half-way through its copy, which keeps its target
+	// until it notices the cancellation and returns
+	ctx, state, err := defaultStore.beginDbRotation("testdb")
+	assert.Nil(t, err)
+	partial := path.Join(StorePath, "testdb-partial")
+	assert.Nil(t, os.MkdirAll(partial, 0744))
+	state.setTarget(partial)
+	targetKept, committed := make(chan error, 1), make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		time.Sleep(100 * time.Millisecond)
+		_, err := os.Stat(partial)
+		targetKept <- err
+		committed <- state.commit()
+		defaultStore.endDbRotation(state)
+	}()
+	inProgress, db, started = RotationStatus()
+	assert.True(t, inProgress)
+	assert.Equal(t, "testdb", db)
+	assert.False(t, started.IsZero())
+	assert.NotNil(t, InsertEntry("testdb", "key", []byte("value")))
+
+	assert.Nil(t, AbortRotation())
+	assert.NotNil(t, ctx.Err())
+	assert.Nil(t, <-targetKept)
+	_, err = os.Stat(partial)
+	assert.True(t, os.IsNotExist(err))
+	inProgress, _, _ = RotationStatus()
+	assert.False(t, inProgress)
+	// the aborted rotation couldn't commit, and the db is usable again
+	assert.ErrorIs(t, <-committed, ErrRotationAborted)
+	assert.Nil(t, InsertEntry("testdb", "key", []byte("value")))
+
+	// committing rotations are left alone
+	_, state, err = defaultStore.beginDbRotation("testdb")
+	assert.Nil(t, err)
+	assert.Nil(t, state.commit())
+	assert.ErrorIs(t, AbortRotation(), ErrRotationCommitting)
+	defaultStore.endDbRotation(state)
+	inProgress, _, _ = RotationStatus()
+	assert.False(t, inProgress)
+}
@@ -0,0 +1,45 @@
+package cachekv
+
+import (
+	"fmt"
+)
+
+// InsertEntryEncrypted stores plaintext under key encrypted with ECIES to the
+// store's public key, on top of whatever at-rest encryption the database
+// has. shared is mixed into the encryption and has to be passed again to
+// GetEntryDecrypted; it may be nil. The stored value reads back the same
+// from any database, so it can be copied between databases, or stores, with
+// the same keypair and still be decrypted.
+func (s *Store) InsertEntryEncrypted(dbName, key string, plaintext, shared []byte) error {
+	encrypted, err := s.encryptMessage(plaintext, shared)
+	if err != nil {
+		return err
+	}
+	return s.InsertEntry(dbName, key, encrypted)
+}
+
+// InsertEntryEncrypted calls Store.InsertEntryEncrypted on the default store.
+func InsertEntryEncrypted(dbName, key string, plaintext, shared []byte) error {
+	return defaultStore.InsertEntryEncrypted(dbName, key, plaintext, shared)
+}
+
+// GetEntryDecrypted reads a value stored with InsertEntryEncrypted and
+// decrypts it with the store's private key and shared. A value that doesn't
+// decrypt, because shared differs, the keypair was replaced or the value
+// wasn't encrypted, fails with ErrDecryptionFailed.
+func (s *Store) GetEntryDecrypted(dbName, key string, shared []byte) ([]byte, error) {
+	encrypted, err := s.GetEntry(dbName, key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := s.decryptMessage(encrypted, shared)
+	if err != nil {
+		return nil, fmt.Errorf("%s - %w: %v", dbName, ErrDecryptionFailed, err)
+	}
+	return plaintext, nil
+}
+
+// GetEntryDecrypted calls Store.GetEntryDecrypted on the default store.
+func GetEntryDecrypted(dbName, key string, shared []byte) ([]byte, error) {
+	return defaultStore.GetEntryDecrypted(dbName, key, shared)
+}
@@ -0,0 +1,53 @@
+package cachekv
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertEntryEncrypted(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, CreateDatabase("otherdb", false))
+	plaintext := []byte("card number 4111 1111 1111 1111")
+	shared := []byte("customer-42")
+	assert.Nil(t, InsertEntryEncrypted("testdb", "key", plaintext, shared))
+
+	stored, err := GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(stored, plaintext))
+	value, err := GetEntryDecrypted("testdb", "key", shared)
+	assert.Nil(t, err)
+	assert.Equal(t, plaintext, value)
+
+	// the envelope travels between databases under the same keypair
+	assert.Nil(t, InsertEntry("otherdb", "copy", stored))
+	value, err = GetEntryDecrypted("otherdb", "copy", shared)
+	assert.Nil(t, err)
+	assert.Equal(t, plaintext, value)
+
+	assert.Nil(t, InsertEntryEncrypted("testdb", "noshared", plaintext, nil))
+	value, err = GetEntryDecrypted("testdb", "noshared", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, plaintext, value)
+}
+
+func TestGetEntryDecryptedWrongShared(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	assert.Nil(t, InsertEntryEncrypted("testdb", "key", []byte("secret"), []byte("right")))
+	value, err := GetEntryDecrypted("testdb", "key", []byte("wrong"))
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+	assert.Nil(t, value)
+	_, err = GetEntryDecrypted("testdb", "key", nil)
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+
+	// nor does a value that was never encrypted
+	assert.Nil(t, InsertEntry("testdb", "plain", []byte("secret")))
+	_, err = GetEntryDecrypted("testdb", "plain", nil)
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+	_, err = GetEntryDecrypted("testdb", "missing", nil)
+	assert.True(t, isEntryNotFound(err))
+}
@@ -0,0 +1,98 @@
+package cachekv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ShutdownTimeout is how long Shutdown waits for write batches still running
+// to finish. Past it they are cancelled: each flushes what it has staged and
+// returns ErrShuttingDown, so no batch is left half-committed inside a
+// transaction. Zero waits for as long as they take.
+var ShutdownTimeout = 30 * time.Second
+
+// ErrShuttingDown is returned by batch writes started while Shutdown is
+// waiting, and by those it cancelled. A cancelled batch has written part of
+// its entries; BatchInsertDetailed reports which.
+var ErrShuttingDown = errors.New("store is shutting down")
+
+// batchState tracks the write batches a Store is running, for Shutdown.
+type batchState struct {
+	mu      sync.Mutex
+	running sync.WaitGroup
+	closing bool
+	stop    chan struct{}
+}
+
+// startBatch registers a write batch with Shutdown. The returned channel is
+// closed when the batch should stop; endBatch must follow.
+func (s *Store) startBatch() (<-chan struct{}, error) {
+	s.batches.mu.Lock()
+	defer s.batches.mu.Unlock()
+	if s.batches.closing {
+		return nil, ErrShuttingDown
+	}
+	s.batches.running.Add(1)
+	return s.batches.stop, nil
+}
+
+func (s *Store) endBatch() {
+	s.batches.running.Done()
+}
+
+// stopped reports whether stop has been closed.
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// drainBatches refuses new write batches and waits for the running ones,
+// cancelling them once timeout has passed. New batches are accepted again
+// when it returns.
+func (s *Store) drainBatches(timeout time.Duration) {
+	s.batches.mu.Lock()
+	s.batches.closing = true
+	stop := s.batches.stop
+	s.batches.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.batches.running.Wait()
+		close(done)
+	}()
+	if timeout > 0 {
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			logger().Infof("write batches still running after %s, cancelling them", timeout)
+			close(stop)
+			<-done
+		}
+	} else {
+		<-done
+	}
+
+	s.batches.mu.Lock()
+	s.batches.closing = false
+	if stopped(stop) {
+		s.batches.stop = make(chan struct{})
+	}
+	s.batches.mu.Unlock()
+}
+
+// batchHalt tells a running write batch when to stop: with ErrShuttingDown
+// once Shutdown cancels it, with ctx's error once ctx is done.
+func batchHalt(ctx context.Context, stop <-chan struct{}) func() error {
+	return func() error {
+		if stopped(stop) {
+			return ErrShuttingDown
+		}
+		return ctx.Err()
+	}
+}
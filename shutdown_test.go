@@ -0,0 +1,87 @@
+package cachekv
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownWaitsForBatches(t *testing.T) {
+	defer setup()()
+	stop, err := defaultStore.startBatch()
+	assert.Nil(t, err)
+	done := make(chan error)
+	go func() {
+		done <- Shutdown()
+	}()
+	select {
+	case <-done:
+		t.Fatal("shutdown returned while a batch was running")
+	case <-time.After(200 * time.Millisecond):
+	}
+	// new batches are turned away while shutdown waits
+	_, err = defaultStore.startBatch()
+	assert.ErrorIs(t, err, ErrShuttingDown)
+	assert.False(t, stopped(stop))
+	defaultStore.endBatch()
+	assert.Nil(t, <-done)
+	Startup()
+}
+
+func TestShutdownCancelsBatchesAfterTimeout(t *testing.T) {
+	defer setup()()
+	timeout := ShutdownTimeout
+	ShutdownTimeout = 50 * time.Millisecond
+	defer func() { ShutdownTimeout = timeout }()
+	stop, err := defaultStore.startBatch()
+	assert.Nil(t, err)
+	done := make(chan error)
+	go func() {
+		done <- Shutdown()
+	}()
+	select {
+	case <-stop:
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch was not cancelled")
+	}
+	defaultStore.endBatch()
+	assert.Nil(t, <-done)
+	Startup()
+
+	// a fresh batch isn't cancelled
+	stop, err = defaultStore.startBatch()
+	assert.Nil(t, err)
+	assert.False(t, stopped(stop))
+	defaultStore.endBatch()
+}
+
+func TestCancelledBatchFlushesStaged(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", false))
+	db, dbObject, err := defaultStore.openWritableDbByName("testdb")
+	assert.Nil(t, err)
+	stop := make(chan struct{})
+	close(stop)
+	entries := make(map[string][]byte)
+	for i := range 10 {
+		entries["key"+strconv.Itoa(i)] = []byte("value")
+	}
+	result, err := batchInsertDetailedGeneric(&entries, defaultStore.writeEncoding(dbObject), 0, db, batchHalt(context.Background(), stop))
+	assert.ErrorIs(t, err, ErrShuttingDown)
+	assert.Equal(t, 0, result.Succeeded)
+	assert.Len(t, result.Failed, 10)
+	assert.Equal(t, ErrShuttingDown.Error(), result.Failed[0].Reason)
+	assert.ErrorIs(t, batchInsertGeneric(&entries, defaultStore.writeEncoding(dbObject), 0, db, batchHalt(context.Background(), stop)), ErrShuttingDown)
+	assert.Nil(t, defaultStore.releaseDb("testdb", db))
+	found, err := Exists("testdb", "key0")
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	assert.Nil(t, BatchInsert("testdb", entries))
+	found, err = Exists("testdb", "key0")
+	assert.Nil(t, err)
+	assert.True(t, found)
+}
@@ -0,0 +1,29 @@
+package cachekv
+
+import (
+	"time"
+)
+
+// observeOp logs op on dbName if it has been running longer than
+// Config.SlowOpThreshold since start. Operations defer it with their start
+// time. Durations use the real time, not clock.
+func (s *Store) observeOp(dbName string, op string, start time.Time) {
+	s.observeOpResult(dbName, op, start, nil)
+}
+
+// observeOpResult is observeOp for operations whose outcome *errp the
+// metrics count, see metrics.go; a nil errp counts as a success.
+func (s *Store) observeOpResult(dbName string, op string, start time.Time, errp *error) {
+	var err error
+	if errp != nil {
+		err = *errp
+	}
+	s.recordOpMetrics(dbName, op, time.Since(start), err)
+	config := s.config
+	if config == nil || config.SlowOpThreshold <= 0 {
+		return
+	}
+	if elapsed := time.Since(start); elapsed > config.SlowOpThreshold {
+		logger().Infof("slow operation: %s on %s took %s (threshold %s)", op, dbName, elapsed, config.SlowOpThreshold)
+	}
+}
@@ -0,0 +1,33 @@
+package cachekv
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowOpThreshold(t *testing.T) {
+	defer setup()()
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	assert.Nil(t, InsertEntry(testDb, "key", []byte("value")))
+	assert.NotContains(t, logged.String(), "slow operation")
+
+	cfg, err := ListConfigurations()
+	assert.Nil(t, err)
+	cfg.SlowOpThreshold = time.Nanosecond
+	assert.Nil(t, UpdateConfigurations(cfg))
+	// so that GetEntry has to open it again
+	assert.Nil(t, CloseDatabaseByName(testDb))
+	_, err = GetEntry(testDb, "key")
+	assert.Nil(t, err)
+	assert.Contains(t, logged.String(), "slow operation: open on testdb took")
+	assert.Contains(t, logged.String(), "slow operation: GetEntry on testdb took")
+}
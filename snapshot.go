@@ -0,0 +1,114 @@
+package cachekv
+
+import (
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// MultiSnapshot reads several databases as of one moment. badger instances
+// don't share a clock, so this is an approximation: every database is opened
+// first and only then are the read transactions started back to back, which
+// keeps the window between the first and the last as small as possible.
+// Writes made after NewMultiSnapshot returns aren't visible through it. The
+// databases stay open until Close.
+type MultiSnapshot struct {
+	dbs   map[string]*badger.DB
+	txns  map[string]*badger.Txn
+	store *Store
+}
+
+// NewMultiSnapshot opens dbNames and captures a read transaction on each.
+func (s *Store) NewMultiSnapshot(dbNames []string) (*MultiSnapshot, error) {
+	snapshot := &MultiSnapshot{
+		store: s,
+		dbs:   make(map[string]*badger.DB, len(dbNames)),
+		txns:  make(map[string]*badger.Txn, len(dbNames)),
+	}
+	for _, dbName := range dbNames {
+		if _, ok := snapshot.dbs[dbName]; ok {
+			snapshot.Close()
+			return nil, errors.New("database listed twice: " + dbName)
+		}
+		db, _, err := s.openDbByName(dbName)
+		if err != nil {
+			snapshot.Close()
+			return nil, err
+		}
+		snapshot.dbs[dbName] = db
+	}
+	for dbName, db := range snapshot.dbs {
+		snapshot.txns[dbName] = db.NewTransaction(false)
+	}
+	return snapshot, nil
+}
+
+// NewMultiSnapshot calls Store.NewMultiSnapshot on the default store.
+func NewMultiSnapshot(dbNames []string) (*MultiSnapshot, error) {
+	return defaultStore.NewMultiSnapshot(dbNames)
+}
+
+func (s *MultiSnapshot) txn(dbName string) (*badger.Txn, error) {
+	txn, ok := s.txns[dbName]
+	if !ok {
+		return nil, errors.New("database not in snapshot: " + dbName)
+	}
+	return txn, nil
+}
+
+// Get returns the value key had in dbName when the snapshot was taken.
+func (s *MultiSnapshot) Get(dbName string, key string) ([]byte, error) {
+	txn, err := s.txn(dbName)
+	if err != nil {
+		return nil, err
+	}
+	item, err := txn.Get([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	return itemValue(item)
+}
+
+// Scan returns the entries of dbName under prefix as of the snapshot, in key
+// order.
+func (s *MultiSnapshot) Scan(dbName string, prefix string) ([]KV, error) {
+	txn, err := s.txn(dbName)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]KV, 0)
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = []byte(prefix)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		if isReservedKey(item.Key()) {
+			continue
+		}
+		value, err := itemValue(item)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, KV{Key: item.KeyCopy(nil), Value: value})
+	}
+	return result, nil
+}
+
+// Close ends the read transactions and closes the databases. It is safe to
+// call more than once.
+func (s *MultiSnapshot) Close() error {
+	for _, txn := range s.txns {
+		txn.Discard()
+	}
+	s.txns = make(map[string]*badger.Txn)
+	var errs []error
+	for dbName, db := range s.dbs {
+		if err := s.store.releaseDb(dbName, db); err != nil {
+			logger().Errorf("Error closing database: %v", err)
+			errs = append(errs, err)
+		}
+	}
+	s.dbs = make(map[string]*badger.DB)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,46 @@
+package cachekv
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiSnapshot(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("orders", true))
+	assert.Nil(t, CreateDatabase("stock", false))
+	assert.Nil(t, InsertEntry("orders", "order:1", []byte("widget")))
+	assert.Nil(t, InsertEntry("stock", "widget", []byte("9")))
+
+	snapshot, err := NewMultiSnapshot([]string{"orders", "stock"})
+	assert.Nil(t, err)
+	// the databases are held by the snapshot; write through its handles
+	assert.Nil(t, setDbEntry([]byte("order:2"), []byte("widget"), snapshot.dbs["orders"]))
+	assert.Nil(t, setDbEntry([]byte("widget"), []byte("8"), snapshot.dbs["stock"]))
+
+	value, err := snapshot.Get("stock", "widget")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("9"), value)
+	_, err = snapshot.Get("orders", "order:2")
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+	orders, err := snapshot.Scan("orders", "order:")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(orders))
+	_, err = snapshot.Get("missing", "key")
+	assert.NotNil(t, err)
+	assert.Nil(t, snapshot.Close())
+	assert.Nil(t, snapshot.Close())
+
+	value, err = GetEntry("stock", "widget")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("8"), value)
+
+	_, err = NewMultiSnapshot([]string{"orders", "orders"})
+	assert.NotNil(t, err)
+	_, err = NewMultiSnapshot([]string{"orders", "missing"})
+	assert.NotNil(t, err)
+	// a failed snapshot leaves nothing open
+	assert.Nil(t, InsertEntry("orders", "order:3", []byte("widget")))
+}
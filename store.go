@@ -0,0 +1,175 @@
+package cachekv
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store is one cachekv store: a meta db, a key db and the databases they
+// register, under one store path, with its own keypair under one key path.
+// Stores don't share any state, so a process can run several side by side,
+// as long as they don't share a store path; a keypair kept in the OS keyring,
+// see KeypairInKeyring, is kept per store path too.
+//
+// The package-level functions work on a default Store, which follows the
+// package-level StorePath and KeyPath.
+type Store struct {
+	meta   Storage
+	key    Storage
+	config *Config
+
+	// storePath and keyPath are where the store lives; empty follows the
+	// package-level StorePath and KeyPath.
+	storePath string
+	keyPath   string
+
+	openOptions OpenOptions
+	// inMemory keeps the databases' data in memory only, see WithInMemory.
+	inMemory bool
+
+	// startupMu guards started, which Startup sets once the key and meta dbs
+	// are loaded and Shutdown and SecureErase clear.
+	startupMu sync.Mutex
+	started   bool
+
+	// keypairMu keeps readers of the keypair, key derivation included, from
+	// seeing it halfway through being replaced.
+	keypairMu sync.RWMutex
+
+	// masterKey, when set, is what new secure databases derive their keys
+	// from instead of getting a random one stored in the keyring, see
+	// SetMasterKey.
+	masterKey []byte
+
+	eventsMu      sync.Mutex
+	eventOptions  EventBufferOptions
+	eventBuffer   map[string][]byte
+	eventBuffered time.Time
+	eventSeq      atomic.Uint64
+
+	handlesMu sync.Mutex
+	handles   map[string]*dbHandle
+	// metaHandle and keyHandle share the meta db and the key db like
+	// handles does the databases, see openMeta.
+	metaHandle dbHandle
+	keyHandle  dbHandle
+	openSlots  openSlotState
+
+	loadersMu sync.RWMutex
+	loaders   map[string]loader
+	loads     *flightGroup
+
+	rotationMu sync.Mutex
+	rotations  map[string]*rotationState
+
+	// ensureMu keeps concurrent first uses of an internal database from both
+	// creating it, see ensureDatabase.
+	ensureMu sync.Mutex
+
+	batches         batchState
+	integrityChecks integrityCheckState
+
+	// metrics is nil until RegisterMetrics.
+	metrics atomic.Pointer[storeMetrics]
+}
+
+// Option configures a Store made by NewStore.
+type Option func(s *Store)
+
+// WithStorePath has the store keep its meta db, key db and databases in dir,
+// instead of StorePath.
+func WithStorePath(dir string) Option {
+	return func(s *Store) {
+		s.storePath = dir
+	}
+}
+
+// WithKeyPath has the store keep its keypair in dir, instead of KeyPath.
+func WithKeyPath(dir string) Option {
+	return func(s *Store) {
+		s.keyPath = dir
+	}
+}
+
+// WithOpenOptions has the store open its badger databases with opts, see
+// SetOpenOptions.
+func WithOpenOptions(opts OpenOptions) Option {
+	return func(s *Store) {
+		s.openOptions = opts
+	}
+}
+
+// WithInMemory has the store keep its databases' data in memory only, as
+// the fast tier of a TieredStore. The meta db, key db and keypair stay on
+// disk, so the databases stay registered, but their data lives in the
+// shared handle: whatever closes it, CloseDatabaseByName, key rotation,
+// MaxConcurrentOpens or Shutdown, leaves the database empty.
+func WithInMemory() Option {
+	return func(s *Store) {
+		s.inMemory = true
+	}
+}
+
+// defaultStore is what the package-level functions work on.
+var defaultStore = newStore()
+
+func newStore() *Store {
+	s := &Store{
+		openOptions: DefaultOpenOptions(),
+		eventBuffer: make(map[string][]byte),
+		handles:     make(map[string]*dbHandle),
+		loaders:     make(map[string]loader),
+		loads:       &flightGroup{calls: make(map[string]*flightCall)},
+		rotations:   make(map[string]*rotationState),
+	}
+	s.meta.store = s
+	s.key.store = s
+	s.metaHandle = dbHandle{store: s, name: "meta db", internal: true}
+	s.keyHandle = dbHandle{store: s, name: "key db", internal: true}
+	s.openSlots.freed = make(chan struct{})
+	s.batches.stop = make(chan struct{})
+	return s
+}
+
+// NewStore loads the store at StorePath and KeyPath, or where opts say,
+// creating it if there's none, and returns it started. Use one Store per
+// store path: two would fight over badger's directory locks.
+func NewStore(opts ...Option) (*Store, error) {
+	s := newStore()
+	s.storePath, s.keyPath = StorePath, KeyPath
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.storePath == "" || s.keyPath == "" {
+		return nil, errors.New("store path and key path must not be empty")
+	}
+	if err := s.Startup(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// storeDir is where s keeps its meta db, key db and databases.
+func (s *Store) storeDir() string {
+	if s.storePath == "" {
+		return StorePath
+	}
+	return s.storePath
+}
+
+// keyDir is where s keeps its keypair.
+func (s *Store) keyDir() string {
+	if s.keyPath == "" {
+		return KeyPath
+	}
+	return s.keyPath
+}
+
+// isStarted reports whether s is loaded, between Startup and Shutdown.
+func (s *Store) isStarted() bool {
+	s.startupMu.Lock()
+	defer s.startupMu.Unlock()
+	return s.started
+}
@@ -0,0 +1,59 @@
+package cachekv
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoresAreIsolated(t *testing.T) {
+	defer setup()()
+	dirs := []string{"./test-store-a/", "./test-store-b/", "./.test-private-a/", "./.test-private-b/"}
+	defer func() {
+		for _, dir := range dirs {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+	a, err := NewStore(WithStorePath(dirs[0]), WithKeyPath(dirs[2]))
+	assert.Nil(t, err)
+	b, err := NewStore(WithStorePath(dirs[1]), WithKeyPath(dirs[3]))
+	assert.Nil(t, err)
+
+	assert.Nil(t, a.CreateDatabase("testdb", true))
+	assert.Nil(t, b.CreateDatabase("testdb", false))
+	assert.Nil(t, a.CreateDatabase("only-a", true))
+	assert.Nil(t, a.InsertEntry("testdb", "key", []byte("a")))
+	assert.Nil(t, b.InsertEntry("testdb", "key", []byte("b")))
+
+	value, err := a.GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), value)
+	value, err = b.GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), value)
+
+	dbs, err := a.ListDatabases()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{prefixMetaDb + "testdb", prefixMetaDb + "only-a"}, dbs)
+	dbs, err = b.ListDatabases()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{prefixMetaDb + "testdb"}, dbs)
+	_, err = b.GetEntry("only-a", "key")
+	assert.NotNil(t, err)
+
+	// the default store knows about neither
+	dbs, err = ListDatabases()
+	assert.Nil(t, err)
+	assert.Empty(t, dbs)
+
+	// a store loaded again from its path gets its own data back
+	assert.Nil(t, a.Shutdown())
+	assert.Nil(t, b.Shutdown())
+	a, err = NewStore(WithStorePath(dirs[0]), WithKeyPath(dirs[2]))
+	assert.Nil(t, err)
+	value, err = a.GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), value)
+	assert.Nil(t, a.Shutdown())
+}
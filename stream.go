@@ -0,0 +1,87 @@
+package cachekv
+
+import (
+	"context"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"github.com/dgraph-io/ristretto/v2/z"
+	"google.golang.org/protobuf/proto"
+)
+
+const streamBuffer = 1024
+
+// Stream sends every key/value pair of dbName over the returned channel. Both
+// channels are closed once the stream is done; at most one error is sent.
+// Callers must drain the KV channel, otherwise the stream blocks and the
+// database stays open.
+func (s *Store) Stream(dbName string) (<-chan KV, <-chan error) {
+	return s.StreamFiltered(dbName, nil)
+}
+
+// Stream calls Store.Stream on the default store.
+func Stream(dbName string) (<-chan KV, <-chan error) {
+	return defaultStore.Stream(dbName)
+}
+
+// StreamFiltered is Stream with choose evaluated inside badger's stream
+// workers, so keys it rejects are never read or sent. A nil choose accepts
+// every key.
+func (s *Store) StreamFiltered(dbName string, choose func(key []byte) bool) (<-chan KV, <-chan error) {
+	out := make(chan KV, streamBuffer)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(out)
+		defer close(errs)
+		db, _, err := s.openDbByName(dbName)
+		if err != nil {
+			errs <- err
+			return
+		}
+		err = streamTo(db, choose, out)
+		closeErr := s.releaseDb(dbName, db)
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			errs <- err
+		}
+	}()
+	return out, errs
+}
+
+// StreamFiltered calls Store.StreamFiltered on the default store.
+func StreamFiltered(dbName string, choose func(key []byte) bool) (<-chan KV, <-chan error) {
+	return defaultStore.StreamFiltered(dbName, choose)
+}
+
+func streamTo(db *badger.DB, choose func(key []byte) bool, out chan<- KV) error {
+	stream := db.NewStream()
+	stream.NumGo = 20
+	stream.LogPrefix = "stream -> "
+	stream.ChooseKey = func(item *badger.Item) bool {
+		if isReservedKey(item.Key()) {
+			return false
+		}
+		return choose == nil || choose(item.Key())
+	}
+	stream.Send = func(buffer *z.Buffer) error {
+		return buffer.SliceIterate(func(slice []byte) error {
+			kv := new(pb.KV)
+			if err := proto.Unmarshal(slice, kv); err != nil {
+				return err
+			}
+			var userMeta byte
+			if len(kv.UserMeta) > 0 {
+				userMeta = kv.UserMeta[0]
+			}
+			value, err := decodeValue(kv.Value, userMeta)
+			if err != nil {
+				return err
+			}
+			out <- KV{Key: kv.Key, Value: value}
+			return nil
+		})
+	}
+	return stream.Orchestrate(context.Background())
+}
@@ -0,0 +1,52 @@
+package cachekv
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamFiltered(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	entries := make(map[string][]byte)
+	for i := 0; i < 500; i++ {
+		entries["keep:"+strconv.Itoa(i)] = []byte("value" + strconv.Itoa(i))
+		entries["skip:"+strconv.Itoa(i)] = []byte("value" + strconv.Itoa(i))
+	}
+	assert.Nil(t, BatchInsert(testDb, entries))
+
+	kvs, errs := StreamFiltered(testDb, func(key []byte) bool {
+		return bytes.HasPrefix(key, []byte("keep:"))
+	})
+	seen := make(map[string][]byte)
+	for kv := range kvs {
+		seen[string(kv.Key)] = kv.Value
+	}
+	assert.Nil(t, <-errs)
+	assert.Equal(t, 500, len(seen))
+	for k, v := range seen {
+		assert.True(t, bytes.HasPrefix([]byte(k), []byte("keep:")))
+		assert.Equal(t, entries[k], v)
+	}
+
+	kvs, errs = Stream(testDb)
+	count := 0
+	for range kvs {
+		count++
+	}
+	assert.Nil(t, <-errs)
+	assert.Equal(t, len(entries), count)
+}
+
+func TestStreamMissingDatabase(t *testing.T) {
+	defer setup()()
+	kvs, errs := Stream("nosuchdb")
+	for range kvs {
+		t.Fatal("no entries expected")
+	}
+	assert.NotNil(t, <-errs)
+}
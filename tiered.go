@@ -0,0 +1,255 @@
+package cachekv
+
+import (
+	"errors"
+	"sync"
+)
+
+// tieredQueueSize is how many writes a TieredStore queues for the durable
+// store before writers wait for it to catch up.
+const tieredQueueSize = 1024
+
+// TieredStore serves a database from a fast store, made with WithInMemory,
+// and writes it through to a durable store in the background. Writes return
+// once the fast store has them and reach the durable store in the order they
+// were made; reads that miss the fast store fall back to the durable one and
+// copy what they find into the fast store for next time.
+//
+// The durable store lags behind by whatever is queued, up to
+// tieredQueueSize writes: a crash loses those, and a durable write that fails
+// is only reported by the next Flush. Call Flush to wait for the durable
+// store to catch up, e.g. before a checkpoint, and Close before shutting
+// either store down. Writes made to either store directly aren't ordered with
+// the TieredStore's, so make them through it until it is closed.
+type TieredStore struct {
+	fast    *Store
+	durable *Store
+	writes  chan tieredWrite
+	done    chan struct{}
+
+	// mu guards the fields below. queued counts the writes not yet applied
+	// to the durable store, per key in pending; drained is signalled as it
+	// drops. seq counts writes, so a read can tell one ran since it started.
+	mu      sync.Mutex
+	drained *sync.Cond
+	queued  int
+	pending map[tieredKey]int
+	seq     uint64
+	errs    []error
+	known   map[string]bool
+	closed  bool
+
+	// orderMu makes applying a write to the fast store and queueing it one
+	// step, so the queue has the writes in the order the fast store got them.
+	orderMu sync.Mutex
+
+	// createMu keeps concurrent first uses from both creating a database in
+	// the fast store.
+	createMu sync.Mutex
+}
+
+type tieredKey struct {
+	dbName string
+	key    string
+}
+
+type tieredWrite struct {
+	tieredKey
+	value  []byte
+	update bool
+	remove bool
+}
+
+// NewTieredStore pairs fast, which should be made with WithInMemory, with
+// durable. Both have to be started; they stay owned by the caller.
+func NewTieredStore(fast, durable *Store) *TieredStore {
+	ts := &TieredStore{
+		fast:    fast,
+		durable: durable,
+		writes:  make(chan tieredWrite, tieredQueueSize),
+		done:    make(chan struct{}),
+		pending: make(map[tieredKey]int),
+		known:   make(map[string]bool),
+	}
+	ts.drained = sync.NewCond(&ts.mu)
+	go ts.writeThrough()
+	return ts
+}
+
+// CreateDatabase creates dbName in both stores.
+func (ts *TieredStore) CreateDatabase(dbName string, secure bool) error {
+	if err := ts.durable.CreateDatabase(dbName, secure); err != nil {
+		return err
+	}
+	return ts.ensureFast(dbName)
+}
+
+// InsertEntry stores value under key in the fast store and queues it for the
+// durable one.
+func (ts *TieredStore) InsertEntry(dbName string, key string, value []byte) error {
+	return ts.write(tieredWrite{tieredKey: tieredKey{dbName, key}, value: value})
+}
+
+// UpdateEntry is InsertEntry recorded as an update in both stores' event logs.
+func (ts *TieredStore) UpdateEntry(dbName string, key string, value []byte) error {
+	return ts.write(tieredWrite{tieredKey: tieredKey{dbName, key}, value: value, update: true})
+}
+
+// RemoveEntry removes key from the fast store and queues its removal from
+// the durable one.
+func (ts *TieredStore) RemoveEntry(dbName string, key string) error {
+	return ts.write(tieredWrite{tieredKey: tieredKey{dbName, key}, remove: true})
+}
+
+// GetEntry returns the value stored under key, from the fast store if it has
+// it and from the durable store otherwise. A key with writes still queued is
+// only looked up in the fast store, which has the latest of them.
+func (ts *TieredStore) GetEntry(dbName string, key string) ([]byte, error) {
+	if err := ts.ensureFast(dbName); err != nil {
+		return nil, err
+	}
+	value, err := ts.fast.GetEntry(dbName, key)
+	if !isEntryNotFound(err) {
+		return value, err
+	}
+	ts.mu.Lock()
+	queued := ts.pending[tieredKey{dbName, key}] > 0
+	seq := ts.seq
+	ts.mu.Unlock()
+	if queued {
+		return nil, err
+	}
+	value, err = ts.durable.GetEntry(dbName, key)
+	if err != nil {
+		return nil, err
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	// a write since the durable read may have made value stale
+	if ts.seq == seq {
+		if e := ts.fast.InsertEntry(dbName, key, value); e != nil {
+			logger().Errorf("error copying %s into the fast tier: %v", key, e)
+		}
+	}
+	return value, nil
+}
+
+// Flush waits until every write made so far has reached the durable store and
+// returns the durable writes that failed since the last Flush.
+func (ts *TieredStore) Flush() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for ts.queued > 0 {
+		ts.drained.Wait()
+	}
+	err := errors.Join(ts.errs...)
+	ts.errs = nil
+	return err
+}
+
+// Close flushes the queued writes and stops writing through; the stores
+// themselves stay open. Writes after Close fail.
+func (ts *TieredStore) Close() error {
+	ts.mu.Lock()
+	if ts.closed {
+		ts.mu.Unlock()
+		return nil
+	}
+	ts.closed = true
+	ts.mu.Unlock()
+	err := ts.Flush()
+	close(ts.writes)
+	<-ts.done
+	return err
+}
+
+func (ts *TieredStore) write(w tieredWrite) error {
+	if err := ts.ensureFast(w.dbName); err != nil {
+		return err
+	}
+	ts.mu.Lock()
+	if ts.closed {
+		ts.mu.Unlock()
+		return errors.New("tiered store is closed")
+	}
+	// counted before the fast write, so a concurrent read can't copy an
+	// older durable value over it
+	ts.seq++
+	ts.pending[w.tieredKey]++
+	ts.queued++
+	ts.mu.Unlock()
+	ts.orderMu.Lock()
+	defer ts.orderMu.Unlock()
+	if err := w.apply(ts.fast); err != nil {
+		ts.applied(w.tieredKey, nil)
+		return err
+	}
+	// a full queue holds the writers up here until writeThrough makes room
+	ts.writes <- w
+	return nil
+}
+
+// writeThrough applies the queued writes to the durable store, in order.
+func (ts *TieredStore) writeThrough() {
+	defer close(ts.done)
+	for w := range ts.writes {
+		err := w.apply(ts.durable)
+		if err != nil {
+			logger().Errorf("error writing %s through to the durable tier: %v", w.key, err)
+		}
+		ts.applied(w.tieredKey, err)
+	}
+}
+
+func (w tieredWrite) apply(s *Store) error {
+	switch {
+	case w.remove:
+		return s.RemoveEntry(w.dbName, w.key)
+	case w.update:
+		return s.UpdateEntry(w.dbName, w.key, w.value)
+	}
+	return s.InsertEntry(w.dbName, w.key, w.value)
+}
+
+// applied marks a queued write as done, recording err if it failed.
+func (ts *TieredStore) applied(k tieredKey, err error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if err != nil {
+		ts.errs = append(ts.errs, err)
+	}
+	ts.pending[k]--
+	if ts.pending[k] == 0 {
+		delete(ts.pending, k)
+	}
+	ts.queued--
+	ts.drained.Broadcast()
+}
+
+// ensureFast creates dbName in the fast store the first time it is used, as
+// secure as it is in the durable store, which has to have it.
+func (ts *TieredStore) ensureFast(dbName string) error {
+	ts.mu.Lock()
+	known := ts.known[dbName]
+	ts.mu.Unlock()
+	if known {
+		return nil
+	}
+	ts.createMu.Lock()
+	defer ts.createMu.Unlock()
+	dbObject, err := ts.durable.getMetaDbObject(dbName)
+	if err != nil {
+		return err
+	}
+	exist, err := ts.fast.databaseExist(dbName)
+	if err == nil && !exist {
+		err = ts.fast.CreateDatabase(dbName, dbObject.Secure)
+	}
+	if err != nil {
+		return err
+	}
+	ts.mu.Lock()
+	ts.known[dbName] = true
+	ts.mu.Unlock()
+	return nil
+}
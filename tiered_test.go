@@ -0,0 +1,170 @@
+package cachekv
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTieredTestStores(t *testing.T) (fast, durable *Store, cleanup func()) {
+	dirs := []string{"./test-store-fast/", "./test-store-durable/", "./.test-private-fast/", "./.test-private-durable/"}
+	fast, err := NewStore(WithStorePath(dirs[0]), WithKeyPath(dirs[2]), WithInMemory())
+	assert.Nil(t, err)
+	durable, err = NewStore(WithStorePath(dirs[1]), WithKeyPath(dirs[3]))
+	assert.Nil(t, err)
+	return fast, durable, func() {
+		_ = fast.Shutdown()
+		_ = durable.Shutdown()
+		for _, dir := range dirs {
+			_ = os.RemoveAll(dir)
+		}
+	}
+}
+
+func TestTieredStore(t *testing.T) {
+	defer setup()()
+	fast, durable, cleanup := newTieredTestStores(t)
+	defer cleanup()
+	ts := NewTieredStore(fast, durable)
+	defer ts.Close()
+	assert.Nil(t, ts.CreateDatabase("testdb", true))
+
+	assert.Nil(t, ts.InsertEntry("testdb", "key", []byte("value")))
+	assert.Nil(t, ts.UpdateEntry("testdb", "updated", []byte("value")))
+	value, err := fast.GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.Nil(t, ts.Flush())
+	value, err = durable.GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	value, err = durable.GetEntry("testdb", "updated")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	// the fast tier loses its data when its handle closes, the durable one
+	// serves it back
+	assert.Nil(t, fast.CloseDatabaseByName("testdb"))
+	_, err = fast.GetEntry("testdb", "key")
+	assert.True(t, isEntryNotFound(err))
+	value, err = ts.GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	value, err = fast.GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	assert.Nil(t, ts.RemoveEntry("testdb", "key"))
+	_, err = ts.GetEntry("testdb", "key")
+	assert.True(t, isEntryNotFound(err))
+	assert.Nil(t, ts.Flush())
+	_, err = durable.GetEntry("testdb", "key")
+	assert.True(t, isEntryNotFound(err))
+
+	// databases only the durable store has are created in the fast one
+	assert.Nil(t, durable.CreateDatabase("existing", false))
+	assert.Nil(t, durable.InsertEntry("existing", "key", []byte("durable")))
+	value, err = ts.GetEntry("existing", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("durable"), value)
+	dbObject, err := fast.getMetaDbObject("existing")
+	assert.Nil(t, err)
+	assert.False(t, dbObject.Secure)
+	_, err = ts.GetEntry("missing", "key")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, ts.Close())
+	assert.NotNil(t, ts.InsertEntry("testdb", "key", []byte("value")))
+}
+
+func TestTieredStoreConcurrentWrites(t *testing.T) {
+	defer setup()()
+	fast, durable, cleanup := newTieredTestStores(t)
+	defer cleanup()
+	ts := NewTieredStore(fast, durable)
+	assert.Nil(t, ts.CreateDatabase("testdb", false))
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				assert.Nil(t, ts.InsertEntry("testdb", fmt.Sprintf("key-%d-%d", w, i), []byte("value")))
+			}
+		}(w)
+	}
+	wg.Wait()
+	// writes to one key reach the durable store in order
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, ts.InsertEntry("testdb", "last", []byte(fmt.Sprint(i))))
+	}
+	assert.Nil(t, ts.Close())
+	count, err := durable.CountEntries("testdb", "key-")
+	assert.Nil(t, err)
+	assert.Equal(t, 40, count)
+	value, err := durable.GetEntry("testdb", "last")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("9"), value)
+}
+
+func TestTieredStoreConcurrentWritesToOneKey(t *testing.T) {
+	defer setup()()
+	fast, durable, cleanup := newTieredTestStores(t)
+	defer cleanup()
+	ts := NewTieredStore(fast, durable)
+	assert.Nil(t, ts.CreateDatabase("testdb", false))
+
+	// the durable store ends up with whichever write the fast store got last
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				assert.Nil(t, ts.InsertEntry("testdb", "key", []byte(fmt.Sprintf("%d-%d", w, i))))
+			}
+		}(w)
+	}
+	wg.Wait()
+	assert.Nil(t, ts.Close())
+	expected, err := fast.GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	value, err := durable.GetEntry("testdb", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, value)
+}
+
+func BenchmarkTieredStoreInsertEntry(b *testing.B) {
+	defer setup()()
+	dirs := []string{"./test-store-fast/", "./test-store-durable/", "./.test-private-fast/", "./.test-private-durable/"}
+	defer func() {
+		for _, dir := range dirs {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+	fast, err := NewStore(WithStorePath(dirs[0]), WithKeyPath(dirs[2]), WithInMemory())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer fast.Shutdown()
+	durable, err := NewStore(WithStorePath(dirs[1]), WithKeyPath(dirs[3]))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer durable.Shutdown()
+	ts := NewTieredStore(fast, durable)
+	defer ts.Close()
+	if err = ts.CreateDatabase("testdb", false); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err = ts.InsertEntry("testdb", "key", []byte("value")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
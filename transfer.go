@@ -0,0 +1,233 @@
+package cachekv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxTransferFrame bounds the size of one frame ReceiveDatabase accepts, so a
+// corrupt length can't make it allocate without limit.
+const maxTransferFrame = 1 << 30
+
+// ErrTransferIncomplete is wrapped by the TransferError ReceiveDatabase
+// returns when the stream ends, or fails, before the sender's end marker.
+var ErrTransferIncomplete = errors.New("database transfer incomplete")
+
+// TransferError reports a transfer that stopped part way. Every key up to
+// and including LastKey has been written; SendDatabaseAfter with LastKey
+// sends the rest.
+type TransferError struct {
+	DbName  string
+	LastKey string
+	Err     error
+}
+
+func (e *TransferError) Error() string {
+	return fmt.Sprintf("%s - transfer stopped after key %q: %v", e.DbName, e.LastKey, e.Err)
+}
+
+func (e *TransferError) Unwrap() []error {
+	return []error{ErrTransferIncomplete, e.Err}
+}
+
+// SendDatabase writes every entry of dbName to conn, in key order, for
+// ReceiveDatabase on the other end. Each entry is a pb.KV message carrying
+// the key, the decoded value and the expiry, preceded by its length as a
+// uvarint; a zero length ends the transfer. Values are sent decrypted, so
+// conn should be a secure channel for a secure database.
+func (s *Store) SendDatabase(dbName string, conn io.Writer) error {
+	return s.SendDatabaseAfter(dbName, "", conn)
+}
+
+// SendDatabase calls Store.SendDatabase on the default store.
+func SendDatabase(dbName string, conn io.Writer) error {
+	return defaultStore.SendDatabase(dbName, conn)
+}
+
+// SendDatabaseAfter is SendDatabase sending only the keys after after, to
+// resume a transfer that failed with a TransferError.
+func (s *Store) SendDatabaseAfter(dbName string, after string, conn io.Writer) error {
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(conn)
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		it.Seek([]byte(after))
+		if after != "" && it.Valid() && string(it.Item().Key()) == after {
+			it.Next()
+		}
+		for ; it.Valid(); it.Next() {
+			item := it.Item()
+			value, e := itemValue(item)
+			if e != nil {
+				return e
+			}
+			kv := &pb.KV{Key: item.KeyCopy(nil), Value: value, ExpiresAt: item.ExpiresAt()}
+			if e = writeTransferFrame(w, kv); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return err
+	}
+	if err = writeTransferFrame(w, nil); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// SendDatabaseAfter calls Store.SendDatabaseAfter on the default store.
+func SendDatabaseAfter(dbName string, after string, conn io.Writer) error {
+	return defaultStore.SendDatabaseAfter(dbName, after, conn)
+}
+
+// writeTransferFrame writes kv as one frame, or the end marker for nil.
+func writeTransferFrame(w *bufio.Writer, kv *pb.KV) error {
+	var data []byte
+	if kv != nil {
+		var err error
+		if data, err = proto.Marshal(kv); err != nil {
+			return err
+		}
+	}
+	var length [binary.MaxVarintLen64]byte
+	if _, err := w.Write(length[:binary.PutUvarint(length[:], uint64(len(data)))]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// ReceiveDatabase reads a transfer written by SendDatabase from conn into
+// dbName, which is created, secure or not as asked, if it isn't registered
+// yet; an existing database keeps its settings and gets the entries added,
+// overwriting keys it already holds. Entries keep the expiry they were sent
+// with; those sent without one get the database's DefaultTTL, and a value
+// over its MaxValueSize stops the transfer. If conn ends or fails before the
+// end marker, what arrived is written and a TransferError says where to
+// resume.
+func (s *Store) ReceiveDatabase(dbName string, conn io.Reader, secure bool) error {
+	exist, err := s.databaseExist(dbName)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		if err = s.CreateDatabase(dbName, secure); err != nil {
+			return err
+		}
+	}
+	db, dbObject, err := s.openWritableDbByName(dbName)
+	if err != nil {
+		return err
+	}
+	lastKey, err := receiveEntries(db, dbName, dbObject, s.writeEncoding(dbObject), bufio.NewReader(conn))
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return &TransferError{DbName: dbName, LastKey: lastKey, Err: err}
+	}
+	if err = closeErr; err == nil {
+		_ = s.writeDbEvent(EventTypeWrite, dbName, "Received transfer into db: "+dbName)
+	}
+	return err
+}
+
+// ReceiveDatabase calls Store.ReceiveDatabase on the default store.
+func ReceiveDatabase(dbName string, conn io.Reader, secure bool) error {
+	return defaultStore.ReceiveDatabase(dbName, conn, secure)
+}
+
+// receiveEntries writes the frames read from r to db, dbName's database,
+// until the end marker, returning the last key written. Nothing is known to
+// be written if flushing fails, and the last key returned is then empty.
+func receiveEntries(db *badger.DB, dbName string, dbObject *DbObject, encoding valueEncoding, r *bufio.Reader) (string, error) {
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+	staged := ""
+	for {
+		kv, err := readTransferFrame(r)
+		if err == nil && kv == nil {
+			if err = wb.Flush(); err != nil {
+				return "", err
+			}
+			return staged, nil
+		}
+		if err == nil {
+			err = checkValueSize(dbName, dbObject.MaxValueSize, kv.Value)
+			if err == nil {
+				err = stageTransferred(wb, kv, encoding, dbObject.DefaultTTL)
+			}
+			if err == nil {
+				staged = string(kv.Key)
+				continue
+			}
+		}
+		// keep what arrived
+		if flushErr := wb.Flush(); flushErr != nil {
+			return "", errors.Join(err, flushErr)
+		}
+		return staged, err
+	}
+}
+
+// readTransferFrame reads one frame written by writeTransferFrame, nil for
+// the end marker. A stream ending anywhere is io.ErrUnexpectedEOF, since a
+// complete transfer ends with the marker.
+func readTransferFrame(r *bufio.Reader) (*pb.KV, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	if length > maxTransferFrame {
+		return nil, fmt.Errorf("transfer frame of %d bytes is too large", length)
+	}
+	data := make([]byte, length)
+	if _, err = io.ReadFull(r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	kv := new(pb.KV)
+	if err = proto.Unmarshal(data, kv); err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
+// stageTransferred adds one received entry to wb, encoded for this end. An
+// entry sent without an expiry gets defaultTTL, if set. Reserved keys are
+// taken as sent, so entry metadata comes along.
+func stageTransferred(wb *badger.WriteBatch, kv *pb.KV, encoding valueEncoding, defaultTTL time.Duration) error {
+	entry, err := encodedEntry(kv.Key, kv.Value, encoding)
+	if err != nil {
+		return err
+	}
+	entry.ExpiresAt = kv.ExpiresAt
+	if entry.ExpiresAt == 0 && defaultTTL > 0 {
+		entry = entry.WithTTL(defaultTTL)
+	}
+	return wb.SetEntry(entry)
+}
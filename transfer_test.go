@@ -0,0 +1,75 @@
+package cachekv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func dbContents(t *testing.T, dbName string) map[string][]byte {
+	contents := make(map[string][]byte)
+	assert.Nil(t, ScanPrefix(dbName, "", func(key string, value []byte) error {
+		contents[key] = value
+		return nil
+	}))
+	return contents
+}
+
+func TestSendReceiveDatabase(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("source", true))
+	entries := make(map[string][]byte)
+	for i := range 100 {
+		entries["key"+strconv.Itoa(i)] = []byte("value" + strconv.Itoa(i))
+	}
+	assert.Nil(t, BatchInsert("source", entries))
+
+	var buf bytes.Buffer
+	assert.Nil(t, SendDatabase("source", &buf))
+	assert.Nil(t, ReceiveDatabase("target", &buf, false))
+	assert.Equal(t, entries, dbContents(t, "target"))
+	db, err := defaultStore.getMetaDbObject("target")
+	assert.Nil(t, err)
+	assert.False(t, db.Secure)
+}
+
+func TestReceiveDatabaseCorrupt(t *testing.T) {
+	defer setup()()
+	err := ReceiveDatabase("target", bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}), false)
+	assert.ErrorIs(t, err, ErrTransferIncomplete)
+}
+
+func TestReceiveDatabaseResume(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("source", true))
+	entries := make(map[string][]byte)
+	for i := range 100 {
+		entries["key"+strconv.Itoa(i)] = bytes.Repeat([]byte{byte(i)}, 100)
+	}
+	assert.Nil(t, BatchInsert("source", entries))
+	var buf bytes.Buffer
+	assert.Nil(t, SendDatabase("source", &buf))
+
+	// the connection drops half way
+	err := ReceiveDatabase("target", io.LimitReader(&buf, int64(buf.Len()/2)), true)
+	assert.ErrorIs(t, err, ErrTransferIncomplete)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	var transferErr *TransferError
+	assert.True(t, errors.As(err, &transferErr))
+	assert.NotEmpty(t, transferErr.LastKey)
+	all := dbContents(t, "target")
+	assert.Greater(t, len(all), 0)
+	assert.Less(t, len(all), len(entries))
+	for key := range all {
+		assert.LessOrEqual(t, key, transferErr.LastKey)
+	}
+
+	buf.Reset()
+	assert.Nil(t, SendDatabaseAfter("source", transferErr.LastKey, &buf))
+	assert.Nil(t, ReceiveDatabase("target", &buf, true))
+	assert.Equal(t, entries, dbContents(t, "target"))
+}
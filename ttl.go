@@ -0,0 +1,234 @@
+package cachekv
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// expiryBucketSeconds is the width of one expiry index bucket.
+const expiryBucketSeconds = 60
+
+// purgeChunk is how many index entries PurgeExpired checks per transaction.
+const purgeChunk = 1000
+
+// expiryIndexPrefix is where the expiry index of dbName lives in meta. Its
+// entries are <prefix><bucket>:<key>, with the bucket being the start of the
+// minute the key expires in, encoded with EncodeSortableInt so buckets sort
+// chronologically.
+func expiryIndexPrefix(dbName string) string {
+	return prefixMetaExpiry + dbName + ":"
+}
+
+func expiryBucket(expiresAt uint64) int64 {
+	return int64(expiresAt) / expiryBucketSeconds * expiryBucketSeconds
+}
+
+// WriteToKeyringWithTTL is WriteToKeyring for short-lived secrets, such as a
+// temporary key used during a rotation: badger drops the entry after ttl
+// (rounded to whole seconds), and reading it afterwards fails as if it had
+// never been written.
+func (s *Store) WriteToKeyringWithTTL(key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	return s.writeKeyringEntry(badger.NewEntry([]byte(key), value).WithTTL(ttl))
+}
+
+// WriteToKeyringWithTTL calls Store.WriteToKeyringWithTTL on the default store.
+func WriteToKeyringWithTTL(key string, value []byte, ttl time.Duration) error {
+	return defaultStore.WriteToKeyringWithTTL(key, value, ttl)
+}
+
+// InsertEntryWithTTL stores value under key and lets badger expire it after
+// ttl (rounded to whole seconds). The key is also recorded in the expiry
+// index, so PurgeExpired finds it without scanning the database.
+func (s *Store) InsertEntryWithTTL(dbName string, key string, value []byte, ttl time.Duration) error {
+	defer s.observeOp(dbName, "InsertEntryWithTTL", time.Now())
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	db, dbObject, err := s.openWritableDbByName(dbName)
+	if err != nil {
+		return err
+	}
+	if err = checkValueSize(dbName, dbObject.MaxValueSize, value); err != nil {
+		_ = s.releaseDb(dbName, db)
+		return err
+	}
+	entry, err := valueEntry([]byte(key), value, s.writeEncoding(dbObject))
+	if err == nil {
+		entry = entry.WithTTL(ttl)
+		err = setDbValueEntry(entry, db)
+	}
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return s.indexExpiry(dbName, key, entry.ExpiresAt)
+}
+
+// InsertEntryWithTTL calls Store.InsertEntryWithTTL on the default store.
+func InsertEntryWithTTL(dbName string, key string, value []byte, ttl time.Duration) error {
+	return defaultStore.InsertEntryWithTTL(dbName, key, value, ttl)
+}
+
+// indexExpiry records key in the expiry index, which lives in meta.
+func (s *Store) indexExpiry(dbName string, key string, expiresAt uint64) error {
+	indexKey := expiryIndexPrefix(dbName) + EncodeSortableInt(expiryBucket(expiresAt)) + ":" + key
+	return s.writeMetaEntry(indexKey, []byte{})
+}
+
+// indexExpiries records the keys of entries, all expiring at expiresAt, in
+// the expiry index in one batch.
+func (s *Store) indexExpiries(dbName string, entries map[string][]byte, expiresAt uint64) error {
+	prefix := expiryIndexPrefix(dbName) + EncodeSortableInt(expiryBucket(expiresAt)) + ":"
+	index := make(map[string][]byte, len(entries))
+	for key := range entries {
+		index[prefix+key] = []byte{}
+	}
+	return s.metaBatchInsert(&index)
+}
+
+// defaultExpiry is the badger expiry of an entry written now with ttl, as
+// badger.Entry.WithTTL sets it, or 0 for no ttl.
+func defaultExpiry(ttl time.Duration) uint64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return uint64(time.Now().Add(ttl).Unix())
+}
+
+// PurgeExpired deletes the expired keys of dbName, and their metadata, and
+// returns how many keys it removed. badger already hides expired keys from
+// reads; purging writes the tombstones that let compaction reclaim them. Only
+// index buckets up to now are visited, and only keys whose latest version's
+// expiry has passed count: index entries for keys that were since rewritten
+// or removed are dropped without touching the key.
+func (s *Store) PurgeExpired(dbName string) (int, error) {
+	db, _, err := s.openWritableDbByName(dbName)
+	if err != nil {
+		return 0, err
+	}
+	defer func(db *badger.DB) {
+		err := s.releaseDb(dbName, db)
+		if err != nil {
+			logger().Errorf("Error closing database: %v", err)
+		}
+	}(db)
+	meta, err := s.openMeta()
+	if err != nil {
+		return 0, err
+	}
+	defer s.releaseMeta()
+	prefix := expiryIndexPrefix(dbName)
+	now := time.Now().Unix()
+	indexKeys := make([]string, 0)
+	err = meta.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+			indexKey := string(it.Item().Key())
+			bucket, e := DecodeSortableInt(indexKey[len(prefix) : len(prefix)+sortableIntLength])
+			if e != nil {
+				continue
+			}
+			if bucket > now {
+				break
+			}
+			indexKeys = append(indexKeys, indexKey)
+		}
+		return nil
+	})
+	if err != nil || len(indexKeys) == 0 {
+		return 0, err
+	}
+
+	purged := 0
+	processed := make([]string, 0)
+	for start := 0; start < len(indexKeys); start += purgeChunk {
+		chunk := indexKeys[start:min(start+purgeChunk, len(indexKeys))]
+		var expired, done []string
+		// checked and deleted in one transaction, so a key rewritten with a
+		// fresh TTL meanwhile conflicts and is checked again
+		err = updateRetrying(db, func(txn *badger.Txn) error {
+			expired, done = expired[:0], done[:0]
+			for _, indexKey := range chunk {
+				rest := indexKey[len(prefix):]
+				key := rest[sortableIntLength+1:]
+				item := latestVersion(txn, []byte(key))
+				current := item != nil && item.ExpiresAt() > 0 &&
+					EncodeSortableInt(expiryBucket(item.ExpiresAt())) == rest[:sortableIntLength]
+				switch {
+				case current && item.ExpiresAt() <= uint64(now):
+					expired = append(expired, key)
+					done = append(done, indexKey)
+				case current && !item.IsDeletedOrExpired():
+					// still live, and this is its index entry
+				default:
+					done = append(done, indexKey)
+				}
+			}
+			for _, key := range expired {
+				if e := txn.Delete([]byte(key)); e != nil {
+					return e
+				}
+				// metadata expires with its key, so Get no longer sees it
+				metaKey := []byte(prefixEntryMeta + key)
+				if item := latestVersion(txn, metaKey); item != nil && item.ExpiresAt() > 0 {
+					if e := txn.Delete(metaKey); e != nil {
+						return e
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged += len(expired)
+		processed = append(processed, done...)
+	}
+	return purged, deleteKeys(meta, processed)
+}
+
+// PurgeExpired calls Store.PurgeExpired on the default store.
+func PurgeExpired(dbName string) (int, error) {
+	return defaultStore.PurgeExpired(dbName)
+}
+
+// latestVersion returns the newest version of key, deleted and expired ones
+// included, or nil if the key was never written.
+func latestVersion(txn *badger.Txn, key []byte) *badger.Item {
+	opts := badger.DefaultIteratorOptions
+	opts.AllVersions = true
+	opts.PrefetchValues = false
+	opts.Prefix = key
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	it.Seek(key)
+	if !it.Valid() || !bytes.Equal(it.Item().Key(), key) {
+		return nil
+	}
+	return it.Item()
+}
+
+// deleteKeys removes keys through a single WriteBatch, which splits the work
+// into transactions of a size badger accepts.
+func deleteKeys(db *badger.DB, keys []string) error {
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, key := range keys {
+		if err := wb.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
@@ -0,0 +1,110 @@
+package cachekv
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func expiryIndexSize(t *testing.T, dbName string) int {
+	meta, err := defaultStore.openMeta()
+	assert.Nil(t, err)
+	defer defaultStore.releaseMeta()
+	count, err := countRecords(expiryIndexPrefix(dbName), meta, false)
+	assert.Nil(t, err)
+	return count
+}
+
+func TestPurgeExpired(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, InsertEntryWithTTL(testDb, "short:"+strconv.Itoa(i), []byte("value"), time.Second))
+		assert.Nil(t, InsertEntryWithTTL(testDb, "long:"+strconv.Itoa(i), []byte("value"), time.Hour))
+	}
+	// rewritten without a TTL: its index entry is stale
+	assert.Nil(t, InsertEntryWithTTL(testDb, "refreshed", []byte("value"), time.Second))
+	assert.Nil(t, InsertEntry(testDb, "refreshed", []byte("value")))
+	// removed before it expired: not counted as expired, and neither is a
+	// key that only ever was in the index
+	assert.Nil(t, InsertEntryWithTTL(testDb, "removed", []byte("value"), time.Second))
+	assert.Nil(t, RemoveEntry(testDb, "removed"))
+	assert.Nil(t, defaultStore.indexExpiry(testDb, "never-written", uint64(time.Now().Unix())))
+	assert.Equal(t, 13, expiryIndexSize(t, testDb))
+	assert.NotNil(t, InsertEntryWithTTL(testDb, "bad", []byte("value"), 0))
+
+	time.Sleep(2 * time.Second)
+	purged, err := PurgeExpired(testDb)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, purged)
+	// only the long-lived keys are still indexed
+	assert.Equal(t, 5, expiryIndexSize(t, testDb))
+	_, err = GetEntry(testDb, "short:0")
+	assert.NotNil(t, err)
+	value, err := GetEntry(testDb, "long:0")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	value, err = GetEntry(testDb, "refreshed")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	purged, err = PurgeExpired(testDb)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, purged)
+}
+
+func TestPurgeExpiredConcurrentRewrite(t *testing.T) {
+	defer setup()()
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	n := 2000
+	for i := 0; i < n; i++ {
+		assert.Nil(t, InsertEntryWithTTL(testDb, "key"+strconv.Itoa(i), []byte("old"), 2*time.Second))
+	}
+	time.Sleep(3 * time.Second)
+
+	// keys given a fresh TTL while the purge runs keep their new value
+	writers := 8
+	rewritten := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		go func(w int) {
+			for i := w; i < n; i += writers {
+				if err := InsertEntryWithTTL(testDb, "key"+strconv.Itoa(i), []byte("new"), time.Hour); err != nil {
+					rewritten <- err
+					return
+				}
+			}
+			rewritten <- nil
+		}(w)
+	}
+	_, err := PurgeExpired(testDb)
+	assert.Nil(t, err)
+	for w := 0; w < writers; w++ {
+		assert.Nil(t, <-rewritten)
+	}
+	for i := 0; i < n; i++ {
+		value, err := GetEntry(testDb, "key"+strconv.Itoa(i))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("new"), value)
+	}
+}
+
+func TestWriteToKeyringWithTTL(t *testing.T) {
+	defer setup()()
+	assert.NotNil(t, WriteToKeyringWithTTL("temp", []byte("secret"), 0))
+	assert.Nil(t, WriteToKeyringWithTTL("temp", []byte("secret"), 2*time.Second))
+	assert.Nil(t, WriteToKeyring("kept", []byte("secret")))
+	value, err := defaultStore.getFromKeyring("temp")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("secret"), value)
+	time.Sleep(3 * time.Second)
+	_, err = defaultStore.getFromKeyring("temp")
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+	value, err = defaultStore.getFromKeyring("kept")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("secret"), value)
+}
@@ -1,7 +1,9 @@
 package cachekv
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/dgraph-io/badger/v4"
 )
@@ -12,6 +14,17 @@ type Storage struct {
 	file        string
 	key         []byte
 	rotatingKey bool
+	// state of the database at open time, see GetStorageObject
+	name       string
+	active     bool
+	secure     bool
+	readOnly   bool
+	encoding   valueEncoding
+	maxValue   int64
+	defaultTTL time.Duration
+	// release hands the shared handle back, for a Storage from OpenStorage.
+	release func() error
+	store   *Store
 }
 
 type Config struct {
@@ -19,6 +32,51 @@ type Config struct {
 	SecureNewDb bool   `json:"secure_new_db"`
 	MetaStore   string `json:"meta_store"`
 	MetaFile    string `json:"meta_file"`
+	// DeterministicDirNames names new database directories after a hash of
+	// the db name instead of a random suffix, see DeterministicDirName.
+	DeterministicDirNames bool `json:"deterministic_dir_names"`
+	// SlowOpThreshold, when set, logs every database open and key operation
+	// that takes longer, with the db name, the operation and how long it took.
+	SlowOpThreshold time.Duration `json:"slow_op_threshold"`
+	// MaxConcurrentOpens, when set, bounds how many databases have a shared
+	// handle open at once. Opening one more closes a handle no operation is
+	// using, or waits up to OpenSlotTimeout for one to be released.
+	MaxConcurrentOpens int `json:"max_concurrent_opens"`
+	// AuditReads records every successful GetEntry in the event log, as
+	// InsertEntry does for writes. It costs a meta write per read.
+	AuditReads bool `json:"audit_reads"`
+	// IntegrityCheckInterval, when set, runs CheckIntegrity in the
+	// background that often, logging what it finds, recording it in the
+	// event log and passing it to the SetIntegrityAlert function.
+	IntegrityCheckInterval time.Duration `json:"integrity_check_interval"`
+	// CompressValues gzips values over CompressionThreshold bytes on write,
+	// DefaultCompressionThreshold if it's zero. Reads decompress them
+	// whatever the setting, so it can be changed at any time.
+	CompressValues       bool `json:"compress_values"`
+	CompressionThreshold int  `json:"compression_threshold"`
+}
+
+// OpenOptions tunes how the package opens badger databases.
+type OpenOptions struct {
+	// IndexCacheSize is the size in bytes of badger's block index cache.
+	IndexCacheSize int64
+	// KeyRotationDuration is how long badger keeps using one internal data
+	// key before generating the next. Zero keeps badger's own default.
+	KeyRotationDuration time.Duration
+	// DisableKeyRotation keeps badger on a single data key, which avoids
+	// key-registry churn for short-lived or frequently reopened databases.
+	// It doesn't affect the package's own key rotation.
+	DisableKeyRotation bool
+	// Compression is "none", "snappy" or "zstd"; empty keeps badger's
+	// default. A database's DbObject.Compression overrides it.
+	Compression string
+	// NumVersionsToKeep is how many versions of each key badger retains
+	// through compaction, see GetEntryAsOf. Zero keeps badger's default of 1.
+	NumVersionsToKeep int
+
+	// inMemory opens databases with badger's InMemory mode, see WithInMemory.
+	// Only dbOpenOptions sets it, so the meta and key dbs stay on disk.
+	inMemory bool
 }
 
 type DbObject struct {
@@ -29,12 +87,110 @@ type DbObject struct {
 	Active      bool   `json:"active"`
 	LastRotated int64  `json:"last_rotated"`
 	Deleted     int64  `json:"deleted"`
+	ReadOnly    bool   `json:"read_only"`
+	// DefaultTTL, when set, expires every entry written without a TTL of its
+	// own after that long, as InsertEntryWithTTL does: InsertEntry,
+	// UpdateEntry, the batch inserts and a Storage's writes included.
+	DefaultTTL  time.Duration `json:"default_ttl"`
+	Compression string        `json:"compression"`
+	Tags        []string      `json:"tags"`
+	// Encoding holds the value envelope flags new writes are encoded with,
+	// see envelope.go. Zero stores values raw.
+	Encoding byte `json:"encoding"`
+	// KeyDerived marks a secure database whose key is derived from the
+	// master key, see SetMasterKey, rather than kept in the keyring.
+	KeyDerived bool `json:"key_derived"`
+	// MaxValueSize, when set, is the largest value in bytes the database
+	// accepts; larger writes fail with ErrValueTooLarge. See WithMaxValueSize.
+	MaxValueSize int64 `json:"max_value_size"`
+	// BadgerVersion is the badger release the database was created with.
+	BadgerVersion string `json:"badger_version"`
+	// Name is filled in by listings such as ListDatabasesByCreation; it
+	// isn't stored, the meta key carries it.
+	Name string `json:"-"`
+}
+
+// DbTemplate is a set of settings ApplyTemplate stamps onto databases. Nil
+// fields are left as they are on each database.
+type DbTemplate struct {
+	DefaultTTL  *time.Duration
+	Compression *string
+	ReadOnly    *bool
+	// Tags replaces the databases' tags when non-nil.
+	Tags []string
+}
+
+// BatchResult summarises a detailed batch insert.
+type BatchResult struct {
+	Total     int            `json:"total"`
+	Succeeded int            `json:"succeeded"`
+	Failed    []BatchFailure `json:"failed"`
+}
+
+// BatchFailure is a single key rejected during a batch insert.
+type BatchFailure struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// KV is a single key/value pair read from a database.
+type KV struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	// Version and Deleted are only filled by ChangesSince.
+	Version uint64 `json:"version,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// ArchivedKey is a keypair writeToStorage set aside when it was replaced, see
+// ListArchivedKeypairs.
+type ArchivedKey struct {
+	// Timestamp is the unix time the keypair was archived at, the suffix of
+	// its file names. Seq counts the keypairs archived before it in the same
+	// second, and is appended to the suffix as "-<seq>" when it isn't 0.
+	Timestamp   int64  `json:"timestamp"`
+	Seq         int    `json:"seq"`
+	PrivatePath string `json:"private_path"`
+	// PublicPath is empty if only the private key was archived.
+	PublicPath string `json:"public_path"`
+}
+
+// Profile describes the shape of a database's keyspace, see DatabaseProfile.
+type Profile struct {
+	KeyCount int `json:"key_count"`
+	// TotalValueSize and AvgValueSize are in bytes as stored, envelope
+	// header included; values kept in the value log are badger's estimate.
+	TotalValueSize int64   `json:"total_value_size"`
+	AvgValueSize   float64 `json:"avg_value_size"`
+	MinKeyLength   int     `json:"min_key_length"`
+	MaxKeyLength   int     `json:"max_key_length"`
+	// TopPrefixes holds the most common key prefixes, most common first.
+	TopPrefixes []PrefixCount `json:"top_prefixes"`
+}
+
+// PrefixCount is how many keys share a prefix.
+type PrefixCount struct {
+	Prefix string `json:"prefix"`
+	Count  int    `json:"count"`
 }
 
 type Event struct {
 	Type    EventType `json:"type"`
 	Comment string    `json:"comment"`
 	TSTamp  int64     `json:"tstamp"`
+	// DbName is the database the event is about, empty for store-wide
+	// events and for those recorded before it was added.
+	DbName string `json:"db_name,omitempty"`
+}
+
+// EventBufferOptions configures buffering of events, see SetEventBuffering.
+type EventBufferOptions struct {
+	// Size is how many events are held before they are written in one
+	// batch. 0 or 1 writes every event straight away.
+	Size int
+	// FlushInterval, when set, also writes the buffer once its oldest event
+	// is that old, checked as the next event arrives.
+	FlushInterval time.Duration
 }
 
 type EventType int
@@ -47,17 +203,40 @@ const (
 	EventTypeDelete
 	EventTypeUpdate
 	EventTypeConfigChange
+	EventTypeIntegrityProblem
 	_
 
 	prefixMetaKey    = "metakey:fxstorage"
 	prefixMetaDb     = "fxstorage_db:"
 	prefixMetaEvent  = "fxstorage_event:"
 	prefixMetaConfig = "fxstorage_config"
+	prefixMetaExpiry = "fxstorage_expiry:"
 	lockDb           = "lock.db"
+	maxDbNameLength  = 128
 	errDbRotating    = "maintenance: rotating key"
 	errDbInactive    = "error: trying to access inactive db"
 )
 
+var (
+	ErrLockNotHeld  = errors.New("lock is not held by this token")
+	ErrDbReadOnly   = errors.New("error: trying to modify read-only db")
+	ErrDbNotDeleted = errors.New("database is not soft-deleted")
+	ErrDbBusy       = errors.New("database is still in use")
+
+	ErrInvalidDatabaseName   = errors.New("invalid database name")
+	ErrEncryptionNotApplied  = errors.New("secure database was opened without its encryption key")
+	ErrMissingDbKey          = errors.New("secure database has no usable key in the keyring")
+	ErrKeyringUnavailable    = errors.New("keyring could not be read")
+	ErrValueTooLarge         = errors.New("value exceeds the database's maximum value size")
+	ErrBadgerVersionMismatch = errors.New("database was written by an incompatible badger version")
+	ErrDecryptionFailed      = errors.New("value could not be decrypted")
+	ErrReservedKey           = errors.New("key starts with the prefix reserved for the store's own entries")
+
+	ErrNoRotation         = errors.New("no key rotation in progress")
+	ErrRotationAborted    = errors.New("key rotation aborted")
+	ErrRotationCommitting = errors.New("key rotation is committing and can't be aborted")
+)
+
 type EMetaKeyNotFound struct {
 	Code    int
 	Message string
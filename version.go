@@ -0,0 +1,73 @@
+package cachekv
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+const badgerModule = "github.com/dgraph-io/badger/v4"
+
+var (
+	badgerVersionOnce sync.Once
+	badgerVersionStr  string
+)
+
+// badgerVersion is the version of badger linked into this binary, e.g.
+// "v4.8.0", or "" when the build doesn't record it.
+func badgerVersion() string {
+	badgerVersionOnce.Do(func() {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		for _, dep := range info.Deps {
+			if dep.Path != badgerModule {
+				continue
+			}
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			if strings.HasPrefix(dep.Version, "v") {
+				badgerVersionStr = dep.Version
+			}
+		}
+	})
+	return badgerVersionStr
+}
+
+// majorVersion returns the "vN" part of a semantic version.
+func majorVersion(version string) string {
+	major, _, _ := strings.Cut(version, ".")
+	return major
+}
+
+// checkBadgerVersion refuses databases written by a badger major version other
+// than the linked one; badger only changes its on-disk format across majors.
+// Databases created before versions were recorded, and builds that don't know
+// their own badger version, pass.
+func checkBadgerVersion(dbName string, dbObject *DbObject) error {
+	running := badgerVersion()
+	if dbObject.BadgerVersion == "" || running == "" {
+		return nil
+	}
+	if majorVersion(dbObject.BadgerVersion) != majorVersion(running) {
+		return fmt.Errorf("%s - %w: created with badger %s, this build has %s; export it with the old version and import it here",
+			dbName, ErrBadgerVersionMismatch, dbObject.BadgerVersion, running)
+	}
+	return nil
+}
+
+// explainOpenError adds ErrBadgerVersionMismatch to badger's own complaint
+// about an on-disk format it can't read.
+func explainOpenError(dbName string, err error) error {
+	if err == nil || errors.Is(err, ErrBadgerVersionMismatch) {
+		return err
+	}
+	if strings.Contains(err.Error(), "unsupported version") {
+		return fmt.Errorf("%s - %w: %w", dbName, ErrBadgerVersionMismatch, err)
+	}
+	return err
+}
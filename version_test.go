@@ -0,0 +1,38 @@
+package cachekv
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBadgerVersionRecorded(t *testing.T) {
+	defer setup()()
+	assert.Nil(t, CreateDatabase("testdb", true))
+	dbObject, err := defaultStore.getMetaDbObject("testdb")
+	assert.Nil(t, err)
+	assert.Equal(t, badgerVersion(), dbObject.BadgerVersion)
+	assert.Equal(t, "v4", majorVersion(badgerVersion()))
+
+	// a database from another badger major is refused up front
+	dbObject.BadgerVersion = "v3.2103.5"
+	assert.Nil(t, defaultStore.writeMetaDbObject("testdb", dbObject, true))
+	_, err = GetEntry("testdb", "key")
+	assert.ErrorIs(t, err, ErrBadgerVersionMismatch)
+	_, err = GetStorageObject("testdb")
+	assert.ErrorIs(t, err, ErrBadgerVersionMismatch)
+
+	// nor are databases created before versions were recorded
+	dbObject.BadgerVersion = ""
+	assert.Nil(t, defaultStore.writeMetaDbObject("testdb", dbObject, true))
+	assert.Nil(t, InsertEntry("testdb", "key", []byte("value")))
+}
+
+func TestExplainOpenError(t *testing.T) {
+	err := explainOpenError("testdb", errors.New("manifest has unsupported version: 7 (we support 8)"))
+	assert.ErrorIs(t, err, ErrBadgerVersionMismatch)
+	assert.Contains(t, err.Error(), "we support 8")
+	other := errors.New("permission denied")
+	assert.Equal(t, other, explainOpenError("testdb", other))
+}
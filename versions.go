@@ -0,0 +1,122 @@
+package cachekv
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// InsertEntryVersioned is InsertEntry that also returns the version badger
+// committed the write at, for use with GetEntryAsOf. Like InsertEntry it
+// enforces the database's MaxValueSize and applies its DefaultTTL.
+func (s *Store) InsertEntryVersioned(dbName string, key string, value []byte) (uint64, error) {
+	db, dbObject, err := s.openWritableDbByName(dbName)
+	if err != nil {
+		return 0, err
+	}
+	if err = checkValueSize(dbName, dbObject.MaxValueSize, value); err != nil {
+		_ = s.releaseDb(dbName, db)
+		return 0, err
+	}
+	entry, err := valueEntry([]byte(key), value, s.writeEncoding(dbObject))
+	if err == nil && dbObject.DefaultTTL > 0 {
+		entry = entry.WithTTL(dbObject.DefaultTTL)
+	}
+	var readTs, version uint64
+	if err == nil {
+		err = updateRetrying(db, func(txn *badger.Txn) error {
+			// reading the key makes a write by anyone else between our read
+			// timestamp and our commit a conflict, which is retried
+			if _, e := txn.Get([]byte(key)); e != nil && !errors.Is(e, badger.ErrKeyNotFound) {
+				return e
+			}
+			readTs = txn.ReadTs()
+			return txn.SetEntry(entry)
+		})
+	}
+	if err == nil {
+		// so the write's version is the oldest of the key's newer than readTs
+		err = db.View(func(txn *badger.Txn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.AllVersions = true
+			opts.PrefetchValues = false
+			opts.Prefix = []byte(key)
+			it := txn.NewIterator(opts)
+			defer it.Close()
+			for it.Seek([]byte(key)); it.Valid(); it.Next() {
+				item := it.Item()
+				if !bytes.Equal(item.Key(), []byte(key)) || item.Version() <= readTs {
+					break
+				}
+				version = item.Version()
+			}
+			if version == 0 {
+				return badger.ErrKeyNotFound
+			}
+			return nil
+		})
+	}
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return 0, err
+	}
+	if closeErr != nil {
+		return 0, closeErr
+	}
+	if entry.ExpiresAt > 0 {
+		return version, s.indexExpiry(dbName, key, entry.ExpiresAt)
+	}
+	return version, nil
+}
+
+// InsertEntryVersioned calls Store.InsertEntryVersioned on the default store.
+func InsertEntryVersioned(dbName string, key string, value []byte) (uint64, error) {
+	return defaultStore.InsertEntryVersioned(dbName, key, value)
+}
+
+// GetEntryAsOf returns the value key had at version, i.e. written by the last
+// commit at or before it. Versions only survive compaction up to
+// OpenOptions.NumVersionsToKeep, so older ones may be gone; a key that didn't
+// exist at version, was deleted or had expired returns badger.ErrKeyNotFound.
+func (s *Store) GetEntryAsOf(dbName string, key string, version uint64) ([]byte, error) {
+	db, _, err := s.openDbByName(dbName)
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.AllVersions = true
+		opts.Prefix = []byte(key)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		// versions of a key come newest first
+		for it.Seek([]byte(key)); it.Valid(); it.Next() {
+			item := it.Item()
+			if !bytes.Equal(item.Key(), []byte(key)) {
+				break
+			}
+			if item.Version() > version {
+				continue
+			}
+			if item.IsDeletedOrExpired() {
+				return badger.ErrKeyNotFound
+			}
+			v, e := itemValue(item)
+			value = v
+			return e
+		}
+		return badger.ErrKeyNotFound
+	})
+	closeErr := s.releaseDb(dbName, db)
+	if err != nil {
+		return nil, err
+	}
+	return value, closeErr
+}
+
+// GetEntryAsOf calls Store.GetEntryAsOf on the default store.
+func GetEntryAsOf(dbName string, key string, version uint64) ([]byte, error) {
+	return defaultStore.GetEntryAsOf(dbName, key, version)
+}
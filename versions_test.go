@@ -0,0 +1,90 @@
+package cachekv
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetEntryAsOf(t *testing.T) {
+	defer setup()()
+	opts := DefaultOpenOptions()
+	opts.NumVersionsToKeep = 10
+	SetOpenOptions(opts)
+	defer SetOpenOptions(DefaultOpenOptions())
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+
+	v1, err := InsertEntryVersioned(testDb, "key", []byte("first"))
+	assert.Nil(t, err)
+	// a write to another key sits between the two versions
+	assert.Nil(t, InsertEntry(testDb, "key2", []byte("other")))
+	v2, err := InsertEntryVersioned(testDb, "key", []byte("second"))
+	assert.Nil(t, err)
+	assert.Greater(t, v2, v1)
+	assert.Nil(t, RemoveEntry(testDb, "key"))
+
+	value, err := GetEntryAsOf(testDb, "key", v1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("first"), value)
+	value, err = GetEntryAsOf(testDb, "key", v2-1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("first"), value)
+	value, err = GetEntryAsOf(testDb, "key", v2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("second"), value)
+	_, err = GetEntryAsOf(testDb, "key", v1-1)
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+	_, err = GetEntryAsOf(testDb, "key", v2+1)
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+	// "key2" shares the prefix without being a version of "key"
+	_, err = GetEntryAsOf(testDb, "ke", v2)
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+}
+
+func TestInsertEntryVersionedConcurrentWriter(t *testing.T) {
+	defer setup()()
+	opts := DefaultOpenOptions()
+	opts.NumVersionsToKeep = 1000
+	SetOpenOptions(opts)
+	defer SetOpenOptions(DefaultOpenOptions())
+	testDb := "testdb"
+	assert.Nil(t, CreateDatabase(testDb, true))
+	storage, err := OpenStorage(testDb)
+	assert.Nil(t, err)
+
+	// another writer on the shared handle keeps committing to the same key
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			assert.Nil(t, storage.InsertEntry("key", []byte(fmt.Sprint("other-", i))))
+		}
+	}()
+	versions := make(map[uint64]string)
+	for i := 0; i < 20; i++ {
+		mine := fmt.Sprint("mine-", i)
+		version, err := InsertEntryVersioned(testDb, "key", []byte(mine))
+		assert.Nil(t, err)
+		assert.NotContains(t, versions, version)
+		versions[version] = mine
+	}
+	close(stop)
+	wg.Wait()
+	assert.Nil(t, storage.Close())
+	for version, mine := range versions {
+		value, err := GetEntryAsOf(testDb, "key", version)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(mine), value)
+	}
+}